@@ -0,0 +1,174 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AutotuneConfig bounds the pool size chosen by the autotuner. TargetWaitP95 is the time the queries may
+// spend waiting for a connection in total per Interval, the pool grows when they wait longer.
+type AutotuneConfig struct {
+	Min           int
+	Max           int
+	TargetWaitP95 time.Duration
+	Interval      time.Duration
+}
+
+type AutotuneStats struct {
+	Samples      int
+	Raises       int
+	Lowers       int
+	MaxOpenConns int
+	LastChange   time.Time
+	LastReason   string
+}
+
+// Autotuner adjusts MaxOpenConns from the wait statistics of the pool.
+type Autotuner struct {
+	mgt    *DbMgt
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+	stats  AutotuneStats
+}
+
+// StartPoolAutotune samples the pool statistics every interval until ctx is done or Stop is called, raising
+// MaxOpenConns by a quarter when the queries waited more than TargetWaitP95 for a connection and lowering it by
+// one when most connections are idle. Only one autotuner may run per DbMgt.
+func (c *DbMgt) StartPoolAutotune(ctx context.Context, cfg AutotuneConfig) (*Autotuner, error) {
+	if cfg.Interval <= 0 {
+		return nil, errors.New("dbwrap: autotune interval must be positive")
+	}
+	if cfg.Min <= 0 || cfg.Max < cfg.Min {
+		return nil, fmt.Errorf("dbwrap: invalid autotune bounds %d-%d", cfg.Min, cfg.Max)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.autotuner != nil {
+		return nil, errors.New("dbwrap: an autotuner is already running")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	a := &Autotuner{mgt: c, cancel: cancel, done: make(chan struct{})}
+	c.autotuner = a
+	go a.run(ctx, cfg)
+	return a, nil
+}
+
+func (a *Autotuner) run(ctx context.Context, cfg AutotuneConfig) {
+	defer close(a.done)
+	defer func() {
+		a.mgt.lock.Lock()
+		if a.mgt.autotuner == a {
+			a.mgt.autotuner = nil
+		}
+		// back to the static limits
+		if a.mgt.db != nil {
+			if sqlDB, err := a.mgt.db.DB(); err == nil {
+				a.mgt.restorePoolLimits(sqlDB)
+			}
+		}
+		a.mgt.lock.Unlock()
+	}()
+	tick := time.NewTicker(cfg.Interval)
+	defer tick.Stop()
+	var pool *sql.DB
+	var prev sql.DBStats
+	var current int
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		a.mgt.lock.Lock()
+		db, draining := a.mgt.db, a.mgt.drain != nil
+		a.mgt.lock.Unlock()
+		if db == nil || draining {
+			continue
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			continue
+		}
+		stats := sqlDB.Stats()
+		if sqlDB != pool {
+			// first sample of this pool, Reopen starts the counters over
+			pool, prev = sqlDB, stats
+			if current == 0 {
+				current = clampConns(stats.MaxOpenConnections, cfg)
+			}
+			sqlDB.SetMaxOpenConns(current)
+			continue
+		}
+		next, reason := autotuneDecision(cfg, current, prev, stats)
+		prev = stats
+		a.lock.Lock()
+		a.stats.Samples++
+		if next != current {
+			if next > current {
+				a.stats.Raises++
+			} else {
+				a.stats.Lowers++
+			}
+			a.stats.LastChange, a.stats.LastReason = time.Now(), reason
+		}
+		a.stats.MaxOpenConns = next
+		a.lock.Unlock()
+		if next != current {
+			a.mgt.events().Info(ctx, "dbwrap: autotune max open connections %d -> %d: %s", current, next, reason)
+			current = next
+			sqlDB.SetMaxOpenConns(current)
+		}
+	}
+}
+
+// autotuneDecision returns the pool size following current after the statistics moved from prev to cur.
+func autotuneDecision(cfg AutotuneConfig, current int, prev, cur sql.DBStats) (int, string) {
+	waited := cur.WaitDuration - prev.WaitDuration
+	// database/sql adds to WaitDuration when a wait ends, but to WaitCount when it starts
+	if waited > cfg.TargetWaitP95 {
+		if current >= cfg.Max {
+			return current, ""
+		}
+		step := current / 4
+		if step < 1 {
+			step = 1
+		}
+		return clampConns(current+step, cfg), fmt.Sprintf("queries waited %s for a connection", waited)
+	}
+	if waited <= 0 && cur.Idle > cur.InUse && current > cfg.Min {
+		return current - 1, fmt.Sprintf("%d idle and %d in use connections", cur.Idle, cur.InUse)
+	}
+	return current, ""
+}
+
+func clampConns(n int, cfg AutotuneConfig) int {
+	if n <= 0 || n > cfg.Max {
+		return cfg.Max
+	}
+	if n < cfg.Min {
+		return cfg.Min
+	}
+	return n
+}
+
+// Stop stops the autotuner, restores the limits of the configuration and SetConnPool and waits for it to exit.
+// It may be called several times.
+func (a *Autotuner) Stop() {
+	a.cancel()
+	<-a.done
+}
+
+func (a *Autotuner) Stats() AutotuneStats {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.stats
+}
+
+func StartPoolAutotune(ctx context.Context, cfg AutotuneConfig) (*Autotuner, error) {
+	return DefaultDbMgt().StartPoolAutotune(ctx, cfg)
+}
@@ -0,0 +1,111 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAutotuneDecision(t *testing.T) {
+	cfg := AutotuneConfig{Min: 2, Max: 20, TargetWaitP95: 100 * time.Millisecond, Interval: time.Second}
+	// each step moves the statistics by waited, with idle and inUse connections
+	steps := []struct {
+		waited      time.Duration
+		idle, inUse int
+		want        int
+		changed     bool
+	}{
+		{500 * time.Millisecond, 0, 8, 10, true},
+		{500 * time.Millisecond, 0, 10, 12, true},
+		{time.Second, 0, 12, 15, true},
+		{time.Second, 0, 15, 18, true},
+		// clamped to Max, then kept there
+		{time.Second, 0, 18, 20, true},
+		{time.Second, 0, 20, 20, false},
+		// at the target or below, the size only shrinks when idle connections dominate and nothing waited
+		{100 * time.Millisecond, 10, 2, 20, false},
+		{50 * time.Millisecond, 10, 2, 20, false},
+		{0, 5, 5, 20, false},
+		{0, 6, 5, 19, true},
+		{0, 6, 1, 18, true},
+	}
+	current := 8
+	var stats sql.DBStats
+	for i, step := range steps {
+		prev := stats
+		stats = sql.DBStats{WaitDuration: prev.WaitDuration + step.waited, Idle: step.idle, InUse: step.inUse,
+			WaitCount: prev.WaitCount + 1}
+		next, reason := autotuneDecision(cfg, current, prev, stats)
+		if next != step.want || (len(reason) > 0) != step.changed {
+			t.Errorf("step %d: autotuneDecision(%d) = %d, %q, want %d", i, current, next, reason, step.want)
+		}
+		current = next
+	}
+}
+
+func TestAutotuneDecisionBounds(t *testing.T) {
+	cfg := AutotuneConfig{Min: 2, Max: 4, TargetWaitP95: time.Millisecond}
+	idle := sql.DBStats{Idle: 3}
+	if next, _ := autotuneDecision(cfg, 2, sql.DBStats{}, idle); next != 2 {
+		t.Errorf("lowered to %d below Min", next)
+	}
+	// a small pool grows by at least one connection
+	waited := sql.DBStats{WaitDuration: time.Second}
+	if next, _ := autotuneDecision(cfg, 2, sql.DBStats{}, waited); next != 3 {
+		t.Errorf("raised to %d, want 3", next)
+	}
+	for n, want := range map[int]int{0: 4, 1: 2, 3: 3, 9: 4} {
+		if got := clampConns(n, cfg); got != want {
+			t.Errorf("clampConns(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestStartPoolAutotune(t *testing.T) {
+	events := &recordLogger{}
+	c := NewWithOptions(WithEventLogger(events)).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db")).
+		SetConnPool(10, 10, 0, 0)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, cfg := range []AutotuneConfig{{Min: 1, Max: 4}, {Min: 0, Max: 4, Interval: time.Second},
+		{Min: 5, Max: 4, Interval: time.Second}} {
+		if _, err := c.StartPoolAutotune(context.Background(), cfg); err == nil {
+			t.Errorf("StartPoolAutotune(%+v) succeeded", cfg)
+		}
+	}
+	cfg := AutotuneConfig{Min: 2, Max: 6, Interval: 10 * time.Millisecond}
+	a, err := c.StartPoolAutotune(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+	if _, err = c.StartPoolAutotune(context.Background(), cfg); err == nil {
+		t.Error("a second autotuner started")
+	}
+	// idle connections and no wait shrink the pool down to Min
+	holdConns(t, c, 6)
+	waitFor(t, "the pool to shrink", func() bool {
+		return a.Stats().MaxOpenConns == 2
+	})
+	if stats := a.Stats(); stats.Lowers != 4 || stats.Samples < stats.Lowers || len(stats.LastReason) <= 0 {
+		t.Errorf("Stats() = %+v, want the 4 steps from 6 to 2", stats)
+	}
+	a.Stop()
+	a.Stop()
+	if lines := events.Lines(); len(lines) != 4 || lines[0] != "dbwrap: autotune max open connections 6 -> 5: "+
+		"6 idle and 0 in use connections" {
+		t.Errorf("logged %q, want each change", lines)
+	}
+	if max := c.CommonDB().Stats().MaxOpenConnections; max != 10 {
+		t.Errorf("MaxOpenConnections = %d after Stop, want the SetConnPool 10", max)
+	}
+	if a, err = c.StartPoolAutotune(context.Background(), cfg); err != nil {
+		t.Errorf("StartPoolAutotune() = %v after Stop", err)
+	} else {
+		a.Stop()
+	}
+}
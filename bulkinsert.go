@@ -0,0 +1,124 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BulkOptions configures BulkInsert.
+type BulkOptions struct {
+	// BatchSize is the number of rows per INSERT statement. By default it is the largest size, up to 1000, that
+	// keeps the bound parameters under the limit of the driver.
+	BatchSize int
+	// SingleTransaction inserts every chunk in one transaction, otherwise each chunk is committed on its own and
+	// a failure leaves the chunks before it inserted.
+	SingleTransaction bool
+	// OnConflictDoNothing skips the rows violating a unique constraint instead of failing.
+	OnConflictDoNothing bool
+	// Progress is called after each chunk with the number of chunks and rows inserted so far.
+	Progress func(chunksDone, rowsDone int)
+}
+
+const maxBulkBatchSize = 1000
+
+// maxBindParams is the number of parameters a statement can bind, sqlite being compiled with the historical
+// default of 999 in many distributions.
+var maxBindParams = map[string]int{
+	driverPostgres:  65535,
+	driverMysql:     65535,
+	driverSqlServer: 2100 - 1,
+	driverSqlite:    999,
+}
+
+// BulkInsert inserts rows, a slice or an array of models or a pointer to one, in chunks of opts.BatchSize rows.
+// It stops with ctx.Err() between chunks once ctx is done. The primary keys are filled in the rows, but for an
+// array passed by value.
+func (c *DbMgt) BulkInsert(ctx context.Context, rows interface{}, opts BulkOptions) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	value := reflect.Indirect(reflect.ValueOf(rows))
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return errors.New("dbwrap: BulkInsert needs a slice of rows")
+	}
+	if !value.CanAddr() {
+		// an array passed by value cannot be sliced, its copy can
+		copied := reflect.New(value.Type()).Elem()
+		copied.Set(value)
+		value = copied
+	}
+	total := value.Len()
+	if total <= 0 {
+		return nil
+	}
+	db = db.WithContext(ctx)
+	size := opts.BatchSize
+	if size <= 0 {
+		if size, err = bulkBatchSize(db, rows); err != nil {
+			return err
+		}
+	}
+	if opts.OnConflictDoNothing {
+		db = db.Clauses(clause.OnConflict{DoNothing: true})
+	}
+	insert := func(tx *gorm.DB) error {
+		chunks := 0
+		for start := 0; start < total; start += size {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			end := start + size
+			if end > total {
+				end = total
+			}
+			if err := tx.Create(value.Slice(start, end).Interface()).Error; err != nil {
+				return fmt.Errorf("dbwrap: bulk insert rows %d-%d: %w", start, end-1, err)
+			}
+			chunks++
+			if opts.Progress != nil {
+				opts.Progress(chunks, end)
+			}
+		}
+		return nil
+	}
+	if opts.SingleTransaction {
+		return db.Transaction(insert)
+	}
+	return insert(db)
+}
+
+// bulkBatchSize divides the parameter limit of the driver by the number of columns of the model.
+func bulkBatchSize(db *gorm.DB, rows interface{}) (int, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(rows); err != nil {
+		return 0, err
+	}
+	var columns int
+	for _, field := range stmt.Schema.Fields {
+		if len(field.DBName) > 0 && field.Creatable {
+			columns++
+		}
+	}
+	limit, ok := maxBindParams[db.Dialector.Name()]
+	if !ok {
+		limit = maxBindParams[driverSqlite]
+	}
+	size := maxBulkBatchSize
+	if columns > 0 && limit/columns < size {
+		size = limit / columns
+	}
+	if size <= 0 {
+		size = 1
+	}
+	return size, nil
+}
+
+func BulkInsert(ctx context.Context, rows interface{}, opts BulkOptions) error {
+	return DefaultDbMgt().BulkInsert(ctx, rows, opts)
+}
@@ -0,0 +1,123 @@
+//go:build postgres
+// +build postgres
+
+package dbwrap
+
+import (
+	"context"
+	"testing"
+)
+
+// testWide has 66 columns, so that 1000 rows bind 66000 parameters, more than the 65535 of postgres.
+type testWide struct {
+	ID  uint
+	C01 int
+	C02 int
+	C03 int
+	C04 int
+	C05 int
+	C06 int
+	C07 int
+	C08 int
+	C09 int
+	C10 int
+	C11 int
+	C12 int
+	C13 int
+	C14 int
+	C15 int
+	C16 int
+	C17 int
+	C18 int
+	C19 int
+	C20 int
+	C21 int
+	C22 int
+	C23 int
+	C24 int
+	C25 int
+	C26 int
+	C27 int
+	C28 int
+	C29 int
+	C30 int
+	C31 int
+	C32 int
+	C33 int
+	C34 int
+	C35 int
+	C36 int
+	C37 int
+	C38 int
+	C39 int
+	C40 int
+	C41 int
+	C42 int
+	C43 int
+	C44 int
+	C45 int
+	C46 int
+	C47 int
+	C48 int
+	C49 int
+	C50 int
+	C51 int
+	C52 int
+	C53 int
+	C54 int
+	C55 int
+	C56 int
+	C57 int
+	C58 int
+	C59 int
+	C60 int
+	C61 int
+	C62 int
+	C63 int
+	C64 int
+	C65 int
+}
+
+func TestBulkInsertPostgresParameterLimit(t *testing.T) {
+	c := openPostgres(t)
+	if err := c.Migrate(&testWide{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Db().Migrator().DropTable(&testWide{})
+	if err := c.BulkInsert(context.Background(), make([]testWide, 1000), BulkOptions{BatchSize: 1000}); err == nil {
+		t.Fatal("BulkInsert bound 66000 parameters")
+	}
+	var chunks int
+	err := c.BulkInsert(context.Background(), make([]testWide, 2000), BulkOptions{Progress: func(chunksDone, _ int) {
+		chunks = chunksDone
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 65535 / 66 = 992 rows per chunk
+	if chunks != 3 {
+		t.Errorf("%d chunks, want 3", chunks)
+	}
+	var count int64
+	if err = c.Db().Model(&testWide{}).Count(&count).Error; err != nil || count != 2000 {
+		t.Errorf("count = %d, %v, want 2000", count, err)
+	}
+}
+
+func TestBulkInsertPostgresConflicts(t *testing.T) {
+	c := openPostgres(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Db().Migrator().DropTable(&testUser{})
+	if err := c.BulkInsert(context.Background(), testUsers(10, 1), BulkOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.BulkInsert(context.Background(), testUsers(20, 1), BulkOptions{OnConflictDoNothing: true, BatchSize: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := countUsers(t, c); count != 20 {
+		t.Errorf("%d rows, want the existing ones skipped", count)
+	}
+}
@@ -0,0 +1,166 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func testUsers(n, firstID int) []testUser {
+	users := make([]testUser, n)
+	for i := range users {
+		users[i] = testUser{ID: uint(firstID + i), Name: fmt.Sprint("user", firstID+i)}
+	}
+	return users
+}
+
+func countUsers(t *testing.T, c *DbMgt) int64 {
+	t.Helper()
+	var count int64
+	if err := c.Db().Model(&testUser{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// namedDialector is a dialector with the name of another driver.
+type namedDialector struct {
+	gorm.Dialector
+	name string
+}
+
+func (d namedDialector) Name() string {
+	return d.name
+}
+
+func TestBulkBatchSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	tests := []struct {
+		driver string
+		model  interface{}
+		want   int
+	}{
+		// testUser has 2 columns, testInvoice 3
+		{driverPostgres, []testUser{}, 1000},
+		{driverMysql, []testUser{}, 1000},
+		{driverSqlServer, []testUser{}, 1000},
+		{driverSqlServer, []testInvoice{}, 699},
+		{driverSqlite, []testUser{}, 499},
+		{driverSqlite, []testInvoice{}, 333},
+		{"clickhouse", []testInvoice{}, 333},
+	}
+	for _, test := range tests {
+		db, err := gorm.Open(namedDialector{sqlite.Open(path), test.driver}, &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size, err := bulkBatchSize(db, test.model); err != nil || size != test.want {
+			t.Errorf("%s %T: bulkBatchSize() = %d, %v, want %d", test.driver, test.model, size, err, test.want)
+		}
+		closeGormDB(db)
+	}
+}
+
+func TestBulkInsert(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	users := make([]testUser, 1200)
+	for i := range users {
+		users[i].Name = fmt.Sprint("user", i)
+	}
+	var progress [][2]int
+	err := c.BulkInsert(context.Background(), &users, BulkOptions{Progress: func(chunksDone, rowsDone int) {
+		progress = append(progress, [2]int{chunksDone, rowsDone})
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][2]int{{1, 499}, {2, 998}, {3, 1200}}; fmt.Sprint(progress) != fmt.Sprint(want) {
+		t.Errorf("progress = %v, want %v", progress, want)
+	}
+	if count := countUsers(t, c); count != 1200 {
+		t.Errorf("%d rows, want 1200", count)
+	}
+	if users[0].ID == 0 || users[1199].ID == 0 {
+		t.Error("the primary keys are not filled")
+	}
+
+	array := [3]testUser{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	if err = c.BulkInsert(context.Background(), array, BulkOptions{BatchSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if count := countUsers(t, c); count != 1203 {
+		t.Errorf("%d rows after inserting an array, want 1203", count)
+	}
+	if err = c.BulkInsert(context.Background(), testUser{}, BulkOptions{}); err == nil {
+		t.Error("BulkInsert accepted a single row")
+	}
+	if err = c.BulkInsert(context.Background(), []testUser{}, BulkOptions{}); err != nil {
+		t.Errorf("BulkInsert() = %v without rows", err)
+	}
+}
+
+func TestBulkInsertConflicts(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.BulkInsert(context.Background(), testUsers(10, 1), BulkOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.BulkInsert(context.Background(), testUsers(10, 11), BulkOptions{BatchSize: 5}); err != nil {
+		t.Fatal(err)
+	}
+	// rows 6 to 10 exist, the second chunk fails
+	err := c.BulkInsert(context.Background(), append(testUsers(5, 21), testUsers(5, 6)...),
+		BulkOptions{BatchSize: 5, SingleTransaction: true})
+	if err == nil || !strings.Contains(err.Error(), "rows 5-9") {
+		t.Errorf("BulkInsert() = %v, want the failing chunk", err)
+	}
+	if count := countUsers(t, c); count != 20 {
+		t.Errorf("%d rows, want the transaction rolled back", count)
+	}
+	err = c.BulkInsert(context.Background(), append(testUsers(5, 21), testUsers(5, 6)...), BulkOptions{BatchSize: 5})
+	if err == nil {
+		t.Error("BulkInsert succeeded with duplicate keys")
+	}
+	if count := countUsers(t, c); count != 25 {
+		t.Errorf("%d rows, want the chunk before the failure committed", count)
+	}
+	err = c.BulkInsert(context.Background(), testUsers(30, 1), BulkOptions{OnConflictDoNothing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := countUsers(t, c); count != 30 {
+		t.Errorf("%d rows, want the existing ones skipped", count)
+	}
+}
+
+func TestBulkInsertContext(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err := c.BulkInsert(ctx, testUsers(10, 1), BulkOptions{BatchSize: 2, Progress: func(chunksDone, _ int) {
+		if chunksDone == 2 {
+			cancel()
+		}
+	}})
+	if err != context.Canceled {
+		t.Errorf("BulkInsert() = %v, want context.Canceled", err)
+	}
+	if count := countUsers(t, c); count != 4 {
+		t.Errorf("%d rows, want the 2 chunks before the cancellation", count)
+	}
+	if err = New(false, nil).BulkInsert(context.Background(), testUsers(1, 1), BulkOptions{}); err != ErrNotOpened {
+		t.Errorf("BulkInsert() = %v before Open, want ErrNotOpened", err)
+	}
+}
@@ -0,0 +1,33 @@
+// Package clickhouse adds ClickHouse support to dbwrap. It is a separate module so that the clickhouse
+// driver and its dependencies are only pulled in by applications that use it.
+package clickhouse
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/sqos/dbwrap/v2"
+	"gorm.io/driver/clickhouse"
+)
+
+const defaultPort = "9000"
+
+func DSN(host, port, user, password, name string, extra map[string]string) string {
+	if len(port) <= 0 {
+		port = defaultPort
+	}
+	u := url.URL{Scheme: "clickhouse", Host: net.JoinHostPort(host, port), Path: "/" + name}
+	if len(user) > 0 || len(password) > 0 {
+		u.User = url.UserPassword(user, password)
+	}
+	query := url.Values{}
+	for k, v := range extra {
+		query.Set(k, v)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func SetClickhouseParam(mgt *dbwrap.DbMgt, host, port, user, password, name string, extra map[string]string) *dbwrap.DbMgt {
+	return mgt.SetDialector(clickhouse.Open(DSN(host, port, user, password, name, extra)))
+}
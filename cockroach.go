@@ -0,0 +1,72 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCockroachPort = "26257"
+	sqlStateRetry        = "40001"
+)
+
+// SetCockroachParam connects to CockroachDB through the postgres driver. Use TransactionWithRetry for
+// transactions, since CockroachDB asks clients to retry on serialization conflicts far more often than postgres.
+// RunMigrations and DropTables run their steps outside of transactions on CockroachDB.
+func (c *DbMgt) SetCockroachParam(host, port, user, password, name, appName string, ssl bool) *DbMgt {
+	if len(port) <= 0 {
+		port = defaultCockroachPort
+	}
+	p := Config{Driver: driverPostgres, Host: host, Port: port, User: user, Password: password, Name: name, ssl: ssl}
+	if len(appName) > 0 {
+		p.setOption("application_name", appName)
+	}
+	return c.setParam(p)
+}
+
+// IsRetryableError reports whether err is a serialization failure (SQLSTATE 40001) after which the whole
+// transaction should be retried.
+func IsRetryableError(err error) bool {
+	var state interface{ SQLState() string }
+	return errors.As(err, &state) && state.SQLState() == sqlStateRetry
+}
+
+// TransactionWithRetry runs fn in a transaction, running it again from the start as long as it fails with a
+// retryable error, up to maxAttempts times in total (0 means no limit).
+func (c *DbMgt) TransactionWithRetry(ctx context.Context, maxAttempts int, fn func(tx *gorm.DB) error) error {
+	for attempt := 1; ; attempt++ {
+		err := c.Db().WithContext(ctx).Transaction(fn)
+		if err == nil || !IsRetryableError(err) || (maxAttempts > 0 && attempt >= maxAttempts) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 10 * time.Millisecond):
+		}
+	}
+}
+
+// isCockroach reports whether db, opened with the postgres driver, is connected to CockroachDB.
+func isCockroach(db *gorm.DB) bool {
+	if db.Dialector.Name() != driverPostgres {
+		return false
+	}
+	var version string
+	if err := db.Raw("SELECT version()").Row().Scan(&version); err != nil {
+		return false
+	}
+	return strings.Contains(version, "CockroachDB")
+}
+
+func SetCockroachParam(host, port, user, password, name, appName string, ssl bool) *DbMgt {
+	return DefaultDbMgt().SetCockroachParam(host, port, user, password, name, appName, ssl)
+}
+
+func TransactionWithRetry(ctx context.Context, maxAttempts int, fn func(tx *gorm.DB) error) error {
+	return DefaultDbMgt().TransactionWithRetry(ctx, maxAttempts, fn)
+}
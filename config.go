@@ -0,0 +1,173 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// Label identifies the connection among the ones of a config file.
+	Label  string `json:"label,omitempty" yaml:"label,omitempty"`
+	Driver string `json:"driver" yaml:"driver"`
+	// DSN, when set, is passed to the driver as is and the connection fields below are ignored.
+	DSN      string `json:"dsn,omitempty" yaml:"dsn,omitempty"`
+	Host     string `json:"host,omitempty" yaml:"host,omitempty"`
+	Port     string `json:"port,omitempty" yaml:"port,omitempty"`
+	User     string `json:"user,omitempty" yaml:"user,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	// PasswordFile, when set, holds the password and is read on every Open.
+	PasswordFile string `json:"password_file,omitempty" yaml:"password_file,omitempty"`
+	// Name is the database name, or the database file path for sqlite.
+	Name        string            `json:"name,omitempty" yaml:"name,omitempty"`
+	SSLMode     string            `json:"sslmode,omitempty" yaml:"sslmode,omitempty"`
+	SSLRootCert string            `json:"sslrootcert,omitempty" yaml:"sslrootcert,omitempty"`
+	SSLCert     string            `json:"sslcert,omitempty" yaml:"sslcert,omitempty"`
+	SSLKey      string            `json:"sslkey,omitempty" yaml:"sslkey,omitempty"`
+	Charset     string            `json:"charset,omitempty" yaml:"charset,omitempty"`
+	Collation   string            `json:"collation,omitempty" yaml:"collation,omitempty"`
+	Loc         string            `json:"loc,omitempty" yaml:"loc,omitempty"`
+	ParseTime   bool              `json:"parse_time,omitempty" yaml:"parse_time,omitempty"`
+	Options     map[string]string `json:"options,omitempty" yaml:"options,omitempty"`
+	Pragmas     map[string]string `json:"pragmas,omitempty" yaml:"pragmas,omitempty"`
+
+	// ssl is the flag of SetPgParam, used when SSLMode is empty.
+	ssl bool
+	// tlsName is the mysql driver TLS config registered by SetMysqlTLS.
+	tlsName string
+	tlsErr  error
+	// memory marks an in-memory sqlite database, which is lost when its last connection closes.
+	memory bool
+	// tokenProvider supplies Azure AD access tokens to sqlserver instead of a password.
+	tokenProvider func(ctx context.Context) (string, error)
+
+	Debug        bool `json:"debug,omitempty" yaml:"debug,omitempty"`
+	MaxOpenConns int  `json:"max_open_conns,omitempty" yaml:"max_open_conns,omitempty"`
+	MaxIdleConns int  `json:"max_idle_conns,omitempty" yaml:"max_idle_conns,omitempty"`
+	// ConnMaxLifetime and ConnMaxIdleTime are written as durations like "30s" in JSON and YAML config files.
+	ConnMaxLifetime time.Duration `json:"conn_max_lifetime,omitempty" yaml:"conn_max_lifetime,omitempty"`
+	ConnMaxIdleTime time.Duration `json:"conn_max_idle_time,omitempty" yaml:"conn_max_idle_time,omitempty"`
+}
+
+// MultiError lists every problem found, e.g. by Validate.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	msgs := make([]string, 0, len(m))
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m MultiError) errorOrNil() error {
+	if len(m) <= 0 {
+		return nil
+	}
+	return m
+}
+
+func (p *Config) validate() error {
+	if len(p.Driver) <= 0 {
+		return errors.New("dbwrap: no database driver configured")
+	}
+	driver, err := normalizeDriver(p.Driver)
+	if err != nil {
+		return err
+	}
+	p.Driver = driver
+	var errs MultiError
+	if len(p.DSN) <= 0 {
+		if driver == driverSqlite {
+			if len(p.Name) <= 0 {
+				errs = append(errs, errors.New("dbwrap: sqlite requires a database file path in Name"))
+			} else if err = checkSqliteDir(p.Name); err != nil {
+				errs = append(errs, err)
+			}
+		} else if len(p.Host) <= 0 {
+			errs = append(errs, fmt.Errorf("dbwrap: %s requires Host", driver))
+		}
+		if err = p.checkPort(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if driver != driverMysql && (len(p.Charset) > 0 || len(p.Collation) > 0 || len(p.Loc) > 0 || p.ParseTime) {
+		errs = append(errs, fmt.Errorf("dbwrap: Charset, Collation, Loc and ParseTime are only supported by mysql, not %s", driver))
+	}
+	if driver == driverMysql {
+		if err = checkMysqlCollation(p.mysqlCharset(), p.Collation); err != nil {
+			errs = append(errs, err)
+		}
+		if p.tlsErr != nil {
+			errs = append(errs, p.tlsErr)
+		}
+	}
+	if len(p.SSLMode) > 0 || len(p.SSLRootCert) > 0 || len(p.SSLCert) > 0 || len(p.SSLKey) > 0 {
+		if driver != driverPostgres {
+			errs = append(errs, fmt.Errorf("dbwrap: SSL settings are only supported by postgres, not %s", driver))
+		}
+		if len(p.SSLMode) > 0 {
+			if err = checkPgSSLMode(p.SSLMode); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if (len(p.SSLCert) > 0) != (len(p.SSLKey) > 0) {
+			errs = append(errs, errors.New("dbwrap: SSLCert and SSLKey must be set together"))
+		}
+		for _, file := range []string{p.SSLRootCert, p.SSLCert, p.SSLKey} {
+			if err = checkReadable(file); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(p.Pragmas) > 0 {
+		if driver != driverSqlite {
+			errs = append(errs, fmt.Errorf("dbwrap: Pragmas are only supported by sqlite, not %s", driver))
+		}
+		if err = checkSqlitePragmas(p.Pragmas); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if driver == driverPostgres && len(p.DSN) <= 0 {
+		if err = checkPgOptions(p.Options); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err = checkReadable(p.PasswordFile); err != nil {
+		errs = append(errs, err)
+	}
+	if p.MaxOpenConns < 0 || p.MaxIdleConns < 0 || p.ConnMaxLifetime < 0 || p.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("dbwrap: connection pool settings must not be negative"))
+	}
+	return errs.errorOrNil()
+}
+
+func NewFromConfig(cfg Config) (*DbMgt, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	mgt := New(cfg.Debug, nil)
+	mgt.config = cfg.clone()
+	mgt.config.resolvePort()
+	return mgt, nil
+}
+
+func (p *Config) clone() Config {
+	copied := *p
+	copied.Options = copyStringMap(p.Options)
+	copied.Pragmas = copyStringMap(p.Pragmas)
+	return copied
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
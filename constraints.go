@@ -0,0 +1,195 @@
+package dbwrap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// constraintGuesser is implemented by the migrators of every gorm driver, which embed the generic one.
+type constraintGuesser interface {
+	GuessConstraintAndTable(stmt *gorm.Statement, name string) (*schema.Constraint, *schema.Check, string)
+}
+
+// EnsureConstraint creates the constraint name of model unless it exists, name being a check constraint or a
+// foreign key declared in the tags of model, or the field having it. It is safe to call on every start, e.g.
+// from an association func.
+func (c *DbMgt) EnsureConstraint(model interface{}, name string) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	if _, ok := model.(string); ok {
+		return fmt.Errorf("dbwrap: constraint %s needs a model declaring it, not a table name", name)
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err = stmt.Parse(model); err != nil {
+		return err
+	}
+	if guesser, ok := db.Migrator().(constraintGuesser); ok {
+		if constraint, chk, _ := guesser.GuessConstraintAndTable(stmt, name); constraint == nil && chk == nil {
+			return fmt.Errorf("dbwrap: %s declares no constraint %s", stmt.Schema.Name, name)
+		}
+	}
+	if hasConstraint(db, model, name) {
+		return nil
+	}
+	if err = constraintsSupported(db.Dialector.Name()); err != nil {
+		return err
+	}
+	if err = c.echoSQL(db).Migrator().CreateConstraint(model, name); err != nil {
+		return fmt.Errorf("dbwrap: create constraint %s: %w", name, err)
+	}
+	return nil
+}
+
+// DropConstraint drops the constraint name of the table of model if it exists, model being a model or a table
+// name.
+func (c *DbMgt) DropConstraint(model interface{}, name string) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	if _, err = tableOf(db, model); err != nil {
+		return err
+	}
+	if !hasConstraint(db, model, name) {
+		return nil
+	}
+	if err = constraintsSupported(db.Dialector.Name()); err != nil {
+		return err
+	}
+	if err = c.echoSQL(db).Migrator().DropConstraint(model, name); err != nil {
+		return fmt.Errorf("dbwrap: drop constraint %s: %w", name, err)
+	}
+	return nil
+}
+
+// EnsureForeignKey makes field of the table of childModel reference parentField of the one of parentModel
+// unless the constraint, named fk_<child table>_<column>, exists. The models are models or table names and the
+// fields field or column names. onDelete is the referential action, e.g. "CASCADE" or "SET NULL", or empty
+// for the default of the database.
+func (c *DbMgt) EnsureForeignKey(childModel interface{}, field string, parentModel interface{}, parentField string,
+	onDelete string) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	child, err := tableOf(db, childModel)
+	if err != nil {
+		return err
+	}
+	parent, err := tableOf(db, parentModel)
+	if err != nil {
+		return err
+	}
+	if field, err = columnName(db, childModel, field); err != nil {
+		return err
+	}
+	if parentField, err = columnName(db, parentModel, parentField); err != nil {
+		return err
+	}
+	_, table := splitTable(child)
+	name := "fk_" + table + "_" + field
+	stmt := &gorm.Statement{DB: db}
+	create, err := foreignKeySQL(stmt.Quote, child, name, field, parent, parentField, onDelete)
+	if err != nil {
+		return err
+	}
+	switch db.Dialector.Name() {
+	case driverSqlite:
+		// sqlite only has the foreign keys of CREATE TABLE
+		var count int64
+		err = db.Raw("SELECT count(*) FROM pragma_foreign_key_list(?) WHERE \"from\" = ? AND \"table\" = ? "+
+			"AND \"to\" = ?", child, field, parent, parentField).Row().Scan(&count)
+		if err != nil || count > 0 {
+			return err
+		}
+		return fmt.Errorf("dbwrap: sqlite cannot add foreign key %s to the existing table %s", name, child)
+	case driverPostgres, driverMysql, driverSqlServer:
+	default:
+		return fmt.Errorf("dbwrap: EnsureForeignKey does not support %s", db.Dialector.Name())
+	}
+	if db.Migrator().HasConstraint(child, name) {
+		return nil
+	}
+	if err = c.echoSQL(db).Exec(create).Error; err != nil {
+		return fmt.Errorf("dbwrap: create foreign key %s: %w", name, err)
+	}
+	return nil
+}
+
+// hasConstraint is Migrator().HasConstraint, but on sqlite, where it ignores the table and the name the
+// constraint is declared with.
+func hasConstraint(db *gorm.DB, model interface{}, name string) bool {
+	guesser, ok := db.Migrator().(constraintGuesser)
+	if !ok || db.Dialector.Name() != driverSqlite {
+		return db.Migrator().HasConstraint(model, name)
+	}
+	stmt := &gorm.Statement{DB: db}
+	table, ok := model.(string)
+	if !ok {
+		if err := stmt.Parse(model); err != nil {
+			return false
+		}
+		constraint, chk, guessed := guesser.GuessConstraintAndTable(stmt, name)
+		if constraint != nil {
+			name = constraint.Name
+		} else if chk != nil {
+			name = chk.Name
+		}
+		table = guessed
+	}
+	var count int64
+	db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND tbl_name = ? AND (sql LIKE ? OR sql LIKE ? "+
+		"OR sql LIKE ?)", table, `%CONSTRAINT "`+name+`" %`, `%CONSTRAINT `+name+` %`, "%CONSTRAINT `"+name+"`%").
+		Row().Scan(&count)
+	return count > 0
+}
+
+// referentialActions are the ON DELETE actions EnsureForeignKey accepts.
+var referentialActions = map[string]bool{
+	"CASCADE": true, "SET NULL": true, "SET DEFAULT": true, "RESTRICT": true, "NO ACTION": true,
+}
+
+// foreignKeySQL returns the statement adding the foreign key name to table, quoting the identifiers with
+// quote.
+func foreignKeySQL(quote func(interface{}) string, table, name, column, parent, parentColumn, onDelete string) (
+	string, error) {
+	create := "ALTER TABLE " + quote(table) + " ADD CONSTRAINT " + quote(name) + " FOREIGN KEY (" +
+		quote(column) + ") REFERENCES " + quote(parent) + " (" + quote(parentColumn) + ")"
+	if action := strings.ToUpper(strings.Join(strings.Fields(onDelete), " ")); len(action) > 0 {
+		if !referentialActions[action] {
+			return "", fmt.Errorf("dbwrap: unknown ON DELETE action %q", onDelete)
+		}
+		create += " ON DELETE " + action
+	}
+	return create, nil
+}
+
+// constraintsSupported returns an error for the drivers that cannot alter the constraints of a table.
+func constraintsSupported(driver string) error {
+	switch driver {
+	case driverSqlite:
+		return errors.New("dbwrap: sqlite cannot alter the constraints of an existing table")
+	case "clickhouse":
+		return errors.New("dbwrap: clickhouse has no constraints")
+	}
+	return nil
+}
+
+func EnsureConstraint(model interface{}, name string) error {
+	return DefaultDbMgt().EnsureConstraint(model, name)
+}
+
+func DropConstraint(model interface{}, name string) error {
+	return DefaultDbMgt().DropConstraint(model, name)
+}
+
+func EnsureForeignKey(childModel interface{}, field string, parentModel interface{}, parentField string,
+	onDelete string) error {
+	return DefaultDbMgt().EnsureForeignKey(childModel, field, parentModel, parentField, onDelete)
+}
@@ -0,0 +1,96 @@
+package dbwrap
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type testFkAccount struct {
+	ID   uint
+	Name string
+}
+
+type testFkOrder struct {
+	ID              uint
+	TestFkAccountID uint
+	TestFkAccount   testFkAccount `gorm:"constraint:OnDelete:CASCADE"`
+	Price           int           `gorm:"check:chk_orders_price,price >= 0"`
+}
+
+func TestForeignKeySQL(t *testing.T) {
+	// the quoting of the postgres dialector, which needs no connection
+	stmt := &gorm.Statement{DB: &gorm.DB{Config: &gorm.Config{Dialector: postgres.Dialector{}}}}
+	quote := stmt.Quote
+	tests := []struct {
+		onDelete, want string
+	}{
+		{"", `ALTER TABLE "billing"."orders" ADD CONSTRAINT "fk_orders_account_id" FOREIGN KEY ("account_id") ` +
+			`REFERENCES "billing"."accounts" ("id")`},
+		{"cascade", `ALTER TABLE "billing"."orders" ADD CONSTRAINT "fk_orders_account_id" FOREIGN KEY ` +
+			`("account_id") REFERENCES "billing"."accounts" ("id") ON DELETE CASCADE`},
+		{" set   null ", `ALTER TABLE "billing"."orders" ADD CONSTRAINT "fk_orders_account_id" FOREIGN KEY ` +
+			`("account_id") REFERENCES "billing"."accounts" ("id") ON DELETE SET NULL`},
+	}
+	for _, tt := range tests {
+		got, err := foreignKeySQL(quote, "billing.orders", "fk_orders_account_id", "account_id", "billing.accounts",
+			"id", tt.onDelete)
+		if err != nil || got != tt.want {
+			t.Errorf("foreignKeySQL(%q) = %s, %v, want %s", tt.onDelete, got, err, tt.want)
+		}
+	}
+	for _, onDelete := range []string{"DROP", "CASCADE; DROP TABLE x"} {
+		if got, err := foreignKeySQL(quote, "orders", "fk", "a", "accounts", "id", onDelete); err == nil {
+			t.Errorf("foreignKeySQL(%q) = %s, want an error", onDelete, got)
+		}
+	}
+}
+
+func TestEnsureConstraintIdempotent(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.SetSqlite3Pragmas(map[string]string{"foreign_keys": "ON"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// what an association func run on every start does
+	c.RegisterAssociationErrFunc(func(*gorm.DB) error {
+		if err := c.EnsureConstraint(&testFkOrder{}, "chk_orders_price"); err != nil {
+			return err
+		}
+		if err := c.EnsureConstraint(&testFkOrder{}, "TestFkAccount"); err != nil {
+			return err
+		}
+		return c.EnsureForeignKey(&testFkOrder{}, "TestFkAccountID", &testFkAccount{}, "ID", "CASCADE")
+	})
+	c.RegisterModel(&testFkOrder{}, &testFkAccount{})
+	for i := 0; i < 2; i++ {
+		if err := c.Migrate(); err != nil {
+			t.Fatalf("Migrate #%d: %v", i+1, err)
+		}
+	}
+	account := testFkAccount{Name: "a"}
+	if err := c.Db().Create(&account).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Create(&testFkOrder{TestFkAccountID: account.ID, Price: -1}).Error; err == nil {
+		t.Error("the check constraint accepted a negative price")
+	}
+	if err := c.Db().Create(&testFkOrder{TestFkAccountID: account.ID + 1}).Error; err == nil {
+		t.Error("the foreign key accepted a missing account")
+	}
+	if err := c.EnsureConstraint(&testFkOrder{}, "chk_missing"); err == nil {
+		t.Error("EnsureConstraint accepted a constraint the model does not declare")
+	}
+	// sqlite cannot add a foreign key to an existing table
+	if err := c.EnsureForeignKey(&testFkOrder{}, "Price", &testFkAccount{}, "ID", ""); err == nil {
+		t.Error("EnsureForeignKey succeeded without creating the foreign key")
+	}
+	if err := c.DropConstraint(&testFkOrder{}, "chk_missing"); err != nil {
+		t.Errorf("DropConstraint() = %v for a missing constraint, want nothing to do", err)
+	}
+}
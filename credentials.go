@@ -0,0 +1,155 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v4/stdlib"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+)
+
+// SetPasswordFile reads the password from path, e.g. a mounted Kubernetes secret, each time a connection
+// pool is opened, so a rotated password is picked up. It takes precedence over a literal password.
+func (c *DbMgt) SetPasswordFile(path string) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.config.PasswordFile = path
+	return c
+}
+
+func readPasswordFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("dbwrap: read password file: %w", err)
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+	if len(password) <= 0 {
+		return "", fmt.Errorf("dbwrap: password file %s is empty", path)
+	}
+	return password, nil
+}
+
+func (c *DbMgt) resolveCredentials() (Config, error) {
+	cfg := c.config
+	if len(cfg.PasswordFile) > 0 {
+		password, err := readPasswordFile(cfg.PasswordFile)
+		if err != nil {
+			return cfg, err
+		}
+		if len(cfg.Password) > 0 {
+			c.log.Warn(context.Background(), "dbwrap: both a password and a password file are configured, using the file")
+		}
+		cfg.Password = password
+	}
+	return cfg, nil
+}
+
+// CredentialProvider supplies the user and password of every new connection, so rotated credentials are used
+// as soon as they are available, without reopening the pool.
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (user, password string, err error)
+}
+
+type CredentialProviderFunc func(ctx context.Context) (user, password string, err error)
+
+func (f CredentialProviderFunc) Credentials(ctx context.Context) (string, string, error) {
+	return f(ctx)
+}
+
+// MemoryCredentials is a CredentialProvider holding credentials in memory, updated with Set.
+type MemoryCredentials struct {
+	lock     sync.RWMutex
+	user     string
+	password string
+}
+
+func NewMemoryCredentials(user, password string) *MemoryCredentials {
+	return &MemoryCredentials{user: user, password: password}
+}
+
+func (m *MemoryCredentials) Set(user, password string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.user, m.password = user, password
+}
+
+func (m *MemoryCredentials) Credentials(context.Context) (string, string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.user, m.password, nil
+}
+
+func (c *DbMgt) SetCredentialProvider(provider CredentialProvider) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.credentials = provider
+	return c
+}
+
+type credentialConnector struct {
+	cfg      Config
+	provider CredentialProvider
+	driver   driver.Driver
+}
+
+func (cc *credentialConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	user, password, err := cc.provider.Credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dbwrap: get credentials: %w", err)
+	}
+	cfg := cc.cfg
+	cfg.User, cfg.Password = user, password
+	if dc, ok := cc.driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(cfg.dsn())
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return cc.driver.Open(cfg.dsn())
+}
+
+func (cc *credentialConnector) Driver() driver.Driver {
+	return cc.driver
+}
+
+func (p *Config) credentialDialector(provider CredentialProvider) (gorm.Dialector, error) {
+	if err := p.checkPort(); err != nil {
+		return nil, err
+	}
+	cc := &credentialConnector{cfg: *p, provider: provider}
+	switch p.Driver {
+	case driverPostgres:
+		cc.driver = stdlib.GetDefaultDriver()
+		return postgres.New(postgres.Config{Conn: sql.OpenDB(cc)}), nil
+	case driverMysql:
+		if p.tlsErr != nil {
+			return nil, p.tlsErr
+		}
+		cc.driver = &mysqldriver.MySQLDriver{}
+		return mysql.New(mysql.Config{Conn: sql.OpenDB(cc)}), nil
+	case driverSqlServer:
+		cc.driver = &mssql.Driver{}
+		return sqlserver.New(sqlserver.Config{Conn: sql.OpenDB(cc)}), nil
+	default:
+		return nil, fmt.Errorf("dbwrap: credential provider is not supported by %s", p.Driver)
+	}
+}
+
+func SetCredentialProvider(provider CredentialProvider) *DbMgt {
+	return DefaultDbMgt().SetCredentialProvider(provider)
+}
+
+func SetPasswordFile(path string) *DbMgt {
+	return DefaultDbMgt().SetPasswordFile(path)
+}
@@ -0,0 +1,133 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMemoryCredentials(t *testing.T) {
+	m := NewMemoryCredentials("alice", "a")
+	if user, password, err := m.Credentials(context.Background()); user != "alice" || password != "a" || err != nil {
+		t.Errorf("Credentials() = %s, %s, %v", user, password, err)
+	}
+	m.Set("bob", "b")
+	if user, password, err := m.Credentials(context.Background()); user != "bob" || password != "b" || err != nil {
+		t.Errorf("Credentials() after Set = %s, %s, %v", user, password, err)
+	}
+}
+
+func TestCredentialProviderRotation(t *testing.T) {
+	server := newFakePgServer(t, false)
+	creds := NewMemoryCredentials("alice", "a")
+	c := New(false, nil).SetPgParam(server.host(), server.port(), "ignored", "", "app", false)
+	if err := c.SetCredentialProvider(creds).Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	creds.Set("bob", "b")
+	// the pinged connection is idle, a second one must be opened with the new credentials
+	conns := make([]*sql.Conn, 2)
+	for i := range conns {
+		conn, err := c.CommonDB().Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+	if got, want := server.connectedUsers(), []string{"alice", "bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("connected users = %v, want %v", got, want)
+	}
+}
+
+func TestCredentialProviderError(t *testing.T) {
+	server := newFakePgServer(t, false)
+	c := New(false, nil).SetPgParam(server.host(), server.port(), "user", "", "app", false)
+	c.SetCredentialProvider(CredentialProviderFunc(func(context.Context) (string, string, error) {
+		return "", "", errors.New("vault is sealed")
+	}))
+	err := c.Open()
+	if err == nil {
+		c.Close()
+		t.Fatal("Open succeeded without credentials")
+	}
+	if !strings.Contains(err.Error(), "vault is sealed") {
+		t.Errorf("Open() = %v, want the provider error", err)
+	}
+}
+
+func TestCredentialProviderUnsupported(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.SetCredentialProvider(NewMemoryCredentials("user", "")).Open(); err == nil {
+		c.Close()
+		t.Error("Open accepted a credential provider on sqlite")
+	}
+}
+
+func TestPasswordFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(path, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := readPasswordFile(path); password != "s3cret" || err != nil {
+		t.Errorf("readPasswordFile() = %q, %v", password, err)
+	}
+	if err := ioutil.WriteFile(path, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPasswordFile(path); err == nil {
+		t.Error("readPasswordFile accepted an empty file")
+	}
+	if _, err := readPasswordFile(path + ".missing"); err == nil {
+		t.Error("readPasswordFile accepted a missing file")
+	}
+}
+
+func TestPasswordFileOpenReopen(t *testing.T) {
+	server := newFakePgServer(t, false)
+	atomic.StoreInt32(&server.askPassword, 1)
+	path := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	l := &recordLogger{}
+	c := NewWithOptions(WithLogger(l)).SetPgParam(server.host(), server.port(), "user", "literal", "app", false)
+	if err := c.SetPasswordFile(path).Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := ioutil.WriteFile(path, []byte("second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reopen(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := server.connectedPasswords(), []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("connected passwords = %v, want %v", got, want)
+	}
+	var warned int
+	for _, line := range l.Lines() {
+		if strings.Contains(line, "both a password and a password file are configured, using the file") {
+			warned++
+		}
+	}
+	if warned != 2 {
+		t.Errorf("the password file precedence was warned %d times, want once per open: %q", warned, l.Lines())
+	}
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Reopen(context.Background()); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("Reopen() = %v, want the empty password file error", err)
+	}
+	if len(server.connectedPasswords()) != 2 {
+		t.Errorf("connected passwords = %v, want no connection without a password", server.connectedPasswords())
+	}
+}
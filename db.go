@@ -5,34 +5,99 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
-	"os"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"gorm.io/driver/mysql"
-	"gorm.io/driver/postgres"
-	"gorm.io/driver/sqlite"
-	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
-var defaultDb = New(false, nil)
+var (
+	defaultDb     = New(false, nil)
+	defaultDbLock sync.RWMutex
+)
 
 type AssociationFunc func(*gorm.DB) *gorm.DB
 
+// AssociationErrFunc is an AssociationFunc reporting its failure, e.g. the one of SetupJoinTable.
+type AssociationErrFunc func(*gorm.DB) error
+
 type DbMgt struct {
-	debug           bool
-	openFunc        func(dsn string) gorm.Dialector
-	dsn             string
+	// accessed atomically, first for 64-bit alignment
+	counters LifecycleCounters
+
+	debug    int32
+	debugLog logger.Interface
+	// debugDB is the debug session of debugBase, built once instead of on every Db call
+	debugDB         *gorm.DB
+	debugBase       *gorm.DB
+	queryCallbacks  bool
+	metricsSink     atomic.Value // sinkHolder
+	slowQuery       atomic.Value // slowQueryConfig
+	queryCache      bool
+	cacheConfig     atomic.Value // queryCacheConfig
+	cacheNamespace  string
+	limiter         atomic.Value // limiterHolder
+	limiterOn       bool
+	plugins         []gorm.Plugin
+	sampler         poolSampler
+	pressure        *poolConsumer
+	replicas        []string
+	replicaPolicy   ReplicaPolicy
+	replicaProbe    time.Duration
+	replicaFailures int
+	drain           chan struct{}
+	drainBlocking   bool
+	autotuner       *Autotuner
+	config          Config
+	dialector       gorm.Dialector
+	credentials     CredentialProvider
+	dbEncoding      string
+	dbCollation     string
+	pgSchema        string
+	ensureSchema    bool
 	models          []interface{}
-	associationFunc []AssociationFunc
+	modelDeps       map[reflect.Type][]reflect.Type
+	modelOpts       map[reflect.Type]ModelOptions
+	strictMigrate   bool
+	lockTimeout     time.Duration
+	lockNamespace   string
+	associationFunc []AssociationErrFunc
+	migrations      []Migration
+	requireDown     bool
+	seeds           []seed
+	onOpen          []func(db *gorm.DB) error
+	onClose         []func() error
 
-	log  logger.Interface
-	cfg  *gorm.Config
-	db   *gorm.DB
-	lock sync.Mutex
+	retryInterval time.Duration
+	retryMax      int
+	retryHook     RetryHook
+	lazyOpen      *RetryPolicy
+	lazyLock      sync.Mutex
+	migrateLock   sync.Mutex
+	// warmIdle is the idle limit Warmup raised warmPool to.
+	warmPool *sql.DB
+	warmIdle int
+
+	logConnInfo bool
+	serverInfo  *ServerInfo
+	pingTimeout time.Duration
+	health      HealthStatus
+	healthHook  HealthChangeHook
+	keepalives  int
+	watchdog    *Watchdog
+	healthLock  sync.Mutex
+
+	log          logger.Interface
+	eventLog     logger.Interface
+	cfg          *gorm.Config
+	db           *gorm.DB
+	closed       bool
+	stateChanged time.Time
+	lock         sync.Mutex
 }
 
 func (c *DbMgt) SetDbParam(host, port, user, password, name string, ssl bool) *DbMgt {
@@ -40,90 +105,662 @@ func (c *DbMgt) SetDbParam(host, port, user, password, name string, ssl bool) *D
 }
 
 func (c *DbMgt) SetMysqlParam(host, port, user, password, name, charset, loc string, parseTime bool) *DbMgt {
-	if len(charset) <= 0 {
-		charset = "utf8"
+	return c.setParam(Config{Driver: driverMysql, Host: host, Port: port, User: user, Password: password, Name: name,
+		Charset: charset, Loc: loc, ParseTime: parseTime})
+}
+
+func (c *DbMgt) SetMysqlExtraParams(params map[string]string) error {
+	if _, ok := params[""]; ok {
+		return errors.New("dbwrap: empty mysql param name")
 	}
-	if len(loc) <= 0 {
-		loc = "Local"
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverMysql {
+		return errors.New("dbwrap: mysql extra params require the mysql driver")
 	}
-	parsetime := "False"
-	if parseTime {
-		parsetime = "True"
+	for k, v := range params {
+		c.config.setOption(k, v)
 	}
-	c.openFunc = mysql.Open
-	c.dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=%s&parseTime=%s&loc=%s", user, password, host, port, name, charset, parsetime, loc)
-	return c
+	return nil
 }
 
+// SetPgParam connects over a unix domain socket when host is a directory path such as /var/run/postgresql;
+// port then selects the socket file .s.PGSQL.<port> and ssl is ignored since TLS does not apply to sockets.
 func (c *DbMgt) SetPgParam(host, port, user, password, name string, ssl bool) *DbMgt {
-	c.openFunc = postgres.Open
-	c.dsn += "host=" + host
-	if len(port) > 0 {
-		c.dsn += " port=" + port
+	return c.setParam(Config{Driver: driverPostgres, Host: host, Port: port, User: user, Password: password, Name: name,
+		ssl: ssl && !isSocketPath(host)})
+}
+
+func (c *DbMgt) SetPgSocketParam(path, user, password, name string) *DbMgt {
+	return c.SetPgParam(path, "", user, password, name, false)
+}
+
+func (c *DbMgt) SetPgSSLMode(mode string) error {
+	if err := checkPgSSLMode(mode); err != nil {
+		return err
 	}
-	if len(user) > 0 {
-		c.dsn += " user=" + user
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverPostgres {
+		return errors.New("dbwrap: sslmode is only supported by the postgres driver")
 	}
-	if len(password) > 0 {
-		c.dsn += " password=" + password
+	c.config.SSLMode = mode
+	return nil
+}
+
+// SetPgTLS upgrades sslmode to verify-full unless a mode was chosen with SetPgSSLMode.
+func (c *DbMgt) SetPgTLS(rootCert, clientCert, clientKey string) error {
+	if (len(clientCert) > 0) != (len(clientKey) > 0) {
+		return errors.New("dbwrap: postgres client certificate and key must be set together")
 	}
-	if len(name) > 0 {
-		c.dsn += " dbname=" + name
+	for _, file := range []string{rootCert, clientCert, clientKey} {
+		if err := checkReadable(file); err != nil {
+			return err
+		}
 	}
-	if ssl {
-		c.dsn += " sslmode=enable"
-	} else {
-		c.dsn += " sslmode=disable"
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverPostgres {
+		return errors.New("dbwrap: postgres tls requires the postgres driver")
 	}
-	return c
+	c.config.SSLRootCert, c.config.SSLCert, c.config.SSLKey = rootCert, clientCert, clientKey
+	return nil
+}
+
+func (c *DbMgt) SetPgOptions(opts map[string]string) error {
+	if err := checkPgOptions(opts); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverPostgres {
+		return errors.New("dbwrap: postgres options require the postgres driver")
+	}
+	for k, v := range opts {
+		c.config.setOption(k, v)
+	}
+	return nil
 }
 
 func (c *DbMgt) SetSqlite3Param(path string) *DbMgt {
-	c.openFunc, c.dsn = sqlite.Open, path
-	return c
+	return c.setParam(Config{Driver: driverSqlite, Name: path})
 }
 
 func (c *DbMgt) SetSqlServerParam(host, port, user, password, name string) *DbMgt {
-	c.openFunc = sqlserver.Open
-	c.dsn = fmt.Sprintf("sqlserver://%s:%s@%s:%s?database=%s", user, password, host, port, name)
+	return c.setParam(Config{Driver: driverSqlServer, Host: host, Port: port, User: user, Password: password, Name: name})
+}
+
+// SetDialector opens the database with d, for gorm drivers that have no SetXxxParam counterpart.
+func (c *DbMgt) SetDialector(d gorm.Dialector) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dialector = d
+	if c.db == nil && !c.closed {
+		c.stateChanged = time.Now()
+	}
+	return c
+}
+
+func (c *DbMgt) setParam(p Config) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	p.Debug = c.config.Debug
+	p.MaxOpenConns, p.MaxIdleConns, p.ConnMaxLifetime = c.config.MaxOpenConns, c.config.MaxIdleConns, c.config.ConnMaxLifetime
+	p.ConnMaxIdleTime = c.config.ConnMaxIdleTime
+	if len(p.PasswordFile) <= 0 {
+		p.PasswordFile = c.config.PasswordFile
+	}
+	p.resolvePort()
+	c.config = p
+	if c.db == nil && !c.closed {
+		c.stateChanged = time.Now()
+	}
 	return c
 }
 
+// DSN returns the connection string with credentials masked, see UnsafeDSN for the raw one.
+func (c *DbMgt) DSN() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return redactDSN(c.config.Driver, c.config.dsn())
+}
+
+// Config returns a copy of the connection configuration, with default values such as the port resolved.
+func (c *DbMgt) Config() Config {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.config.clone()
+}
+
+// Clone returns an unopened DbMgt with the same configuration, registered models and association funcs,
+// so it can be adjusted, e.g. with another database name, without affecting c.
+// A dialector given to SetDialector is shared, not copied.
+func (c *DbMgt) Clone() *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	clone := &DbMgt{
+		debug:           atomic.LoadInt32(&c.debug),
+		debugLog:        c.debugLog,
+		config:          c.config.clone(),
+		dialector:       c.dialector,
+		credentials:     c.credentials,
+		dbEncoding:      c.dbEncoding,
+		dbCollation:     c.dbCollation,
+		pgSchema:        c.pgSchema,
+		ensureSchema:    c.ensureSchema,
+		models:          append([]interface{}(nil), c.models...),
+		modelDeps:       make(map[reflect.Type][]reflect.Type, len(c.modelDeps)),
+		modelOpts:       make(map[reflect.Type]ModelOptions, len(c.modelOpts)),
+		strictMigrate:   c.strictMigrate,
+		lockTimeout:     c.lockTimeout,
+		lockNamespace:   c.lockNamespace,
+		associationFunc: append([]AssociationErrFunc(nil), c.associationFunc...),
+		migrations:      append([]Migration(nil), c.migrations...),
+		requireDown:     c.requireDown,
+		seeds:           append([]seed(nil), c.seeds...),
+		onOpen:          append([]func(db *gorm.DB) error(nil), c.onOpen...),
+		onClose:         append([]func() error(nil), c.onClose...),
+		retryInterval:   c.retryInterval,
+		retryMax:        c.retryMax,
+		retryHook:       c.retryHook,
+		lazyOpen:        c.lazyOpen,
+		pingTimeout:     c.pingTimeout,
+		logConnInfo:     c.logConnInfo,
+		queryCallbacks:  c.queryCallbacks,
+		queryCache:      c.queryCache,
+		cacheNamespace:  c.cacheNamespace,
+		limiterOn:       c.limiterOn,
+		plugins:         append([]gorm.Plugin(nil), c.plugins...),
+		replicas:        append([]string(nil), c.replicas...),
+		replicaPolicy:   c.replicaPolicy,
+		replicaProbe:    c.replicaProbe,
+		replicaFailures: c.replicaFailures,
+		drainBlocking:   c.drainBlocking,
+		log:             c.log,
+		eventLog:        c.eventLog,
+		stateChanged:    time.Now(),
+	}
+	for t, deps := range c.modelDeps {
+		clone.modelDeps[t] = append([]reflect.Type(nil), deps...)
+	}
+	for t, opts := range c.modelOpts {
+		clone.modelOpts[t] = opts
+	}
+	if c.cfg != nil {
+		cfg := *c.cfg
+		if cfg.Plugins != nil {
+			cfg.Plugins = make(map[string]gorm.Plugin, len(c.cfg.Plugins))
+			for k, v := range c.cfg.Plugins {
+				cfg.Plugins[k] = v
+			}
+		}
+		if cfg.ClauseBuilders != nil {
+			cfg.ClauseBuilders = make(map[string]clause.ClauseBuilder, len(c.cfg.ClauseBuilders))
+			for k, v := range c.cfg.ClauseBuilders {
+				cfg.ClauseBuilders[k] = v
+			}
+		}
+		clone.cfg = &cfg
+	}
+	if holder, ok := c.metricsSink.Load().(sinkHolder); ok {
+		clone.metricsSink.Store(holder)
+	}
+	if slow, ok := c.slowQuery.Load().(slowQueryConfig); ok {
+		clone.slowQuery.Store(slow)
+	}
+	if cache, ok := c.cacheConfig.Load().(queryCacheConfig); ok {
+		clone.cacheConfig.Store(cache)
+	}
+	if holder, ok := c.limiter.Load().(limiterHolder); ok {
+		// the clone gets its own slots, the queries of c do not take them
+		if l := holder.limiter; l != nil {
+			holder.limiter = &concurrencyLimiter{slots: make(chan struct{}, cap(l.slots)), timeout: l.timeout}
+		}
+		clone.limiter.Store(holder)
+	}
+	c.healthLock.Lock()
+	clone.healthHook = c.healthHook
+	c.healthLock.Unlock()
+	return clone
+}
+
+func (c *DbMgt) UnsafeDSN() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.config.dsn()
+}
+
+// Db returns, before Open and after Close, a *gorm.DB whose operations fail with ErrNotOpened, unless
+// EnableLazyOpen was called, while the pool is drained one failing with ErrDraining, and when the lazy open
+// failed one failing with the open error.
 func (c *DbMgt) Db() *gorm.DB {
-	if c.debug {
-		return c.db.Debug()
-	} else {
-		return c.db
+	db, err := c.DbE()
+	if err == ErrNotOpened || err == ErrDraining {
+		return unusable(err)
+	} else if err != nil {
+		return unusable(c.openError(err))
 	}
+	return db
+}
+
+// DbE is Db returning ErrNotOpened, ErrDraining or the error of the lazy open instead of an unusable *gorm.DB.
+func (c *DbMgt) DbE() (*gorm.DB, error) {
+	return c.dbE(true)
+}
+
+// dbE waits for Resume when wait is set and SetDrainBlocking is on.
+func (c *DbMgt) dbE(wait bool) (*gorm.DB, error) {
+	c.lock.Lock()
+	db, lazy, drain, block := c.db, c.lazyOpen, c.drain, c.drainBlocking
+	c.lock.Unlock()
+	if drain != nil {
+		if !wait || !block {
+			return nil, ErrDraining
+		}
+		<-drain
+		return c.dbE(wait)
+	}
+	if db == nil && lazy != nil {
+		var err error
+		if db, err = c.openLazily(*lazy); err != nil {
+			return nil, err
+		}
+	}
+	if db == nil {
+		return nil, ErrNotOpened
+	}
+	if atomic.LoadInt32(&c.debug) != 0 {
+		return c.cachedDebugSession(db), nil
+	}
+	return db, nil
+}
+
+// cachedDebugSession returns the debug session of db, rebuilding it when Reopen replaced the pool.
+func (c *DbMgt) cachedDebugSession(db *gorm.DB) *gorm.DB {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.debugDB == nil || c.debugBase != db {
+		c.debugDB, c.debugBase = c.debugSession(db), db
+	}
+	return c.debugDB
+}
+
+// SetDebug turns the logging of every SQL statement on or off, also while the database is in use.
+func (c *DbMgt) SetDebug(enabled bool) *DbMgt {
+	var debug int32
+	if enabled {
+		debug = 1
+	}
+	atomic.StoreInt32(&c.debug, debug)
+	c.lock.Lock()
+	c.debugDB, c.debugBase = nil, nil
+	c.lock.Unlock()
+	return c
+}
+
+// DebugSession returns a session logging its SQL statements, whether debug is on or not. Like Db, it returns
+// one failing with ErrNotOpened, ErrDraining or the error of the lazy open when there is no database to use.
+func (c *DbMgt) DebugSession() *gorm.DB {
+	db, err := c.DbE()
+	if err == ErrNotOpened || err == ErrDraining {
+		return unusable(err)
+	} else if err != nil {
+		return unusable(c.openError(err))
+	}
+	if atomic.LoadInt32(&c.debug) != 0 {
+		return db
+	}
+	return c.debugSession(db)
+}
+
+func (c *DbMgt) debugSession(db *gorm.DB) *gorm.DB {
+	log := c.debugLog
+	if log == nil {
+		log = db.Logger
+	}
+	// a new statement per chain, so callers sharing the session do not see each other's conditions
+	return db.Session(&gorm.Session{NewDB: true, Logger: log.LogMode(logger.Info)})
 }
 
 func (c *DbMgt) Open() error {
+	return c.OpenContext(context.Background())
+}
+
+// OpenContext opens the database, giving up with ctx.Err() once ctx is done, including during the retries of
+// WithOpenRetry.
+func (c *DbMgt) OpenContext(ctx context.Context) error {
+	for attempt := 0; ; attempt++ {
+		err := c.open(ctx)
+		if err == nil || attempt >= c.retryMax || ctx.Err() != nil {
+			return err
+		}
+		c.log.Error(nil, err.Error())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.retryInterval):
+		}
+	}
+}
+
+// MustOpen is Open panicking with the driver and redacted connection target on failure, for scripts and examples.
+func (c *DbMgt) MustOpen() *DbMgt {
+	if err := c.OpenContext(context.Background()); err != nil {
+		panic(c.openError(err))
+	}
+	return c
+}
+
+// MustDb returns the database, opening it first if needed, and panics like MustOpen when it can not.
+func (c *DbMgt) MustDb() *gorm.DB {
+	db, err := c.DbE()
+	if err == ErrNotOpened {
+		c.MustOpen()
+		db, err = c.DbE()
+	}
+	if err != nil {
+		panic(c.openError(err))
+	}
+	return db
+}
+
+func (c *DbMgt) openError(err error) error {
+	return fmt.Errorf("dbwrap: open %s: %w", c.target(), err)
+}
+
+// DriverName returns "postgres", "mysql", "sqlite", "sqlserver", the name of the dialector given to
+// SetDialector, or "" when nothing is configured yet.
+func (c *DbMgt) DriverName() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.dialector != nil {
+		return c.dialector.Name()
+	}
+	return c.config.Driver
+}
+
+func (c *DbMgt) IsPostgres() bool {
+	return c.DriverName() == driverPostgres
+}
+
+func (c *DbMgt) IsMysql() bool {
+	return c.DriverName() == driverMysql
+}
+
+func (c *DbMgt) IsSqlite() bool {
+	return c.DriverName() == driverSqlite
+}
+
+func (c *DbMgt) IsSqlServer() bool {
+	return c.DriverName() == driverSqlServer
+}
+
+// Validate checks the configuration and reports every problem found, Open calls it before connecting.
+func (c *DbMgt) Validate() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.validate()
+}
+
+func (c *DbMgt) validate() error {
+	if c.dialector != nil {
+		if len(c.config.Driver) > 0 {
+			return errors.New("dbwrap: both a dialector and " + c.config.Driver + " connection parameters are configured")
+		}
+		return nil
+	}
+	if c.credentials != nil && c.config.tokenProvider != nil {
+		return errors.New("dbwrap: both a credential provider and an access token provider are configured")
+	}
+	return c.config.validate()
+}
+
+func (c *DbMgt) getDialector() (gorm.Dialector, error) {
+	if c.dialector != nil {
+		return c.dialector, nil
+	}
+	cfg, err := c.resolveCredentials()
+	if err != nil {
+		return nil, err
+	}
+	if c.credentials != nil {
+		return cfg.credentialDialector(c.credentials)
+	}
+	return cfg.dialector()
+}
+
+func (c *DbMgt) open(ctx context.Context) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	if c.db != nil {
 		return nil
 	}
-	db, err := gorm.Open(c.openFunc(c.dsn), c.cfg)
-	if err == nil {
-		if sqlDB, err := db.DB(); err != nil {
-			return err
-		} else if err = sqlDB.Ping(); err != nil {
-			return err
+	db, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err = c.runOpenHooks(db); err != nil {
+		closeGormDB(db)
+		return err
+	}
+	c.db = db
+	c.setState(true)
+	atomic.AddInt64(&c.counters.Opens, 1)
+	track(c)
+	c.logServerInfo(ctx, db)
+	return nil
+}
+
+// Reopen replaces the connection pool with a new one, e.g. after a proxy restart broke the pooled
+// connections. The old pool is only closed once the new one is up, so it stays in use when Reopen fails.
+func (c *DbMgt) Reopen(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	db, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	old := c.db
+	if old != nil {
+		if err = c.runCloseHooks(); err != nil {
+			c.log.Error(nil, "dbwrap: close hook: %v", err)
+		}
+	}
+	if err = c.runOpenHooks(db); err != nil {
+		closeGormDB(db)
+		if old != nil {
+			// the old pool stays in use, give it back what the close hooks released
+			if err := c.runOpenHooks(old); err != nil {
+				c.log.Error(nil, "dbwrap: open hook: %v", err)
+			}
+		}
+		return err
+	}
+	c.db = db
+	c.setState(true)
+	atomic.AddInt64(&c.counters.Reopens, 1)
+	track(c)
+	c.logServerInfo(ctx, db)
+	if old != nil {
+		if err = closeGormDB(old); err != nil {
+			c.log.Error(nil, "dbwrap: close the replaced connection pool: %v", err)
+		}
+	}
+	return nil
+}
+
+func (c *DbMgt) connect(ctx context.Context) (*gorm.DB, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	dialector, err := c.getDialector()
+	if err != nil {
+		return nil, err
+	}
+	db, err := openGorm(ctx, dialector, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	c.applyConnPool(sqlDB)
+	if err = c.ensurePgSchema(db); err != nil {
+		closeGormDB(db)
+		return nil, err
+	}
+	if err = c.useReplicas(db); err != nil {
+		closeGormDB(db)
+		return nil, err
+	}
+	if err = c.usePlugins(db); err != nil {
+		closeGormDB(db)
+		return nil, err
+	}
+	if c.queryCallbacks {
+		if err = c.installQueryCallbacks(db); err != nil {
+			closeGormDB(db)
+			return nil, err
+		}
+	}
+	if c.queryCache {
+		if err = c.installQueryCache(db); err != nil {
+			closeGormDB(db)
+			return nil, err
+		}
+	}
+	if c.limiterOn {
+		if err = c.installLimiter(db); err != nil {
+			closeGormDB(db)
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+type openResult struct {
+	db  *gorm.DB
+	err error
+}
+
+// openGorm opens and pings the database, giving up as soon as ctx is done. Some drivers dial while gorm
+// initializes without taking a context, so the attempt runs in its own goroutine, which closes the pool
+// if it only succeeds after ctx was done.
+func openGorm(ctx context.Context, dialector gorm.Dialector, cfg *gorm.Config) (*gorm.DB, error) {
+	var config gorm.Config
+	if cfg != nil {
+		config = *cfg
+	}
+	// the ping below honors ctx, unlike the one gorm.Open does
+	config.DisableAutomaticPing = true
+	if config.Plugins != nil {
+		// the plugins registered on this pool, such as the replicas, must not leak into the next one
+		plugins := make(map[string]gorm.Plugin, len(config.Plugins))
+		for k, v := range config.Plugins {
+			plugins[k] = v
+		}
+		config.Plugins = plugins
+	}
+	done := make(chan openResult, 1)
+	go func() {
+		db, err := gorm.Open(dialector, &config)
+		if err == nil {
+			var sqlDB *sql.DB
+			if sqlDB, err = db.DB(); err == nil {
+				if err = sqlDB.PingContext(ctx); err != nil {
+					sqlDB.Close()
+				}
+			}
+		}
+		done <- openResult{db: db, err: err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return r.db, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				if sqlDB, err := r.db.DB(); err == nil {
+					sqlDB.Close()
+				}
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// defaultMaxIdleConns is the database/sql default.
+const defaultMaxIdleConns = 2
+
+// restorePoolLimits undoes the changes of Drain and the autotuner, including the idle connections that
+// lowering the maximum of open connections dropped.
+func (c *DbMgt) restorePoolLimits(sqlDB *sql.DB) {
+	maxOpen := c.config.MaxOpenConns
+	if maxOpen <= 0 && c.config.memory {
+		maxOpen = 1
+	}
+	sqlDB.SetMaxOpenConns(maxOpen)
+	maxIdle := c.config.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = defaultMaxIdleConns
+	}
+	sqlDB.SetMaxIdleConns(maxIdle)
+}
+
+func (c *DbMgt) applyConnPool(sqlDB *sql.DB) {
+	if c.config.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(c.config.MaxOpenConns)
+	} else if c.config.memory {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if c.config.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(c.config.MaxIdleConns)
+	}
+	if c.config.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(c.config.ConnMaxLifetime)
+	}
+	if c.config.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(c.config.ConnMaxIdleTime)
+	}
+}
+
+// SetConnPool sizes the connection pool, 0 keeps the driver default. The settings are applied by Open and
+// Reopen, and right away when the database is already open.
+func (c *DbMgt) SetConnPool(maxOpen, maxIdle int, maxLifetime, maxIdleTime time.Duration) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.config.MaxOpenConns, c.config.MaxIdleConns = maxOpen, maxIdle
+	c.config.ConnMaxLifetime, c.config.ConnMaxIdleTime = maxLifetime, maxIdleTime
+	if c.db != nil {
+		if sqlDB, err := c.db.DB(); err == nil {
+			c.applyConnPool(sqlDB)
+		}
+		if set := replicasOf(c.db); set != nil {
+			for _, sqlDB := range set.pools() {
+				c.applyConnPool(sqlDB)
+			}
 		}
-		c.db = db
 	}
-	return err
+	return c
 }
 
 func (c *DbMgt) close() error {
 	if c.db == nil {
 		return nil
 	}
-	if sqlDb, err := c.db.DB(); err != nil {
+	hookErr := c.runCloseHooks()
+	if err := closeGormDB(c.db); err != nil {
 		return err
-	} else {
-		return sqlDb.Close()
 	}
+	c.db, c.debugDB, c.debugBase = nil, nil, nil
+	c.resume()
+	c.setState(false)
+	untrack(c)
+	return hookErr
 }
 
 func (c *DbMgt) Close() error {
@@ -132,6 +769,46 @@ func (c *DbMgt) Close() error {
 	return c.close()
 }
 
+// ErrCloseTimedOut is returned by CloseGracefully when connections were still in use at the deadline.
+var ErrCloseTimedOut = errors.New("dbwrap: close timed out with connections in use")
+
+// CloseGracefully stops handing out the database, as Close does, but waits for the queries in flight to finish
+// before closing the pool. When ctx is done first, the pool is closed anyway and ErrCloseTimedOut returned.
+func (c *DbMgt) CloseGracefully(ctx context.Context) error {
+	c.lock.Lock()
+	db := c.db
+	if db == nil {
+		c.lock.Unlock()
+		return nil
+	}
+	hookErr := c.runCloseHooks()
+	c.db, c.debugDB, c.debugBase = nil, nil, nil
+	c.resume()
+	c.setState(false)
+	untrack(c)
+	c.lock.Unlock()
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	// connections are closed as soon as they are released
+	sqlDB.SetMaxIdleConns(0)
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	for sqlDB.Stats().InUse > 0 {
+		select {
+		case <-ctx.Done():
+			sqlDB.Close()
+			return ErrCloseTimedOut
+		case <-tick.C:
+		}
+	}
+	if err = sqlDB.Close(); err != nil {
+		return err
+	}
+	return hookErr
+}
+
 func (c *DbMgt) Register(models ...interface{}) *DbMgt {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -139,47 +816,90 @@ func (c *DbMgt) Register(models ...interface{}) *DbMgt {
 	return c
 }
 
+// RegisterAssociationFunc registers funcs to run after the tables are migrated, the Error of the *gorm.DB
+// they return failing the migration.
 func (c *DbMgt) RegisterAssociationFunc(funcs ...AssociationFunc) *DbMgt {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.associationFunc = append(c.associationFunc, funcs...)
+	for _, fc := range funcs {
+		if fc == nil {
+			continue
+		}
+		fc := fc
+		c.associationFunc = append(c.associationFunc, namedAssociationFunc(fc, func(db *gorm.DB) error {
+			if tx := fc(db); tx != nil {
+				return tx.Error
+			}
+			return nil
+		}))
+	}
 	return c
 }
 
-func (c *DbMgt) OpenUntilOk(retryInterval time.Duration) bool {
-	if err := c.Open(); err == nil {
-		return true
-	}
-	for range time.NewTicker(retryInterval).C {
-		if err := c.Open(); err == nil {
-			return true
-		} else {
-			c.log.Error(nil, err.Error())
+// RegisterAssociationErrFunc registers funcs to run after the tables are migrated, in registration order with
+// the ones of RegisterAssociationFunc.
+func (c *DbMgt) RegisterAssociationErrFunc(funcs ...AssociationErrFunc) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, fc := range funcs {
+		if fc != nil {
+			c.associationFunc = append(c.associationFunc, namedAssociationFunc(fc, fc))
 		}
 	}
-	return true
+	return c
 }
 
+// Deprecated: use OpenUntilOkContext, which can be cancelled.
+func (c *DbMgt) OpenUntilOk(retryInterval time.Duration) bool {
+	return c.OpenUntilOkContext(context.Background(), retryInterval) == nil
+}
+
+// OpenUntilOkContext retries Open every retryInterval until it succeeds or ctx is done, in which case the
+// last connection error is returned.
+func (c *DbMgt) OpenUntilOkContext(ctx context.Context, retryInterval time.Duration) error {
+	return c.OpenWithPolicy(ctx, ConstantRetryPolicy(retryInterval, 0))
+}
+
+// OpenWithRetry tries to open the database up to maxAttempts times, 0 meaning until it succeeds, waiting
+// interval between attempts, and returns the last error when every attempt failed.
+func (c *DbMgt) OpenWithRetry(interval time.Duration, maxAttempts int) error {
+	return c.OpenWithPolicy(context.Background(), ConstantRetryPolicy(interval, maxAttempts))
+}
+
+// Deprecated: use Migrate, which returns the error instead of closing the database and panicking.
 func (c *DbMgt) CreateTables(models ...interface{}) *DbMgt {
-	c.models = append(c.models, models...)
-	if err := c.db.AutoMigrate(c.models...); err != nil {
-		c.close()
+	if err := c.Migrate(models...); err != nil {
+		c.Close()
 		panic(err)
 	}
-	for _, fc := range c.associationFunc {
-		if fc != nil {
-			fc(c.db)
-		}
-	}
 	return c
 }
 
+// Deprecated: use OpenUntilOkAndMigrate, which can be cancelled and returns the error instead of panicking.
 func (c *DbMgt) OpenUntilOkAndCreateTables(retryInterval time.Duration, models ...interface{}) *DbMgt {
 	c.OpenUntilOk(retryInterval)
 	c.CreateTables(models...)
 	return c
 }
 
+// OpenWithRetryAndCreateTables is OpenUntilOkAndCreateTables returning the open or migration error instead
+// of retrying forever and panicking.
+func (c *DbMgt) OpenWithRetryAndCreateTables(interval time.Duration, maxAttempts int, models ...interface{}) error {
+	if err := c.OpenWithRetry(interval, maxAttempts); err != nil {
+		return err
+	}
+	return c.Migrate(models...)
+}
+
+// OpenUntilOkAndMigrate is OpenUntilOkAndCreateTables returning the migration error, or the last connection
+// error once ctx is done.
+func (c *DbMgt) OpenUntilOkAndMigrate(ctx context.Context, retryInterval time.Duration, models ...interface{}) error {
+	if err := c.OpenUntilOkContext(ctx, retryInterval); err != nil {
+		return err
+	}
+	return c.MigrateContext(ctx, models...)
+}
+
 func (c *DbMgt) DropTableIfExists(models ...interface{}) *DbMgt {
 	if err := c.Db().Migrator().DropTable(models...); err != nil && c.log != nil {
 		c.log.Error(nil, err.Error())
@@ -187,127 +907,246 @@ func (c *DbMgt) DropTableIfExists(models ...interface{}) *DbMgt {
 	return c
 }
 
+// OpenUntilOkAndDropTableIfExistsThenCreateTables closes the database and panics when dropping or creating the
+// tables fails, as CreateTables does.
 func (c *DbMgt) OpenUntilOkAndDropTableIfExistsThenCreateTables(retryInterval time.Duration, models ...interface{}) *DbMgt {
 	c.OpenUntilOk(retryInterval)
-	c.DropTableIfExists(models...).CreateTables(models...)
-	return c
+	if err := c.dropTables(context.Background(), false, models); err != nil {
+		c.Close()
+		panic(err)
+	}
+	// the models are created again with the dependencies and options they were registered with
+	c.unregisterModels(models, false)
+	return c.CreateTables(models...)
 }
 
+// CommonDB returns nil when the database is not open, see CommonDBE for the reason.
 func (c *DbMgt) CommonDB() *sql.DB {
-	if db, err := c.Db().DB(); err == nil {
+	if db, err := c.CommonDBE(); err == nil {
 		return db
 	} else {
 		return nil
 	}
 }
 
-func (c *DbMgt) Keepalive(ctx context.Context, interval time.Duration) {
-	tick := time.NewTicker(interval)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-tick.C:
-			if db := c.CommonDB(); db != nil {
-				if err := db.Ping(); err != nil && c.log != nil {
-					c.log.Error(nil, err.Error())
-				}
-			}
-			break
-		}
+func (c *DbMgt) CommonDBE() (*sql.DB, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return nil, err
 	}
+	return db.DB()
 }
 
 func DefaultDbMgt() *DbMgt {
+	defaultDbLock.RLock()
+	defer defaultDbLock.RUnlock()
 	return defaultDb
 }
 
+// SetDefault makes the package level functions use mgt and returns the previous default instance, which
+// is left open: closing it is up to the caller.
+func SetDefault(mgt *DbMgt) *DbMgt {
+	if mgt == nil {
+		panic("dbwrap: SetDefault with a nil DbMgt")
+	}
+	defaultDbLock.Lock()
+	defer defaultDbLock.Unlock()
+	previous := defaultDb
+	defaultDb = mgt
+	return previous
+}
+
 func SetDbParam(host, port, user, password, name string, ssl bool) *DbMgt {
-	return defaultDb.SetDbParam(host, port, user, password, name, ssl)
+	return DefaultDbMgt().SetDbParam(host, port, user, password, name, ssl)
 }
 
 func SetMysqlParam(host, port, user, password, name, charset, loc string, parseTime bool) *DbMgt {
-	return defaultDb.SetMysqlParam(host, port, user, password, name, charset, loc, parseTime)
+	return DefaultDbMgt().SetMysqlParam(host, port, user, password, name, charset, loc, parseTime)
+}
+
+func SetMysqlExtraParams(params map[string]string) error {
+	return DefaultDbMgt().SetMysqlExtraParams(params)
 }
 
 func SetPgParam(host, port, user, password, name string, ssl bool) *DbMgt {
-	return defaultDb.SetPgParam(host, port, user, password, name, ssl)
+	return DefaultDbMgt().SetPgParam(host, port, user, password, name, ssl)
+}
+
+func SetPgSocketParam(path, user, password, name string) *DbMgt {
+	return DefaultDbMgt().SetPgSocketParam(path, user, password, name)
+}
+
+func SetPgSSLMode(mode string) error {
+	return DefaultDbMgt().SetPgSSLMode(mode)
+}
+
+func SetPgTLS(rootCert, clientCert, clientKey string) error {
+	return DefaultDbMgt().SetPgTLS(rootCert, clientCert, clientKey)
+}
+
+func SetPgOptions(opts map[string]string) error {
+	return DefaultDbMgt().SetPgOptions(opts)
+}
+
+func SetConnPool(maxOpen, maxIdle int, maxLifetime, maxIdleTime time.Duration) *DbMgt {
+	return DefaultDbMgt().SetConnPool(maxOpen, maxIdle, maxLifetime, maxIdleTime)
 }
 
 func SetSqlite3Param(path string) *DbMgt {
-	return defaultDb.SetSqlite3Param(path)
+	return DefaultDbMgt().SetSqlite3Param(path)
 }
 
 func SetSqlServerParam(host, port, user, password, name string) *DbMgt {
-	return defaultDb.SetSqlServerParam(host, port, user, password, name)
+	return DefaultDbMgt().SetSqlServerParam(host, port, user, password, name)
+}
+
+func SetDialector(d gorm.Dialector) *DbMgt {
+	return DefaultDbMgt().SetDialector(d)
+}
+
+func DSN() string {
+	return DefaultDbMgt().DSN()
+}
+
+func DriverName() string {
+	return DefaultDbMgt().DriverName()
+}
+
+func Validate() error {
+	return DefaultDbMgt().Validate()
+}
+
+func UnsafeDSN() string {
+	return DefaultDbMgt().UnsafeDSN()
 }
 
 func Db() *gorm.DB {
-	return defaultDb.Db()
+	return DefaultDbMgt().Db()
 }
 
 func Open() (err error) {
-	return defaultDb.Open()
+	return DefaultDbMgt().Open()
+}
+
+func MustOpen() *DbMgt {
+	return DefaultDbMgt().MustOpen()
+}
+
+func MustDb() *gorm.DB {
+	return DefaultDbMgt().MustDb()
+}
+
+func OpenContext(ctx context.Context) error {
+	return DefaultDbMgt().OpenContext(ctx)
+}
+
+func Reopen(ctx context.Context) error {
+	return DefaultDbMgt().Reopen(ctx)
 }
 
 func Close() error {
-	return defaultDb.Close()
+	return DefaultDbMgt().Close()
+}
+
+func CloseGracefully(ctx context.Context) error {
+	return DefaultDbMgt().CloseGracefully(ctx)
 }
 
 func Register(models ...interface{}) *DbMgt {
-	return defaultDb.Register(models...)
+	return DefaultDbMgt().Register(models...)
 }
 
 func RegisterAssociationFunc(funcs ...AssociationFunc) *DbMgt {
-	return defaultDb.RegisterAssociationFunc(funcs...)
+	return DefaultDbMgt().RegisterAssociationFunc(funcs...)
+}
+
+func RegisterAssociationErrFunc(funcs ...AssociationErrFunc) *DbMgt {
+	return DefaultDbMgt().RegisterAssociationErrFunc(funcs...)
 }
 
 func OpenUntilOk(retryInterval time.Duration) bool {
-	return defaultDb.OpenUntilOk(retryInterval)
+	return DefaultDbMgt().OpenUntilOk(retryInterval)
+}
+
+func OpenUntilOkContext(ctx context.Context, retryInterval time.Duration) error {
+	return DefaultDbMgt().OpenUntilOkContext(ctx, retryInterval)
 }
 
 func CreateTables(models ...interface{}) *DbMgt {
-	return defaultDb.CreateTables(models...)
+	return DefaultDbMgt().CreateTables(models...)
 }
 
 func OpenUntilOkAndCreateTables(retryInterval time.Duration, models ...interface{}) *DbMgt {
-	return defaultDb.OpenUntilOkAndCreateTables(retryInterval, models...)
+	return DefaultDbMgt().OpenUntilOkAndCreateTables(retryInterval, models...)
+}
+
+func OpenWithRetry(interval time.Duration, maxAttempts int) error {
+	return DefaultDbMgt().OpenWithRetry(interval, maxAttempts)
+}
+
+func OpenUntilOkAndMigrate(ctx context.Context, retryInterval time.Duration, models ...interface{}) error {
+	return DefaultDbMgt().OpenUntilOkAndMigrate(ctx, retryInterval, models...)
+}
+
+func OpenWithRetryAndCreateTables(interval time.Duration, maxAttempts int, models ...interface{}) error {
+	return DefaultDbMgt().OpenWithRetryAndCreateTables(interval, maxAttempts, models...)
 }
 
 func OpenUntilOkAndDropTableIfExistsThenCreateTables(retryInterval time.Duration, models ...interface{}) *DbMgt {
-	return defaultDb.OpenUntilOkAndDropTableIfExistsThenCreateTables(retryInterval, models...)
+	return DefaultDbMgt().OpenUntilOkAndDropTableIfExistsThenCreateTables(retryInterval, models...)
 }
 
 func IsRecordNotFoundError(err error) bool {
 	return errors.Is(err, gorm.ErrRecordNotFound)
 }
 
+func SetDebug(enabled bool) *DbMgt {
+	return DefaultDbMgt().SetDebug(enabled)
+}
+
+func DebugSession() *gorm.DB {
+	return DefaultDbMgt().DebugSession()
+}
+
+func DbE() (*gorm.DB, error) {
+	return DefaultDbMgt().DbE()
+}
+
+func CommonDBE() (*sql.DB, error) {
+	return DefaultDbMgt().CommonDBE()
+}
+
 func CommonDB() *sql.DB {
-	return defaultDb.CommonDB()
+	return DefaultDbMgt().CommonDB()
 }
 
 func Keepalive(ctx context.Context, interval time.Duration) {
-	defaultDb.Keepalive(ctx, interval)
+	DefaultDbMgt().Keepalive(ctx, interval)
+}
+
+// SetEventLogger replaces the logger of the connection info, pool statistics and autotune lines, which are
+// logged at Info level, by default to stderr or to the logger of WithLogger.
+func (c *DbMgt) SetEventLogger(l logger.Interface) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.eventLog = l
+	return c
+}
+
+func (c *DbMgt) events() logger.Interface {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.eventLog
 }
 
 func New(debug bool, cfg *gorm.Config) *DbMgt {
-	mgt := &DbMgt{debug: debug, cfg: cfg}
-	if mgt.cfg == nil {
-		mgt.cfg = &gorm.Config{
-			PrepareStmt: true,
-		}
-	}
-	mgt.log = logger.Default
+	opts := []Option{WithGormConfig(cfg)}
 	if debug {
-		logger.Default = logger.New(
-			log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile),
-			logger.Config{SlowThreshold: 200 * time.Millisecond, LogLevel: logger.Warn, Colorful: true},
-		)
-		if mgt.cfg.Logger == nil {
-			mgt.cfg.Logger = logger.Default
-		}
-	} else {
-		logger.Default = logger.Discard
+		opts = append(opts, WithDebug())
 	}
-	return mgt
+	return NewWithOptions(opts...)
+}
+
+func SetEventLogger(l logger.Interface) *DbMgt {
+	return DefaultDbMgt().SetEventLogger(l)
 }
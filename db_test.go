@@ -0,0 +1,486 @@
+package dbwrap
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestDriverName(t *testing.T) {
+	tests := []struct {
+		c    *DbMgt
+		want string
+	}{
+		{New(false, nil), ""},
+		{New(false, nil).SetPgParam("db.local", "", "user", "", "app", false), "postgres"},
+		{New(false, nil).SetMysqlParam("db.local", "", "user", "", "app", "", "", false), "mysql"},
+		{New(false, nil).SetSqlite3Param("app.db"), "sqlite"},
+		{New(false, nil).SetSqlServerParam("db.local", "", "user", "", "app"), "sqlserver"},
+		{New(false, nil).SetDialector(sqlite.Open("app.db")), "sqlite"},
+	}
+	for _, tt := range tests {
+		if got := tt.c.DriverName(); got != tt.want {
+			t.Errorf("DriverName() = %q, want %q", got, tt.want)
+		}
+		checks := map[string]bool{"postgres": tt.c.IsPostgres(), "mysql": tt.c.IsMysql(), "sqlite": tt.c.IsSqlite(),
+			"sqlserver": tt.c.IsSqlServer()}
+		for driver, is := range checks {
+			if is != (driver == tt.want) {
+				t.Errorf("driver %q: Is%s() = %v", tt.want, driver, is)
+			}
+		}
+	}
+}
+
+func TestDriverNameAfterOpen(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.DriverName(); got != "sqlite" || !c.IsSqlite() {
+		t.Errorf("open: DriverName() = %q", got)
+	}
+	if got := c.Db().Dialector.Name(); got != c.DriverName() {
+		t.Errorf("the dialector is %q, DriverName() %q", got, c.DriverName())
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.DriverName(); got != "sqlite" {
+		t.Errorf("closed: DriverName() = %q", got)
+	}
+}
+
+type testOrder struct {
+	ID     uint
+	UserID uint
+}
+
+func TestCloneIsolation(t *testing.T) {
+	c := New(false, nil).SetPgParam("db.local", "", "user", "secret", "app", false)
+	if err := c.SetPgOptions(map[string]string{"application_name": "api"}); err != nil {
+		t.Fatal(err)
+	}
+	c.Register(&testUser{})
+	clone := c.Clone()
+	if clone.UnsafeDSN() != c.UnsafeDSN() {
+		t.Fatalf("clone DSN %q, want %q", clone.UnsafeDSN(), c.UnsafeDSN())
+	}
+	if err := clone.SetPgOptions(map[string]string{"application_name": "worker"}); err != nil {
+		t.Fatal(err)
+	}
+	clone.Register(&testOrder{})
+	if err := clone.SetSkipDefaultTransaction(true); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Config().Options["application_name"]; got != "api" {
+		t.Errorf("application_name = %q after changing the clone, want api", got)
+	}
+	if len(c.models) != 1 || len(clone.models) != 2 {
+		t.Errorf("%d models, %d in the clone, want 1 and 2", len(c.models), len(clone.models))
+	}
+	if c.cfg.SkipDefaultTransaction {
+		t.Error("changing the gorm config of the clone changed the original")
+	}
+	clone.SetSqlite3Param("clone.db")
+	if c.DriverName() != "postgres" {
+		t.Errorf("DriverName() = %q after changing the clone, want postgres", c.DriverName())
+	}
+}
+
+func TestCloneOpensItsOwnPool(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	clone := c.Clone()
+	if clone.IsOpen() {
+		t.Fatal("the clone is open")
+	}
+	if err := clone.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if clone.CommonDB() == c.CommonDB() {
+		t.Fatal("the clone shares the connection pool")
+	}
+	if err := clone.Db().Create(&testUser{Name: "from clone"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := clone.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := c.Db().Model(&testUser{}).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("count after closing the clone = %d, %v, want 1", count, err)
+	}
+}
+
+func TestCloseAndReopen(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Create(&testUser{Name: "first"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	first := c.CommonDB()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Find(&[]testUser{}).Error; !errors.Is(err, ErrNotOpened) {
+		t.Errorf("Find after Close = %v, want ErrNotOpened", err)
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.CommonDB() == first {
+		t.Error("Open reused the closed pool")
+	}
+	var users []testUser
+	if err := c.Db().Find(&users).Error; err != nil || len(users) != 1 {
+		t.Errorf("Find after reopening = %v, %v, want the first user", users, err)
+	}
+}
+
+// slowQuery runs a query lasting d on c in the background and waits for it to hold a connection.
+func slowQuery(t *testing.T, c *DbMgt, d time.Duration) <-chan error {
+	t.Helper()
+	sqlDB := c.CommonDB()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Db().Exec("SELECT sleep(?)", d.Milliseconds()).Error
+	}()
+	for deadline := time.Now().Add(time.Second); sqlDB.Stats().InUse <= 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the slow query did not start")
+		}
+	}
+	return done
+}
+
+func TestCloseGracefullyWaits(t *testing.T) {
+	c := openSqliteSleep(t)
+	done := slowQuery(t, c, 200*time.Millisecond)
+	start := time.Now()
+	if err := c.CloseGracefully(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("CloseGracefully returned after %s, before the query finished", elapsed)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("the query in flight failed: %v", err)
+	}
+	if state, _ := c.State(); state != StateClosed {
+		t.Errorf("state = %s, want closed", state)
+	}
+}
+
+func TestCloseGracefullyTimeout(t *testing.T) {
+	c := openSqliteSleep(t)
+	done := slowQuery(t, c, 500*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.CloseGracefully(ctx); err != ErrCloseTimedOut {
+		t.Errorf("CloseGracefully() = %v, want ErrCloseTimedOut", err)
+	}
+	<-done
+}
+
+func TestCloseGracefullyNeverOpened(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param("test.db")
+	_, changed := c.State()
+	if err := c.CloseGracefully(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if state, at := c.State(); state != StateConfigured || !at.Equal(changed) {
+		t.Errorf("state = %s since %s, want configured since %s", state, at, changed)
+	}
+}
+
+func TestNotOpened(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		c := New(debug, nil).SetSqlite3Param("test.db")
+		var users []testUser
+		if err := c.Db().Where("name = ?", "a").Find(&users).Error; !errors.Is(err, ErrNotOpened) {
+			t.Errorf("debug %v: Find() = %v, want ErrNotOpened", debug, err)
+		}
+		if err := c.Db().Create(&testUser{Name: "a"}).Error; !errors.Is(err, ErrNotOpened) {
+			t.Errorf("debug %v: Create() = %v, want ErrNotOpened", debug, err)
+		}
+		if db, err := c.DbE(); db != nil || err != ErrNotOpened {
+			t.Errorf("debug %v: DbE() = %v, %v, want ErrNotOpened", debug, db, err)
+		}
+		if db, err := c.CommonDBE(); db != nil || err != ErrNotOpened {
+			t.Errorf("debug %v: CommonDBE() = %v, %v, want ErrNotOpened", debug, db, err)
+		}
+		if c.CommonDB() != nil {
+			t.Errorf("debug %v: CommonDB() is not nil", debug)
+		}
+	}
+}
+
+// panicked returns what fn panicked with, nil when it returned.
+func panicked(fn func()) (r interface{}) {
+	defer func() {
+		r = recover()
+	}()
+	fn()
+	return nil
+}
+
+func TestMustOpen(t *testing.T) {
+	c := New(false, nil).SetPgParam("127.0.0.1", refusedPort(t), "user", "s3cret", "app", false)
+	r := panicked(func() {
+		c.MustOpen()
+	})
+	err, ok := r.(error)
+	if !ok {
+		t.Fatalf("MustOpen panicked with %v, want an error", r)
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "dbwrap: open postgres host=127.0.0.1 ") || !strings.Contains(msg, "dbname=app") {
+		t.Errorf("MustOpen panic %q does not name the driver and target", msg)
+	}
+	if strings.Contains(msg, "s3cret") {
+		t.Errorf("MustOpen panic %q leaks the password", msg)
+	}
+	if errors.Unwrap(err) == nil {
+		t.Errorf("MustOpen panic %q does not wrap the open error", msg)
+	}
+	if r = panicked(func() {
+		c.MustDb()
+	}); r == nil {
+		t.Error("MustDb did not panic")
+	}
+}
+
+func TestMustDb(t *testing.T) {
+	prev := SetDefault(New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db")))
+	defer SetDefault(prev)
+	defer Close()
+	var db *gorm.DB
+	if r := panicked(func() {
+		db = MustDb()
+	}); r != nil {
+		t.Fatalf("MustDb panicked with %v", r)
+	}
+	if !IsOpen() {
+		t.Error("MustDb did not open the database")
+	}
+	if err := db.Exec("SELECT 1").Error; err != nil {
+		t.Error(err)
+	}
+	if r := panicked(func() {
+		MustOpen()
+	}); r != nil {
+		t.Errorf("MustOpen panicked with %v on an open database", r)
+	}
+}
+
+// bufferLogger returns a gorm logger writing to buf at Warn level, as the stderr logger of debug mode does.
+func bufferLogger(buf *bytes.Buffer) logger.Interface {
+	return logger.New(log.New(buf, "", 0), logger.Config{LogLevel: logger.Warn})
+}
+
+func TestSetDebug(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewWithOptions(WithLogger(bufferLogger(&buf))).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, step := range []struct {
+		debug  bool
+		query  string
+		logged bool
+	}{
+		{false, "SELECT 1", false},
+		{true, "SELECT 2", true},
+		{true, "SELECT 3", true},
+		{false, "SELECT 4", false},
+	} {
+		c.SetDebug(step.debug)
+		buf.Reset()
+		if err := c.Db().Exec(step.query).Error; err != nil {
+			t.Fatal(err)
+		}
+		if logged := strings.Contains(buf.String(), step.query); logged != step.logged {
+			t.Errorf("debug %v: %s logged %v, want %v", step.debug, step.query, logged, step.logged)
+		}
+	}
+}
+
+func TestDebugSession(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewWithOptions(WithLogger(bufferLogger(&buf))).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	session := c.DebugSession()
+	if err := session.Exec("SELECT 1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "SELECT 1") {
+		t.Errorf("the debug session did not log its statement: %q", buf.String())
+	}
+	buf.Reset()
+	if err := c.Db().Exec("SELECT 2").Error; err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("Db logged %q with debug off", buf.String())
+	}
+	// the session does not keep the conditions of a previous chain
+	if err := session.Migrator().CreateTable(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	session.Where("name = ?", "a").Find(&[]testUser{})
+	buf.Reset()
+	session.Find(&[]testUser{})
+	if strings.Contains(buf.String(), "name =") {
+		t.Errorf("the session kept a condition: %q", buf.String())
+	}
+	if err := New(false, nil).DebugSession().Exec("SELECT 1").Error; err != ErrNotOpened {
+		t.Errorf("DebugSession() before Open fails with %v, want ErrNotOpened", err)
+	}
+}
+
+// holdConns takes n connections of c at once and releases them.
+func holdConns(t *testing.T, c *DbMgt, n int) {
+	t.Helper()
+	conns := make([]*sql.Conn, n)
+	for i := range conns {
+		var err error
+		if conns[i], err = c.CommonDB().Conn(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func TestSetConnPool(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db")).
+		SetConnPool(7, 2, time.Minute, time.Minute)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if max := c.CommonDB().Stats().MaxOpenConnections; max != 7 {
+		t.Errorf("MaxOpenConnections = %d after Open, want 7", max)
+	}
+	holdConns(t, c, 5)
+	if stats := c.CommonDB().Stats(); stats.Idle != 2 || stats.MaxIdleClosed != 3 {
+		t.Errorf("%d idle connections, %d closed, want 2 kept", stats.Idle, stats.MaxIdleClosed)
+	}
+	if err := c.Reopen(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if max := c.CommonDB().Stats().MaxOpenConnections; max != 7 {
+		t.Errorf("MaxOpenConnections = %d after Reopen, want 7", max)
+	}
+	c.SetConnPool(3, 0, 0, 0)
+	if max := c.CommonDB().Stats().MaxOpenConnections; max != 3 {
+		t.Errorf("MaxOpenConnections = %d once changed, want 3", max)
+	}
+}
+
+func TestSetConnPoolDefaults(t *testing.T) {
+	prev := SetDefault(New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db")))
+	defer SetDefault(prev)
+	SetConnPool(0, 0, 0, 0)
+	if err := Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+	if max := CommonDB().Stats().MaxOpenConnections; max != 0 {
+		t.Errorf("MaxOpenConnections = %d, want the unlimited default", max)
+	}
+	SetConnPool(4, 0, 0, 0)
+	if max := CommonDB().Stats().MaxOpenConnections; max != 4 {
+		t.Errorf("MaxOpenConnections = %d, want 4", max)
+	}
+}
+
+func TestDebugSessionCache(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewWithOptions(WithDebug(), WithLogger(bufferLogger(&buf))).
+		SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	db := c.Db()
+	if c.Db() != db {
+		t.Error("Db allocated a new debug session")
+	}
+	db.Where("name = ?", "a").Find(&[]testUser{})
+	buf.Reset()
+	c.Db().Find(&[]testUser{})
+	if !strings.Contains(buf.String(), "SELECT * FROM `test_users`") || strings.Contains(buf.String(), "name =") {
+		t.Errorf("logged %q, want the statement without the condition of the previous chain", buf.String())
+	}
+	if err := c.Reopen(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Db() == db {
+		t.Error("Reopen kept the debug session of the closed pool")
+	}
+	db = c.Db()
+	if c.SetDebug(true); c.Db() == db {
+		t.Error("SetDebug kept the debug session")
+	}
+}
+
+func BenchmarkDb(b *testing.B) {
+	for _, debug := range []bool{false, true} {
+		b.Run(fmt.Sprintf("debug=%v", debug), func(b *testing.B) {
+			c := New(debug, nil).SetSqlite3Param(filepath.Join(b.TempDir(), "test.db"))
+			if err := c.Open(); err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				c.Db()
+			}
+		})
+	}
+}
+
+// BenchmarkGormDebug is what Db did before caching its debug session, for comparison with BenchmarkDb.
+func BenchmarkGormDebug(b *testing.B) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(b.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+	db := c.Db()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Debug()
+	}
+}
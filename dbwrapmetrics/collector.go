@@ -0,0 +1,71 @@
+// Package dbwrapmetrics exports the connection pool statistics and lifecycle counters of a dbwrap.DbMgt to
+// Prometheus. It is a separate module so that the Prometheus client is only pulled in by applications using it:
+//
+//	prometheus.MustRegister(dbwrapmetrics.NewCollector(orders, prometheus.Labels{"db": "orders"}))
+//	prometheus.MustRegister(dbwrapmetrics.NewCollector(users, prometheus.Labels{"db": "users"}))
+//	http.Handle("/metrics", promhttp.Handler())
+//
+// Each instance needs its own labels, registering two collectors with the same labels fails.
+package dbwrapmetrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sqos/dbwrap/v2"
+)
+
+const namespace = "dbwrap"
+
+type collector struct {
+	mgt *dbwrap.DbMgt
+
+	maxOpen      *prometheus.Desc
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+	opens        *prometheus.Desc
+	reopens      *prometheus.Desc
+	pingFailures *prometheus.Desc
+}
+
+// NewCollector reports the metrics of mgt with labels as constant labels.
+func NewCollector(mgt *dbwrap.DbMgt, labels prometheus.Labels) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, labels)
+	}
+	return &collector{
+		mgt:          mgt,
+		maxOpen:      desc("max_open_connections", "Maximum number of open connections to the database."),
+		open:         desc("open_connections", "Number of established connections, in use and idle."),
+		inUse:        desc("in_use_connections", "Number of connections in use."),
+		idle:         desc("idle_connections", "Number of idle connections."),
+		waitCount:    desc("wait_count_total", "Number of connections waited for."),
+		waitDuration: desc("wait_duration_seconds_total", "Time blocked waiting for a new connection."),
+		opens:        desc("opens_total", "Number of connection pools opened by Open."),
+		reopens:      desc("reopens_total", "Number of connection pools replaced by Reopen."),
+		pingFailures: desc("ping_failures_total", "Number of failed keepalive and watchdog pings."),
+	}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.maxOpen, c.open, c.inUse, c.idle, c.waitCount, c.waitDuration,
+		c.opens, c.reopens, c.pingFailures} {
+		ch <- d
+	}
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	// the pool statistics are zero while the database is not open
+	stats, _ := c.mgt.PoolStats()
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	counters := c.mgt.Counters()
+	ch <- prometheus.MustNewConstMetric(c.opens, prometheus.CounterValue, float64(counters.Opens))
+	ch <- prometheus.MustNewConstMetric(c.reopens, prometheus.CounterValue, float64(counters.Reopens))
+	ch <- prometheus.MustNewConstMetric(c.pingFailures, prometheus.CounterValue, float64(counters.PingFailures))
+}
@@ -0,0 +1,91 @@
+package dbwrapmetrics
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sqos/dbwrap/v2"
+)
+
+func openSqlite(t *testing.T) *dbwrap.DbMgt {
+	t.Helper()
+	mgt := dbwrap.New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db")).SetConnPool(5, 0, 0, 0)
+	if err := mgt.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		mgt.Close()
+	})
+	return mgt
+}
+
+func TestCollector(t *testing.T) {
+	mgt := openSqlite(t)
+	if err := mgt.Reopen(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := mgt.CommonDB().Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := NewCollector(mgt, prometheus.Labels{"db": "orders"})
+	if n := testutil.CollectAndCount(c); n != 9 {
+		t.Errorf("%d metrics collected, want 9", n)
+	}
+	expected := `
+# HELP dbwrap_in_use_connections Number of connections in use.
+# TYPE dbwrap_in_use_connections gauge
+dbwrap_in_use_connections{db="orders"} 1
+# HELP dbwrap_max_open_connections Maximum number of open connections to the database.
+# TYPE dbwrap_max_open_connections gauge
+dbwrap_max_open_connections{db="orders"} 5
+# HELP dbwrap_opens_total Number of connection pools opened by Open.
+# TYPE dbwrap_opens_total counter
+dbwrap_opens_total{db="orders"} 1
+# HELP dbwrap_reopens_total Number of connection pools replaced by Reopen.
+# TYPE dbwrap_reopens_total counter
+dbwrap_reopens_total{db="orders"} 1
+`
+	err = testutil.CollectAndCompare(c, strings.NewReader(expected), "dbwrap_in_use_connections",
+		"dbwrap_max_open_connections", "dbwrap_opens_total", "dbwrap_reopens_total")
+	if err != nil {
+		t.Error(err)
+	}
+	if problems, err := testutil.CollectAndLint(c); err != nil || len(problems) > 0 {
+		t.Errorf("lint: %v, %v", problems, err)
+	}
+}
+
+func TestCollectorNotOpen(t *testing.T) {
+	c := NewCollector(dbwrap.New(false, nil), nil)
+	expected := `
+# HELP dbwrap_open_connections Number of established connections, in use and idle.
+# TYPE dbwrap_open_connections gauge
+dbwrap_open_connections 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "dbwrap_open_connections"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectorInstances(t *testing.T) {
+	orders, users := openSqlite(t), openSqlite(t)
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(NewCollector(orders, prometheus.Labels{"db": "orders"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(NewCollector(users, prometheus.Labels{"db": "users"})); err != nil {
+		t.Errorf("registering a second instance: %v", err)
+	}
+	if err := registry.Register(NewCollector(users, prometheus.Labels{"db": "users"})); err == nil {
+		t.Error("the same labels were registered twice")
+	}
+	if n, err := testutil.GatherAndCount(registry, "dbwrap_opens_total"); err != nil || n != 2 {
+		t.Errorf("GatherAndCount() = %d, %v, want a series per instance", n, err)
+	}
+}
@@ -0,0 +1,21 @@
+package dbwrapmetrics_test
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sqos/dbwrap/v2"
+	"github.com/sqos/dbwrap/v2/dbwrapmetrics"
+)
+
+func ExampleNewCollector() {
+	orders := dbwrap.New(false, nil).SetPgParam("orders.db.local", "", "app", "", "orders", false)
+	users := dbwrap.New(false, nil).SetPgParam("users.db.local", "", "app", "", "users", false)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(dbwrapmetrics.NewCollector(orders, prometheus.Labels{"db": "orders"}))
+	registry.MustRegister(dbwrapmetrics.NewCollector(users, prometheus.Labels{"db": "users"}))
+	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	log.Fatal(http.ListenAndServe(":9090", nil))
+}
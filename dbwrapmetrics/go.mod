@@ -0,0 +1,10 @@
+module github.com/sqos/dbwrap/v2/dbwrapmetrics
+
+go 1.15
+
+require (
+	github.com/prometheus/client_golang v1.11.1
+	github.com/sqos/dbwrap/v2 v2.0.0
+)
+
+replace github.com/sqos/dbwrap/v2 => ../
@@ -0,0 +1,60 @@
+package dbwrap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSetDefault(t *testing.T) {
+	a, b := openSqlite(t), openSqlite(t)
+	for _, c := range []*DbMgt{a, b} {
+		if err := c.Migrate(&testUser{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := SetDefault(a)
+	defer SetDefault(prev)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				var count int64
+				if err := Db().Model(&testUser{}).Count(&count).Error; err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if (i+j)%2 == 0 {
+					SetDefault(a)
+				} else {
+					SetDefault(b)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if !a.IsOpen() || !b.IsOpen() {
+		t.Error("SetDefault closed the replaced default")
+	}
+	if old := SetDefault(b); old != a && old != b {
+		t.Error("SetDefault did not return the previous default")
+	}
+	if DefaultDbMgt() != b {
+		t.Error("DefaultDbMgt is not the instance set")
+	}
+}
+
+func TestSetDefaultNil(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("SetDefault(nil) did not panic")
+		}
+	}()
+	SetDefault(nil)
+}
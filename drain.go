@@ -0,0 +1,106 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDraining is returned by DbE while Drain holds the pool, unless SetDrainBlocking makes callers wait.
+var ErrDraining = errors.New("dbwrap: the database is draining")
+
+const drainPollInterval = 10 * time.Millisecond
+
+// SetDrainBlocking makes Db and DbE wait for Resume while the pool is drained, instead of failing with
+// ErrDraining.
+func (c *DbMgt) SetDrainBlocking(block bool) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.drainBlocking = block
+	return c
+}
+
+// Drain stops handing out the database, caps the pool at the connections in use and lowers the cap as they are
+// released, so the queries in flight finish but no new one starts. It returns once no connection is in use, or
+// ctx.Err() when ctx is done first; the pool stays drained until Resume either way.
+func (c *DbMgt) Drain(ctx context.Context) error {
+	c.lock.Lock()
+	if c.db == nil {
+		c.lock.Unlock()
+		return ErrNotOpened
+	}
+	if c.drain == nil {
+		c.drain = make(chan struct{})
+	}
+	db := c.db
+	c.lock.Unlock()
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	limit := 0
+	tick := time.NewTicker(drainPollInterval)
+	defer tick.Stop()
+	for {
+		inUse := sqlDB.Stats().InUse
+		if inUse <= 0 {
+			// 0 would mean no limit to database/sql, one idle connection is left for Resume
+			sqlDB.SetMaxOpenConns(1)
+			return nil
+		}
+		if limit == 0 || inUse < limit {
+			limit = inUse
+			sqlDB.SetMaxOpenConns(limit)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+// Resume restores the pool limits of the configuration and SetConnPool after Drain and wakes the callers
+// waiting for it.
+func (c *DbMgt) Resume() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.resume()
+}
+
+func (c *DbMgt) resume() {
+	if c.drain == nil {
+		return
+	}
+	close(c.drain)
+	c.drain = nil
+	if c.db == nil {
+		return
+	}
+	if sqlDB, err := c.db.DB(); err == nil {
+		c.restorePoolLimits(sqlDB)
+	}
+}
+
+// Draining reports whether Drain was called without Resume.
+func (c *DbMgt) Draining() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.drain != nil
+}
+
+func Drain(ctx context.Context) error {
+	return DefaultDbMgt().Drain(ctx)
+}
+
+func Resume() {
+	DefaultDbMgt().Resume()
+}
+
+func Draining() bool {
+	return DefaultDbMgt().Draining()
+}
+
+func SetDrainBlocking(block bool) *DbMgt {
+	return DefaultDbMgt().SetDrainBlocking(block)
+}
@@ -0,0 +1,129 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	c := openSqliteSleep(t).SetConnPool(5, 0, 0, 0)
+	sqlDB := c.CommonDB()
+	done := slowQuery(t, c, 200*time.Millisecond)
+	start := time.Now()
+	drained := make(chan error, 1)
+	go func() {
+		drained <- c.Drain(context.Background())
+	}()
+	waitFor(t, "the drain to start", c.Draining)
+	if err := c.Db().Exec("SELECT 1").Error; !errors.Is(err, ErrDraining) {
+		t.Errorf("Exec() = %v while draining, want ErrDraining", err)
+	}
+	if _, err := c.DbE(); err != ErrDraining {
+		t.Errorf("DbE() = %v while draining, want ErrDraining", err)
+	}
+	if err := c.DebugSession().Exec("SELECT 1").Error; !errors.Is(err, ErrDraining) {
+		t.Errorf("DebugSession().Exec() = %v while draining, want ErrDraining", err)
+	}
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Drain returned after %s, before the query in flight finished", elapsed)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("the query in flight failed: %v", err)
+	}
+	if stats := sqlDB.Stats(); stats.InUse != 0 || stats.MaxOpenConnections != 1 {
+		t.Errorf("%d in use, at most %d open once drained, want 0 and 1", stats.InUse, stats.MaxOpenConnections)
+	}
+	c.Resume()
+	if c.Draining() {
+		t.Error("Draining() after Resume")
+	}
+	if max := c.CommonDB().Stats().MaxOpenConnections; max != 5 {
+		t.Errorf("MaxOpenConnections = %d after Resume, want the SetConnPool 5", max)
+	}
+	if err := c.Db().Exec("SELECT 1").Error; err != nil {
+		t.Errorf("Exec() = %v after Resume", err)
+	}
+	if err := c.DebugSession().Exec("SELECT 1").Error; err != nil {
+		t.Errorf("DebugSession().Exec() = %v after Resume", err)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	c := openSqliteSleep(t)
+	done := slowQuery(t, c, 500*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Drain() = %v, want context.DeadlineExceeded", err)
+	}
+	if !c.Draining() {
+		t.Error("the pool is not drained any more after the timeout")
+	}
+	c.Resume()
+	<-done
+	if err := New(false, nil).Drain(context.Background()); err != ErrNotOpened {
+		t.Errorf("Drain() = %v before Open, want ErrNotOpened", err)
+	}
+}
+
+func TestDrainBlocking(t *testing.T) {
+	c := openSqlite(t).SetDrainBlocking(true)
+	if err := c.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Db().Exec("SELECT 1").Error
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Exec() = %v while draining, want it to wait for Resume", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Exec() = %v after Resume", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Resume did not wake the waiting caller")
+	}
+}
+
+func TestDrainConcurrentCallers(t *testing.T) {
+	c := openSqlite(t)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := c.Db().Exec("SELECT 1").Error; err != nil && !errors.Is(err, ErrDraining) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := c.Drain(context.Background()); err != nil {
+			t.Error(err)
+		}
+		c.Resume()
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,97 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// DropTables drops the tables of models, the dependent ones first, and unregisters the models so a later
+// Migrate does not create them again. With cascade, postgres also drops the objects depending on them, such as
+// the views and the foreign keys of other tables. It runs in a transaction on the drivers with transactional DDL.
+func (c *DbMgt) DropTables(ctx context.Context, cascade bool, models ...interface{}) error {
+	if err := c.dropTables(ctx, cascade, models); err != nil {
+		return err
+	}
+	c.unregisterModels(models, true)
+	return nil
+}
+
+func (c *DbMgt) dropTables(ctx context.Context, cascade bool, models []interface{}) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	db = db.WithContext(ctx)
+	ordered := models
+	if m, ok := db.Migrator().(interface {
+		ReorderModels(values []interface{}, autoAdd bool) []interface{}
+	}); ok {
+		ordered = m.ReorderModels(models, false)
+	}
+	stmt := &gorm.Statement{DB: db}
+	driver := db.Dialector.Name()
+	var stmts []string
+	for i := len(ordered) - 1; i >= 0; i-- {
+		table, err := tableOf(db, ordered[i])
+		if err != nil {
+			return err
+		}
+		stmts = append(stmts, dropTableSQL(driver, stmt.Quote(table), cascade))
+	}
+	c.migrateLock.Lock()
+	err = runMigrationStep(db, func(tx *gorm.DB) error {
+		for _, s := range stmts {
+			if err := tx.Exec(s).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	c.migrateLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("dbwrap: drop tables: %w", err)
+	}
+	return nil
+}
+
+// unregisterModels removes the registered models of the types of models, and with forget their dependencies and
+// options too.
+func (c *DbMgt) unregisterModels(models []interface{}, forget bool) {
+	dropped := make(map[reflect.Type]bool, len(models))
+	for _, m := range models {
+		if _, ok := m.(string); !ok {
+			dropped[modelType(m)] = true
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	kept := c.models[:0]
+	for _, m := range c.models {
+		if !dropped[modelType(m)] {
+			kept = append(kept, m)
+		}
+	}
+	c.models = kept
+	if !forget {
+		return
+	}
+	for t := range dropped {
+		delete(c.modelDeps, t)
+		delete(c.modelOpts, t)
+	}
+}
+
+func dropTableSQL(driver, quoted string, cascade bool) string {
+	drop := "DROP TABLE IF EXISTS " + quoted
+	if cascade && driver == driverPostgres {
+		drop += " CASCADE"
+	}
+	return drop
+}
+
+func DropTables(ctx context.Context, cascade bool, models ...interface{}) error {
+	return DefaultDbMgt().DropTables(ctx, cascade, models...)
+}
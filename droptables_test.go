@@ -0,0 +1,103 @@
+package dbwrap
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDropTableSQL(t *testing.T) {
+	tests := []struct {
+		driver  string
+		cascade bool
+		want    string
+	}{
+		{driverPostgres, true, `DROP TABLE IF EXISTS "users" CASCADE`},
+		{driverPostgres, false, `DROP TABLE IF EXISTS "users"`},
+		// the other drivers have no CASCADE, or ignore it
+		{driverMysql, true, `DROP TABLE IF EXISTS "users"`},
+		{driverSqlite, true, `DROP TABLE IF EXISTS "users"`},
+		{driverSqlServer, true, `DROP TABLE IF EXISTS "users"`},
+	}
+	for _, tt := range tests {
+		if got := dropTableSQL(tt.driver, `"users"`, tt.cascade); got != tt.want {
+			t.Errorf("dropTableSQL(%s, %v) = %s, want %s", tt.driver, tt.cascade, got, tt.want)
+		}
+	}
+}
+
+func TestDropTables(t *testing.T) {
+	c := openSqlite(t)
+	c.RegisterModel(&testInvoice{}, &testAccount{})
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DropTables(context.Background(), true, &testUser{}, testInvoice{}, "missing"); err != nil {
+		t.Fatal(err)
+	}
+	for model, want := range map[interface{}]bool{&testUser{}: false, &testInvoice{}: false, &testAccount{}: true} {
+		if has, err := c.HasTable(model); err != nil || has != want {
+			t.Errorf("HasTable(%T) = %v, %v, want %v", model, has, err, want)
+		}
+	}
+	if len(c.models) != 1 || modelType(c.models[0]) != modelType(&testAccount{}) {
+		t.Errorf("registered %v, want testAccount only", c.models)
+	}
+	if _, ok := c.modelDeps[modelType(&testInvoice{})]; ok {
+		t.Error("the dependencies of the dropped model are still registered")
+	}
+	// the dropped models are not created again
+	if err := c.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := c.HasTable(&testUser{}); err != nil || has {
+		t.Errorf("HasTable() = %v, %v after Migrate, want the dropped table gone", has, err)
+	}
+}
+
+func TestOpenUntilOkAndDropTableIfExistsThenCreateTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	c := New(false, nil).SetSqlite3Param(path)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Create(&testUser{Name: "old"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	c = New(false, nil).SetSqlite3Param(path).OpenUntilOkAndDropTableIfExistsThenCreateTables(time.Millisecond,
+		&testUser{})
+	defer c.Close()
+	if n := countUsers(t, c); n != 0 {
+		t.Errorf("%d users, want the table created again empty", n)
+	}
+	if len(c.models) != 1 {
+		t.Errorf("registered %v, want the created model", c.models)
+	}
+}
+
+func TestOpenUntilOkAndDropTableIfExistsThenCreateTablesKeepsRegistration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	c := New(false, nil).SetSqlite3Param(path).RegisterModelWithOptions(&testInvoice{}, ModelOptions{},
+		&testAccount{})
+	c = c.OpenUntilOkAndDropTableIfExistsThenCreateTables(time.Millisecond, &testInvoice{}, &testAccount{})
+	defer c.Close()
+	if deps := c.modelDeps[modelType(&testInvoice{})]; len(deps) != 1 || deps[0] != modelType(&testAccount{}) {
+		t.Errorf("testInvoice depends on %v, want testAccount", deps)
+	}
+	if _, ok := c.modelOpts[modelType(&testInvoice{})]; !ok {
+		t.Error("the options of the created model are forgotten")
+	}
+	if len(c.models) != 2 {
+		t.Errorf("registered %v, want the created models", c.models)
+	}
+	for _, model := range []interface{}{&testInvoice{}, &testAccount{}} {
+		if has, err := c.HasTable(model); err != nil || !has {
+			t.Errorf("HasTable(%T) = %v, %v, want true", model, has, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package dbwrap
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// DryRun returns a session building the SQL of its operations without running it, read it from
+// Statement.SQL and Statement.Vars. Like Db, it fails with ErrNotOpened when the database is not open.
+func (c *DbMgt) DryRun() *gorm.DB {
+	return c.Db().Session(&gorm.Session{DryRun: true})
+}
+
+// ExplainStatement returns the SQL and the bound values of the operation fn builds on a DryRun session, e.g.
+//
+//	sql, vars, err := mgt.ExplainStatement(func(tx *gorm.DB) *gorm.DB {
+//		return tx.Where("age > ?", 18).Find(&[]User{})
+//	})
+func (c *DbMgt) ExplainStatement(fn func(tx *gorm.DB) *gorm.DB) (string, []interface{}, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return "", nil, err
+	}
+	tx := fn(db.Session(&gorm.Session{DryRun: true}))
+	if tx == nil {
+		return "", nil, errors.New("dbwrap: ExplainStatement needs the *gorm.DB of the operation")
+	}
+	if tx.Error != nil {
+		return "", nil, tx.Error
+	}
+	return tx.Statement.SQL.String(), tx.Statement.Vars, nil
+}
+
+func DryRun() *gorm.DB {
+	return DefaultDbMgt().DryRun()
+}
+
+func ExplainStatement(fn func(tx *gorm.DB) *gorm.DB) (string, []interface{}, error) {
+	return DefaultDbMgt().ExplainStatement(fn)
+}
@@ -0,0 +1,82 @@
+package dbwrap
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestExplainStatement(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		var buf bytes.Buffer
+		c := NewWithOptions(WithLogger(bufferLogger(&buf))).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db")).
+			SetDebug(debug)
+		if err := c.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		// the tables do not exist, nothing runs
+		sql, vars, err := c.ExplainStatement(func(tx *gorm.DB) *gorm.DB {
+			var rows []struct {
+				ID   uint
+				Name string
+			}
+			return tx.Model(&testInvoice{}).Select("test_invoices.id, test_accounts.name").
+				Joins("JOIN test_accounts ON test_accounts.id = test_invoices.test_account_id").
+				Where("test_invoices.total > ?", 100).Where("test_accounts.name IN ?", []string{"a", "b"}).
+				Order("test_invoices.id").Limit(10).Find(&rows)
+		})
+		if err != nil {
+			t.Fatalf("debug %v: %v", debug, err)
+		}
+		want := "SELECT test_invoices.id, test_accounts.name FROM `test_invoices` " +
+			"JOIN test_accounts ON test_accounts.id = test_invoices.test_account_id " +
+			"WHERE test_invoices.total > ? AND test_accounts.name IN (?,?) ORDER BY test_invoices.id LIMIT 10"
+		if sql != want {
+			t.Errorf("debug %v: sql = %q, want %q", debug, sql, want)
+		}
+		if want := []interface{}{100, "a", "b"}; !reflect.DeepEqual(vars, want) {
+			t.Errorf("debug %v: vars = %v, want %v", debug, vars, want)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	cached := c.StmtCacheSize()
+	tx := c.DryRun().Create(&testUser{Name: "a"})
+	if err := tx.Error; err != nil {
+		t.Fatal(err)
+	}
+	if sql := tx.Statement.SQL.String(); sql != "INSERT INTO `test_users` (`name`) VALUES (?)" {
+		t.Errorf("sql = %q", sql)
+	}
+	if size := c.StmtCacheSize(); size != cached {
+		t.Errorf("the dry run prepared %d statements", size-cached)
+	}
+	if count := countUsers(t, c); count != 0 {
+		t.Errorf("the dry run inserted %d rows", count)
+	}
+}
+
+func TestDryRunNotOpened(t *testing.T) {
+	c := New(false, nil)
+	if err := c.DryRun().Find(&[]testUser{}).Error; !errors.Is(err, ErrNotOpened) {
+		t.Errorf("DryRun().Find() = %v, want ErrNotOpened", err)
+	}
+	_, _, err := c.ExplainStatement(func(tx *gorm.DB) *gorm.DB { return tx.Find(&[]testUser{}) })
+	if err != ErrNotOpened {
+		t.Errorf("ExplainStatement() = %v, want ErrNotOpened", err)
+	}
+	c = openSqlite(t)
+	if _, _, err = c.ExplainStatement(func(*gorm.DB) *gorm.DB { return nil }); err == nil {
+		t.Error("ExplainStatement accepted a nil *gorm.DB")
+	}
+}
@@ -0,0 +1,297 @@
+package dbwrap
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+)
+
+const (
+	driverPostgres  = "postgres"
+	driverMysql     = "mysql"
+	driverSqlite    = "sqlite"
+	driverSqlServer = "sqlserver"
+)
+
+// DefaultMysqlCharset is used when no charset is given, set it to "utf8" to keep the former default.
+var DefaultMysqlCharset = "utf8mb4"
+
+var pgSSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+func checkPgSSLMode(mode string) error {
+	for _, m := range pgSSLModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("dbwrap: invalid postgres sslmode %q, must be one of %v", mode, pgSSLModes)
+}
+
+var pgCoreKeys = map[string]bool{"host": true, "port": true, "user": true, "password": true, "dbname": true, "sslmode": true,
+	"sslrootcert": true, "sslcert": true, "sslkey": true}
+
+func checkReadable(file string) error {
+	if len(file) <= 0 {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("dbwrap: %w", err)
+	}
+	return f.Close()
+}
+
+func checkPgOptions(opts map[string]string) error {
+	for k := range opts {
+		if pgCoreKeys[k] {
+			return fmt.Errorf("dbwrap: postgres option %q conflicts with a connection parameter", k)
+		}
+		if len(k) <= 0 || strings.ContainsAny(k, " \t\n='") {
+			return fmt.Errorf("dbwrap: invalid postgres option name %q", k)
+		}
+	}
+	return nil
+}
+
+func normalizeDriver(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "postgres", "postgresql", "pg":
+		return driverPostgres, nil
+	case "mysql":
+		return driverMysql, nil
+	case "sqlite", "sqlite3":
+		return driverSqlite, nil
+	case "sqlserver", "mssql":
+		return driverSqlServer, nil
+	default:
+		return "", fmt.Errorf("dbwrap: unsupported database driver %q", name)
+	}
+}
+
+func (p *Config) dsn() string {
+	if len(p.DSN) > 0 {
+		return p.DSN
+	}
+	switch p.Driver {
+	case driverPostgres:
+		return p.pgDsn()
+	case driverMysql:
+		return p.mysqlDsn()
+	case driverSqlite:
+		return p.Name
+	case driverSqlServer:
+		return p.sqlServerDsn()
+	default:
+		return ""
+	}
+}
+
+var defaultPorts = map[string]string{driverPostgres: "5432", driverMysql: "3306", driverSqlServer: "1433"}
+
+func (p *Config) resolvePort() {
+	if len(p.Port) > 0 || len(p.DSN) > 0 || isSocketPath(p.Host) {
+		return
+	}
+	if p.Driver == driverSqlServer && (strings.Contains(p.Host, `\`) || len(p.Options["instance"]) > 0) {
+		return
+	}
+	p.Port = defaultPorts[p.Driver]
+}
+
+func (p *Config) checkPort() error {
+	if len(p.Port) <= 0 || len(p.DSN) > 0 {
+		return nil
+	}
+	ports := []string{p.Port}
+	if p.Driver == driverPostgres {
+		ports = strings.Split(p.Port, ",")
+		if hosts := strings.Split(p.Host, ","); len(ports) > 1 && len(ports) != len(hosts) {
+			return fmt.Errorf("dbwrap: %d postgres ports given for %d hosts", len(ports), len(hosts))
+		}
+	}
+	for _, s := range ports {
+		if port, err := strconv.Atoi(s); err != nil || port <= 0 || port > 65535 {
+			return fmt.Errorf("dbwrap: invalid port %q", s)
+		}
+	}
+	return nil
+}
+
+func (p *Config) dialector() (gorm.Dialector, error) {
+	if err := p.checkPort(); err != nil {
+		return nil, err
+	}
+	dsn := p.dsn()
+	switch p.Driver {
+	case driverPostgres:
+		return postgres.Open(dsn), nil
+	case driverMysql:
+		if p.tlsErr != nil {
+			return nil, p.tlsErr
+		}
+		return mysql.Open(dsn), nil
+	case driverSqlite:
+		if len(p.Pragmas) > 0 {
+			return &sqlite.Dialector{DSN: dsn, Conn: sql.OpenDB(newSqliteConnector(dsn, p.Pragmas))}, nil
+		}
+		return sqlite.Open(dsn), nil
+	case driverSqlServer:
+		if p.tokenProvider != nil {
+			return p.sqlServerTokenDialector(dsn)
+		}
+		return sqlserver.Open(dsn), nil
+	default:
+		return nil, errors.New("dbwrap: no database driver configured")
+	}
+}
+
+func (p *Config) setOption(key, value string) {
+	if p.Options == nil {
+		p.Options = make(map[string]string)
+	}
+	p.Options[key] = value
+}
+
+func (p *Config) optionKeys() []string {
+	keys := make([]string, 0, len(p.Options))
+	for k := range p.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isSocketPath(host string) bool {
+	return strings.HasPrefix(host, "/")
+}
+
+func pgQuote(v string) string {
+	if len(v) > 0 && !strings.ContainsAny(v, " \t\n\\'") {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+func (p *Config) pgDsn() string {
+	dsn := "host=" + pgQuote(p.Host)
+	if len(p.Port) > 0 {
+		dsn += " port=" + p.Port
+	}
+	if len(p.User) > 0 {
+		dsn += " user=" + pgQuote(p.User)
+	}
+	if len(p.Password) > 0 {
+		dsn += " password=" + pgQuote(p.Password)
+	}
+	if len(p.Name) > 0 {
+		dsn += " dbname=" + pgQuote(p.Name)
+	}
+	hasCert := len(p.SSLRootCert) > 0 || len(p.SSLCert) > 0
+	sslMode := p.SSLMode
+	if len(sslMode) <= 0 {
+		if hasCert {
+			sslMode = "verify-full"
+		} else if p.ssl {
+			sslMode = "require"
+		} else {
+			sslMode = "disable"
+		}
+	}
+	dsn += " sslmode=" + sslMode
+	if len(p.SSLRootCert) > 0 {
+		dsn += " sslrootcert=" + pgQuote(p.SSLRootCert)
+	}
+	if len(p.SSLCert) > 0 {
+		dsn += " sslcert=" + pgQuote(p.SSLCert) + " sslkey=" + pgQuote(p.SSLKey)
+	}
+	for _, k := range p.optionKeys() {
+		dsn += " " + k + "=" + pgQuote(p.Options[k])
+	}
+	return dsn
+}
+
+func (p *Config) mysqlCharset() string {
+	if len(p.Charset) > 0 {
+		return p.Charset
+	}
+	return DefaultMysqlCharset
+}
+
+func checkMysqlCollation(charset, collation string) error {
+	if len(collation) > 0 && !strings.HasPrefix(collation, charset+"_") {
+		return fmt.Errorf("dbwrap: mysql collation %q does not match charset %q", collation, charset)
+	}
+	return nil
+}
+
+func (p *Config) mysqlDsn() string {
+	charset, loc := p.mysqlCharset(), p.Loc
+	if len(loc) <= 0 {
+		loc = "Local"
+	}
+	parsetime := "False"
+	if p.ParseTime {
+		parsetime = "True"
+	}
+	params := map[string]string{"charset": charset, "parseTime": parsetime, "loc": loc}
+	for k, v := range p.Options {
+		params[k] = v
+	}
+	if len(p.Collation) > 0 {
+		// the driver sends the collation in the handshake, the SET NAMES of a charset param would reset it to the
+		// default collation of the charset
+		delete(params, "charset")
+		params["collation"] = p.Collation
+	}
+	if len(p.tlsName) > 0 {
+		params["tls"] = p.tlsName
+	}
+	cfg := mysqldriver.NewConfig()
+	cfg.User, cfg.Passwd, cfg.DBName, cfg.Params = p.User, p.Password, p.Name, params
+	if isSocketPath(p.Host) {
+		cfg.Net, cfg.Addr = "unix", p.Host
+	} else {
+		cfg.Net, cfg.Addr = "tcp", p.Host+":"+p.Port
+	}
+	return cfg.FormatDSN()
+}
+
+func (p *Config) sqlServerDsn() string {
+	host, instance := p.Host, p.Options["instance"]
+	if idx := strings.Index(host, `\`); idx >= 0 {
+		host, instance = host[:idx], host[idx+1:]
+	}
+	u := url.URL{Scheme: "sqlserver", Host: host}
+	if len(p.User) > 0 || len(p.Password) > 0 {
+		u.User = url.UserPassword(p.User, p.Password)
+	}
+	if len(p.Port) > 0 {
+		u.Host += ":" + p.Port
+	}
+	if len(instance) > 0 {
+		u.Path = "/" + instance
+	}
+	query := url.Values{}
+	query.Set("database", p.Name)
+	for k, v := range p.Options {
+		if k != "instance" {
+			query.Set(k, v)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
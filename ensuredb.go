@@ -0,0 +1,204 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// adminDatabases are the databases EnsureDatabase connects to, which exist on every server.
+var adminDatabases = map[string]string{driverPostgres: "postgres", driverMysql: "", driverSqlServer: "master"}
+
+var databaseOptionPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// SetDatabaseOptions sets the encoding and collation EnsureDatabase creates the database with, the server
+// defaults being used for the empty ones. On mysql they default to Charset and Collation.
+func (c *DbMgt) SetDatabaseOptions(encoding, collation string) error {
+	for _, opt := range []string{encoding, collation} {
+		if len(opt) > 0 && !databaseOptionPattern.MatchString(opt) {
+			return fmt.Errorf("dbwrap: invalid database option %q", opt)
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.dbEncoding, c.dbCollation = encoding, collation
+	return nil
+}
+
+// EnsureDatabase creates the configured database when it does not exist, connecting to the admin database of
+// the server, "postgres" on postgres and "master" on sqlserver, with the same credentials and its own connection.
+// For sqlite it creates the directory of the database file.
+func (c *DbMgt) EnsureDatabase(ctx context.Context) error {
+	c.lock.Lock()
+	if c.dialector != nil || len(c.config.DSN) > 0 {
+		c.lock.Unlock()
+		return errors.New("dbwrap: EnsureDatabase needs connection parameters, not a dialector or a DSN")
+	}
+	cfg, err := c.resolveCredentials()
+	credentials, encoding, collation := c.credentials, c.dbEncoding, c.dbCollation
+	c.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = cfg.validate(); err != nil && cfg.Driver != driverSqlite {
+		return err
+	}
+	if cfg.Driver == driverSqlite {
+		dir, ok := sqliteDir(cfg.Name)
+		if !ok || len(cfg.Name) <= 0 {
+			return nil
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("dbwrap: sqlite directory: %w", err)
+		}
+		return nil
+	}
+	if cfg.Driver == driverMysql {
+		if len(encoding) <= 0 {
+			encoding = cfg.Charset
+		}
+		if len(collation) <= 0 {
+			collation = cfg.Collation
+		}
+	}
+	name := cfg.Name
+	if len(name) <= 0 {
+		return errors.New("dbwrap: no database name configured")
+	}
+	create, err := createDatabaseSQL(cfg.Driver, name, encoding, collation)
+	if err != nil {
+		return err
+	}
+	cfg.Name = adminDatabases[cfg.Driver]
+	var dialector gorm.Dialector
+	if credentials != nil {
+		dialector, err = cfg.credentialDialector(credentials)
+	} else {
+		dialector, err = cfg.dialector()
+	}
+	if err != nil {
+		return err
+	}
+	db, err := openGorm(ctx, dialector, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		return fmt.Errorf("dbwrap: connect to the %s admin database: %w", cfg.Driver, err)
+	}
+	defer closeGormDB(db)
+	db = db.WithContext(ctx)
+	exists, err := databaseExists(db, cfg.Driver, name)
+	if err != nil || exists {
+		return err
+	}
+	if err = db.Exec(create).Error; err != nil {
+		// another process may have created it meanwhile
+		if exists, _ = databaseExists(db, cfg.Driver, name); exists {
+			return nil
+		}
+		return fmt.Errorf("dbwrap: create database %s: %w", name, err)
+	}
+	if c.log != nil {
+		c.log.Info(ctx, "dbwrap: created database %s", name)
+	}
+	return nil
+}
+
+// OpenEnsuringDatabase is EnsureDatabase followed by OpenContext.
+func (c *DbMgt) OpenEnsuringDatabase(ctx context.Context) error {
+	if err := c.EnsureDatabase(ctx); err != nil {
+		return err
+	}
+	return c.OpenContext(ctx)
+}
+
+func databaseExists(db *gorm.DB, driver, name string) (bool, error) {
+	var query string
+	switch driver {
+	case driverPostgres:
+		query = "SELECT count(*) FROM pg_database WHERE datname = ?"
+	case driverMysql:
+		query = "SELECT count(*) FROM information_schema.schemata WHERE schema_name = ?"
+	case driverSqlServer:
+		query = "SELECT count(*) FROM sys.databases WHERE name = ?"
+	}
+	var count int64
+	if err := db.Raw(query, name).Scan(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// quoteDatabase quotes name as an identifier of driver, doubling the closing quote character.
+func quoteDatabase(driver, name string) (string, error) {
+	if len(name) <= 0 || strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("dbwrap: invalid database name %q", name)
+	}
+	switch driver {
+	case driverPostgres:
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`, nil
+	case driverMysql:
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`", nil
+	case driverSqlServer:
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]", nil
+	default:
+		return "", fmt.Errorf("dbwrap: EnsureDatabase does not support %s", driver)
+	}
+}
+
+func createDatabaseSQL(driver, name, encoding, collation string) (string, error) {
+	quoted, err := quoteDatabase(driver, name)
+	if err != nil {
+		return "", err
+	}
+	for _, opt := range []string{encoding, collation} {
+		if len(opt) > 0 && !databaseOptionPattern.MatchString(opt) {
+			return "", fmt.Errorf("dbwrap: invalid database option %q", opt)
+		}
+	}
+	create := "CREATE DATABASE " + quoted
+	switch driver {
+	case driverPostgres:
+		if len(encoding) > 0 {
+			create += " ENCODING '" + encoding + "'"
+		}
+		if len(collation) > 0 {
+			create += " LC_COLLATE '" + collation + "'"
+		}
+		if len(encoding) > 0 || len(collation) > 0 {
+			// template1 may have another encoding or collation
+			create += " TEMPLATE template0"
+		}
+	case driverMysql:
+		if len(encoding) > 0 {
+			create += " CHARACTER SET " + encoding
+		}
+		if len(collation) > 0 {
+			create += " COLLATE " + collation
+		}
+	case driverSqlServer:
+		if len(encoding) > 0 {
+			return "", errors.New("dbwrap: sqlserver databases have no encoding, set a collation instead")
+		}
+		if len(collation) > 0 {
+			create += " COLLATE " + collation
+		}
+	}
+	return create, nil
+}
+
+func SetDatabaseOptions(encoding, collation string) error {
+	return DefaultDbMgt().SetDatabaseOptions(encoding, collation)
+}
+
+func EnsureDatabase(ctx context.Context) error {
+	return DefaultDbMgt().EnsureDatabase(ctx)
+}
+
+func OpenEnsuringDatabase(ctx context.Context) error {
+	return DefaultDbMgt().OpenEnsuringDatabase(ctx)
+}
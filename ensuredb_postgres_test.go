@@ -0,0 +1,46 @@
+//go:build postgres
+// +build postgres
+
+package dbwrap
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEnsureDatabasePostgres(t *testing.T) {
+	admin := openPostgres(t)
+	cfg := admin.Config()
+	// a name that only works quoted
+	cfg.Name = `dbwrap_test "ensure"; x`
+	quoted, err := quoteDatabase(driverPostgres, cfg.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop := func() {
+		if err := admin.Db().Exec("DROP DATABASE IF EXISTS " + quoted).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	drop()
+	defer drop()
+	c, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = c.EnsureDatabase(context.Background()); err != nil {
+			t.Fatalf("EnsureDatabase #%d: %v", i+1, err)
+		}
+	}
+	if err = c.OpenEnsuringDatabase(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err = c.Db().Raw("SELECT current_database()").Scan(&name).Error; err != nil || name != cfg.Name {
+		t.Errorf("current_database() = %q, %v, want %q", name, err, cfg.Name)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
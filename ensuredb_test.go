@@ -0,0 +1,83 @@
+package dbwrap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+)
+
+func TestQuoteDatabase(t *testing.T) {
+	tests := []struct {
+		driver, name, want string
+	}{
+		{driverPostgres, "app", `"app"`},
+		{driverPostgres, `my "app"; DROP DATABASE x; --`, `"my ""app""; DROP DATABASE x; --"`},
+		{driverMysql, "app", "`app`"},
+		{driverMysql, "my`app", "`my``app`"},
+		{driverSqlServer, "app", "[app]"},
+		{driverSqlServer, "my]app[", "[my]]app[]"},
+	}
+	for _, tt := range tests {
+		if got, err := quoteDatabase(tt.driver, tt.name); err != nil || got != tt.want {
+			t.Errorf("quoteDatabase(%s, %q) = %s, %v, want %s", tt.driver, tt.name, got, err, tt.want)
+		}
+	}
+	for _, tt := range []struct{ driver, name string }{{driverPostgres, ""}, {driverMysql, "a\x00b"},
+		{driverSqlite, "app"}} {
+		if got, err := quoteDatabase(tt.driver, tt.name); err == nil {
+			t.Errorf("quoteDatabase(%s, %q) = %s, want an error", tt.driver, tt.name, got)
+		}
+	}
+}
+
+func TestCreateDatabaseSQL(t *testing.T) {
+	tests := []struct {
+		driver, encoding, collation, want string
+	}{
+		{driverPostgres, "", "", `CREATE DATABASE "app"`},
+		{driverPostgres, "UTF8", "en_US.UTF-8",
+			`CREATE DATABASE "app" ENCODING 'UTF8' LC_COLLATE 'en_US.UTF-8' TEMPLATE template0`},
+		{driverMysql, "utf8mb4", "utf8mb4_unicode_ci",
+			"CREATE DATABASE `app` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci"},
+		{driverSqlServer, "", "Latin1_General_CI_AS", "CREATE DATABASE [app] COLLATE Latin1_General_CI_AS"},
+	}
+	for _, tt := range tests {
+		if got, err := createDatabaseSQL(tt.driver, "app", tt.encoding, tt.collation); err != nil || got != tt.want {
+			t.Errorf("createDatabaseSQL(%s) = %s, %v, want %s", tt.driver, got, err, tt.want)
+		}
+	}
+	if _, err := createDatabaseSQL(driverSqlServer, "app", "UTF8", ""); err == nil {
+		t.Error("createDatabaseSQL accepted an encoding on sqlserver")
+	}
+	if _, err := createDatabaseSQL(driverPostgres, "app", "UTF8'; DROP", ""); err == nil {
+		t.Error("createDatabaseSQL accepted an invalid encoding")
+	}
+	if err := New(false, nil).SetDatabaseOptions("utf8", "x' OR 1"); err == nil {
+		t.Error("SetDatabaseOptions accepted an invalid collation")
+	}
+}
+
+func TestEnsureDatabaseSqlite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "nested", "test.db")
+	c := New(false, nil).SetSqlite3Param(path)
+	if err := c.EnsureDatabase(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		t.Fatalf("the sqlite directory is missing: %v", err)
+	}
+	if err := c.OpenEnsuringDatabase(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the database file is missing: %v", err)
+	}
+	d := New(false, nil).SetDialector(sqlite.Open(path))
+	if err := d.EnsureDatabase(context.Background()); err == nil {
+		t.Error("EnsureDatabase accepted a dialector")
+	}
+}
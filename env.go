@@ -0,0 +1,112 @@
+package dbwrap
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultEnvPrefix = "DBWRAP"
+
+func NewFromEnv(prefix string) (*DbMgt, error) {
+	if len(prefix) <= 0 {
+		prefix = defaultEnvPrefix
+	}
+	env := func(key string) string {
+		return os.Getenv(prefix + "_" + key)
+	}
+	debug := false
+	if v := env("DEBUG"); len(v) > 0 {
+		var err error
+		if debug, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("dbwrap: invalid %s_DEBUG %q", prefix, v)
+		}
+	}
+	p, err := configFromEnv(prefix, env)
+	if err != nil {
+		return nil, err
+	}
+	return New(debug, nil).setParam(p), nil
+}
+
+func configFromEnv(prefix string, env func(key string) string) (Config, error) {
+	driver, dsn := env("DRIVER"), env("DSN")
+	if len(dsn) > 0 {
+		if len(driver) <= 0 {
+			return parseURL(dsn)
+		}
+		d, err := normalizeDriver(driver)
+		if err != nil {
+			return Config{}, err
+		}
+		return Config{Driver: d, DSN: dsn}, nil
+	}
+	if len(driver) <= 0 {
+		return Config{}, fmt.Errorf("dbwrap: missing environment variable %s_DRIVER or %s_DSN", prefix, prefix)
+	}
+	d, err := normalizeDriver(driver)
+	if err != nil {
+		return Config{}, err
+	}
+	required := []string{"HOST", "USER", "NAME"}
+	if d == driverSqlite {
+		required = []string{"NAME"}
+	}
+	var missing []string
+	for _, key := range required {
+		if len(env(key)) <= 0 {
+			missing = append(missing, prefix+"_"+key)
+		}
+	}
+	if len(missing) > 0 {
+		return Config{}, fmt.Errorf("dbwrap: missing environment variables for %s: %s", d, strings.Join(missing, ", "))
+	}
+	p := Config{Driver: d, Host: env("HOST"), Port: env("PORT"), User: env("USER"), Password: env("PASSWORD"), Name: env("NAME")}
+	if mode := env("SSLMODE"); len(mode) > 0 {
+		if err = checkPgSSLMode(mode); err != nil {
+			return Config{}, err
+		}
+		if err = p.setSSLMode(mode); err != nil {
+			return Config{}, fmt.Errorf("%w, unset %s_SSLMODE", err, prefix)
+		}
+	}
+	return p, nil
+}
+
+// sslModeOptions maps the postgres sslmodes to the TLS options of the mysql and sqlserver drivers. mysql and
+// sqlserver verify the host name along with the certificate, so verify-ca is verify-full there.
+var sslModeOptions = map[string]map[string]map[string]string{
+	driverMysql: {
+		"disable":     {"tls": "false"},
+		"allow":       {"tls": "preferred"},
+		"prefer":      {"tls": "preferred"},
+		"require":     {"tls": "skip-verify"},
+		"verify-ca":   {"tls": "true"},
+		"verify-full": {"tls": "true"},
+	},
+	driverSqlServer: {
+		"disable":     {"encrypt": "disable"},
+		"allow":       {"encrypt": "false"},
+		"prefer":      {"encrypt": "false"},
+		"require":     {"encrypt": "true", "TrustServerCertificate": "true"},
+		"verify-ca":   {"encrypt": "true", "TrustServerCertificate": "false"},
+		"verify-full": {"encrypt": "true", "TrustServerCertificate": "false"},
+	},
+}
+
+// setSSLMode sets the postgres sslmode mode on p, or the TLS options of the driver matching it.
+func (p *Config) setSSLMode(mode string) error {
+	if p.Driver == driverPostgres {
+		p.SSLMode = mode
+		return nil
+	}
+	options, ok := sslModeOptions[p.Driver][mode]
+	if !ok {
+		return fmt.Errorf("dbwrap: %s has no sslmode", p.Driver)
+	}
+	for k, v := range options {
+		p.setOption(k, v)
+	}
+	return nil
+}
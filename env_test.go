@@ -0,0 +1,93 @@
+package dbwrap
+
+import (
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// setEnv sets the variables of vars, and unsets them when the test ends.
+func setEnv(t *testing.T, vars map[string]string) {
+	for k, v := range vars {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal(err)
+		}
+		k := k
+		t.Cleanup(func() { os.Unsetenv(k) })
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		vars   map[string]string
+		debug  bool
+		want   string
+	}{
+		{"postgres", "ENVTEST", map[string]string{"ENVTEST_DRIVER": "pg", "ENVTEST_HOST": "db.local",
+			"ENVTEST_USER": "user", "ENVTEST_PASSWORD": "secret", "ENVTEST_NAME": "app"},
+			false, "host=db.local port=5432 user=user password=secret dbname=app sslmode=disable"},
+		{"postgres sslmode", "ENVTEST", map[string]string{"ENVTEST_DRIVER": "postgres", "ENVTEST_HOST": "db.local",
+			"ENVTEST_PORT": "5433", "ENVTEST_USER": "user", "ENVTEST_NAME": "app", "ENVTEST_SSLMODE": "verify-full"},
+			false, "host=db.local port=5433 user=user dbname=app sslmode=verify-full"},
+		{"mysql sslmode", "ENVTEST", map[string]string{"ENVTEST_DRIVER": "mysql", "ENVTEST_HOST": "db.local",
+			"ENVTEST_USER": "user", "ENVTEST_NAME": "app", "ENVTEST_SSLMODE": "require"},
+			false, "user@tcp(db.local:3306)/app?charset=utf8mb4&loc=Local&parseTime=False&tls=skip-verify"},
+		{"sqlserver sslmode", "ENVTEST", map[string]string{"ENVTEST_DRIVER": "mssql", "ENVTEST_HOST": "db.local",
+			"ENVTEST_USER": "user", "ENVTEST_NAME": "app", "ENVTEST_SSLMODE": "verify-ca"},
+			false, "sqlserver://user:@db.local:1433?TrustServerCertificate=false&database=app&encrypt=true"},
+		{"sqlite", "ENVTEST", map[string]string{"ENVTEST_DRIVER": "sqlite3", "ENVTEST_NAME": "/tmp/app.db",
+			"ENVTEST_DEBUG": "true"}, true, "/tmp/app.db"},
+		{"url", "ENVTEST", map[string]string{"ENVTEST_DSN": "postgres://user@db.local/app?sslmode=require"},
+			false, "host=db.local port=5432 user=user dbname=app sslmode=require"},
+		{"raw dsn", "ENVTEST", map[string]string{"ENVTEST_DRIVER": "mysql", "ENVTEST_DSN": "user@tcp(db:3306)/app"},
+			false, "user@tcp(db:3306)/app"},
+		{"default prefix", "", map[string]string{"DBWRAP_DRIVER": "sqlite", "DBWRAP_NAME": "app.db"}, false, "app.db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.vars)
+			c, err := NewFromEnv(tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.UnsafeDSN(); got != tt.want {
+				t.Errorf("UnsafeDSN() = %q, want %q", got, tt.want)
+			}
+			if got := atomic.LoadInt32(&c.debug) != 0; got != tt.debug {
+				t.Errorf("Debug = %v, want %v", got, tt.debug)
+			}
+		})
+	}
+}
+
+func TestNewFromEnvErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{"nothing", nil, "missing environment variable ENVTEST_DRIVER or ENVTEST_DSN"},
+		{"missing fields", map[string]string{"ENVTEST_DRIVER": "postgres", "ENVTEST_HOST": "db.local"},
+			"missing environment variables for postgres: ENVTEST_USER, ENVTEST_NAME"},
+		{"sqlite name", map[string]string{"ENVTEST_DRIVER": "sqlite"},
+			"missing environment variables for sqlite: ENVTEST_NAME"},
+		{"driver", map[string]string{"ENVTEST_DRIVER": "oracle", "ENVTEST_NAME": "app"}, "unsupported database driver"},
+		{"debug", map[string]string{"ENVTEST_DRIVER": "sqlite", "ENVTEST_NAME": "app.db", "ENVTEST_DEBUG": "yes"},
+			"invalid ENVTEST_DEBUG"},
+		{"sslmode", map[string]string{"ENVTEST_DRIVER": "postgres", "ENVTEST_HOST": "db.local", "ENVTEST_USER": "user",
+			"ENVTEST_NAME": "app", "ENVTEST_SSLMODE": "on"}, "invalid postgres sslmode"},
+		{"sqlite sslmode", map[string]string{"ENVTEST_DRIVER": "sqlite", "ENVTEST_NAME": "app.db",
+			"ENVTEST_SSLMODE": "require"}, "sqlite has no sslmode, unset ENVTEST_SSLMODE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.vars)
+			if _, err := NewFromEnv("ENVTEST"); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewFromEnv() error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package dbwrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type configFile struct {
+	Databases []Config `json:"databases" yaml:"databases"`
+}
+
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func expandEnv(s string) string {
+	return envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		return os.Getenv(ref[2 : len(ref)-1])
+	})
+}
+
+// expandYAMLEnv expands the ${ENV_VAR} references of the scalars of n. The type of an unquoted scalar is
+// resolved again from its value, so that e.g. max_open_conns: ${MAX_CONNS} decodes as an int.
+func expandYAMLEnv(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode {
+		if expanded := expandEnv(n.Value); expanded != n.Value {
+			n.Value = expanded
+			if n.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) == 0 {
+				n.Tag = ""
+			}
+		}
+		return
+	}
+	for _, child := range n.Content {
+		expandYAMLEnv(child)
+	}
+}
+
+// expandJSONEnv expands the ${ENV_VAR} references of data, escaping their values for JSON strings. A reference
+// outside of quotes, e.g. "max_open_conns": ${MAX_CONNS}, is replaced by its value as is.
+func expandJSONEnv(data []byte) []byte {
+	return envRefPattern.ReplaceAllFunc(data, func(ref []byte) []byte {
+		quoted, _ := json.Marshal(os.Getenv(string(ref[2 : len(ref)-1])))
+		return quoted[1 : len(quoted)-1]
+	})
+}
+
+// jsonConfig is a Config as written in a JSON config file, where the durations are strings like the ones of
+// YAML, e.g. "30s".
+type jsonConfig struct {
+	Config
+	ConnMaxLifetime string `json:"conn_max_lifetime,omitempty"`
+	ConnMaxIdleTime string `json:"conn_max_idle_time,omitempty"`
+}
+
+func parseFileDuration(s string) (time.Duration, error) {
+	if len(s) <= 0 {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// LoadConfigFile reads the databases of a YAML or JSON config file, after expanding the ${ENV_VAR} references
+// of its values.
+func LoadConfigFile(path string) ([]Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var databases []Config
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		databases, err = decodeYAMLConfigs(data)
+	case ".json":
+		databases, err = decodeJSONConfigs(expandJSONEnv(data))
+	default:
+		return nil, fmt.Errorf("dbwrap: unsupported config file extension %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dbwrap: parse %s: %w", path, err)
+	}
+	return databases, nil
+}
+
+func decodeYAMLConfigs(data []byte) ([]Config, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	expandYAMLEnv(&root)
+	var file configFile
+	if err := root.Decode(&file); err != nil {
+		return nil, yamlFieldError(&root, err)
+	}
+	return file.Databases, nil
+}
+
+// yamlFieldError names the database field failing to decode, which the errors of yaml leave out.
+func yamlFieldError(root *yaml.Node, err error) error {
+	doc := root
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	var databases *yaml.Node
+	for i := 0; doc.Kind == yaml.MappingNode && i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "databases" {
+			databases = doc.Content[i+1]
+		}
+	}
+	if databases == nil || databases.Kind != yaml.SequenceNode {
+		return err
+	}
+	for i, db := range databases.Content {
+		for j := 0; db.Kind == yaml.MappingNode && j+1 < len(db.Content); j += 2 {
+			field := &yaml.Node{Kind: yaml.MappingNode, Content: db.Content[j : j+2]}
+			var cfg Config
+			if fieldErr := field.Decode(&cfg); fieldErr != nil {
+				return fmt.Errorf("databases[%d].%s: %w", i, db.Content[j].Value, fieldErr)
+			}
+		}
+	}
+	return err
+}
+
+func decodeJSONConfigs(data []byte) ([]Config, error) {
+	var file struct {
+		Databases []jsonConfig `json:"databases"`
+	}
+	if err := unmarshalJSON(data, &file); err != nil {
+		return nil, err
+	}
+	databases := make([]Config, 0, len(file.Databases))
+	for i, cfg := range file.Databases {
+		var err error
+		if cfg.Config.ConnMaxLifetime, err = parseFileDuration(cfg.ConnMaxLifetime); err != nil {
+			return nil, fmt.Errorf("databases[%d].conn_max_lifetime: %w", i, err)
+		}
+		if cfg.Config.ConnMaxIdleTime, err = parseFileDuration(cfg.ConnMaxIdleTime); err != nil {
+			return nil, fmt.Errorf("databases[%d].conn_max_idle_time: %w", i, err)
+		}
+		databases = append(databases, cfg.Config)
+	}
+	return databases, nil
+}
+
+func unmarshalJSON(data []byte, v interface{}) error {
+	err := json.Unmarshal(data, v)
+	var offset int64
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	} else if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else {
+		return err
+	}
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	return fmt.Errorf("line %d: %w", line, err)
+}
+
+func NewFromConfigFile(path, label string) (*DbMgt, error) {
+	configs, err := LoadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, cfg := range configs {
+		if cfg.Label == label {
+			return NewFromConfig(cfg)
+		}
+	}
+	return nil, fmt.Errorf("dbwrap: no database %q in %s", label, path)
+}
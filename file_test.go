@@ -0,0 +1,117 @@
+package dbwrap
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a file named name in a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var testFileEnv = map[string]string{"FILETEST_HOST": "db.local", "FILETEST_PASSWORD": "0123 \"#: x",
+	"FILETEST_CONNS": "20", "FILETEST_DEBUG": "true", "FILETEST_LIFETIME": "5m", "FILETEST_APP": "api"}
+
+var testFileConfigs = []Config{
+	{Label: "main", Driver: "postgres", Host: "db.local", Port: "5433", User: "user", Password: "0123 \"#: x",
+		Name: "app", Options: map[string]string{"application_name": "api"}, Debug: true, MaxOpenConns: 20,
+		ConnMaxLifetime: 5 * time.Minute, ConnMaxIdleTime: 30 * time.Second},
+	{Label: "cache", Driver: "sqlite", Name: "cache.db", Pragmas: map[string]string{"journal_mode": "WAL"}},
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	setEnv(t, testFileEnv)
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"app.yaml", `
+databases:
+  - label: main
+    driver: postgres
+    host: ${FILETEST_HOST}
+    port: 5433
+    user: user
+    password: "${FILETEST_PASSWORD}"
+    name: app
+    options:
+      application_name: ${FILETEST_APP}
+    debug: ${FILETEST_DEBUG}
+    max_open_conns: ${FILETEST_CONNS}
+    conn_max_lifetime: ${FILETEST_LIFETIME}
+    conn_max_idle_time: 30s
+  - label: cache
+    driver: sqlite
+    name: cache.db
+    pragmas:
+      journal_mode: WAL
+`},
+		{"app.json", `{"databases": [
+	{"label": "main", "driver": "postgres", "host": "${FILETEST_HOST}", "port": "5433", "user": "user",
+		"password": "${FILETEST_PASSWORD}", "name": "app", "options": {"application_name": "${FILETEST_APP}"},
+		"debug": ${FILETEST_DEBUG}, "max_open_conns": ${FILETEST_CONNS},
+		"conn_max_lifetime": "${FILETEST_LIFETIME}", "conn_max_idle_time": "30s"},
+	{"label": "cache", "driver": "sqlite", "name": "cache.db", "pragmas": {"journal_mode": "WAL"}}
+]}`},
+	}
+	for _, tt := range tests {
+		configs, err := LoadConfigFile(writeConfigFile(t, tt.name, tt.content))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(configs, testFileConfigs) {
+			t.Errorf("%s: LoadConfigFile() = %+v, want %+v", tt.name, configs, testFileConfigs)
+		}
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	setEnv(t, map[string]string{"FILETEST_CONNS": "many"})
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"app.toml", "", `unsupported config file extension ".toml"`},
+		{"app.yaml", "databases:\n  - driver: sqlite\n    max_open_conns: ${FILETEST_CONNS}\n",
+			"databases[0].max_open_conns:"},
+		{"app.yml", "databases:\n  - driver: sqlite\n  - driver: sqlite\n    conn_max_idle_time: soon\n",
+			"databases[1].conn_max_idle_time:"},
+		{"app.yaml", "databases: [", "yaml:"},
+		{"app.json", `{"databases": [{"driver": "sqlite", "max_open_conns": "${FILETEST_CONNS}"}]}`,
+			"max_open_conns"},
+		{"app.json", `{"databases": [{"driver": "sqlite"}, {"conn_max_lifetime": "soon"}]}`,
+			"databases[1].conn_max_lifetime:"},
+		{"app.json", "{\"databases\": [\n{\"driver\": sqlite}]}", "line 2:"},
+	}
+	for _, tt := range tests {
+		_, err := LoadConfigFile(writeConfigFile(t, tt.name, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %q: LoadConfigFile() error %v, want %q", tt.name, tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestNewFromConfigFile(t *testing.T) {
+	path := writeConfigFile(t, "app.yaml", "databases:\n  - label: cache\n    driver: sqlite\n    name: cache.db\n")
+	c, err := NewFromConfigFile(path, "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.UnsafeDSN(); got != "cache.db" {
+		t.Errorf("UnsafeDSN() = %q, want %q", got, "cache.db")
+	}
+	if _, err = NewFromConfigFile(path, "main"); err == nil || !strings.Contains(err.Error(), `no database "main"`) {
+		t.Errorf("NewFromConfigFile() error %v, want no database", err)
+	}
+}
@@ -3,13 +3,18 @@ module github.com/sqos/dbwrap/v2
 go 1.15
 
 require (
-	github.com/denisenkom/go-mssqldb v0.10.0 // indirect
-	github.com/jackc/pgproto3/v2 v2.0.7 // indirect
-	github.com/mattn/go-sqlite3 v1.14.7 // indirect
+	github.com/denisenkom/go-mssqldb v0.10.0
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/jackc/pgconn v1.8.1
+	github.com/jackc/pgproto3/v2 v2.0.7
+	github.com/jackc/pgx/v4 v4.11.0
+	github.com/mattn/go-sqlite3 v1.14.7
 	golang.org/x/text v0.3.8 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/mysql v1.1.0
 	gorm.io/driver/postgres v1.1.0
 	gorm.io/driver/sqlite v1.1.4
 	gorm.io/driver/sqlserver v1.0.7
 	gorm.io/gorm v1.21.10
+	gorm.io/plugin/dbresolver v1.1.0
 )
@@ -0,0 +1,148 @@
+package dbwrap
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ErrAlreadyOpen is returned by the settings that only take effect when the database is opened.
+var ErrAlreadyOpen = errors.New("dbwrap: the database is already open")
+
+func (c *DbMgt) updateGormConfig(fn func(cfg *gorm.Config) error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.db != nil {
+		return ErrAlreadyOpen
+	}
+	return fn(c.cfg)
+}
+
+func (c *DbMgt) updateNamingStrategy(fn func(ns *schema.NamingStrategy)) error {
+	return c.updateGormConfig(func(cfg *gorm.Config) error {
+		var ns schema.NamingStrategy
+		switch current := cfg.NamingStrategy.(type) {
+		case nil:
+		case schema.NamingStrategy:
+			ns = current
+		case *schema.NamingStrategy:
+			ns = *current
+		default:
+			return errors.New("dbwrap: a custom naming strategy is configured, set the table naming on it instead")
+		}
+		fn(&ns)
+		cfg.NamingStrategy = ns
+		return nil
+	})
+}
+
+// SetTablePrefix prefixes every table name, e.g. "billing_" turns User into billing_users. The schema of
+// SetPgSchema is kept.
+func (c *DbMgt) SetTablePrefix(prefix string) error {
+	return c.updateNamingStrategy(func(ns *schema.NamingStrategy) {
+		ns.TablePrefix = c.pgSchemaPrefix() + prefix
+	})
+}
+
+func (c *DbMgt) SetSingularTable(singular bool) error {
+	return c.updateNamingStrategy(func(ns *schema.NamingStrategy) {
+		ns.SingularTable = singular
+	})
+}
+
+// SetNamingStrategy replaces the whole naming strategy, SetTablePrefix and SetSingularTable only apply to
+// gorm's schema.NamingStrategy.
+func (c *DbMgt) SetNamingStrategy(namer schema.Namer) error {
+	return c.updateGormConfig(func(cfg *gorm.Config) error {
+		cfg.NamingStrategy = namer
+		return nil
+	})
+}
+
+func (c *DbMgt) SetSkipDefaultTransaction(skip bool) error {
+	return c.updateGormConfig(func(cfg *gorm.Config) error {
+		cfg.SkipDefaultTransaction = skip
+		return nil
+	})
+}
+
+func (c *DbMgt) SetFullSaveAssociations(full bool) error {
+	return c.updateGormConfig(func(cfg *gorm.Config) error {
+		cfg.FullSaveAssociations = full
+		return nil
+	})
+}
+
+// SetCreateBatchSize makes Create insert slices in batches of size rows, 0 inserts them at once.
+func (c *DbMgt) SetCreateBatchSize(size int) error {
+	if size < 0 {
+		return errors.New("dbwrap: create batch size must not be negative")
+	}
+	return c.updateGormConfig(func(cfg *gorm.Config) error {
+		cfg.CreateBatchSize = size
+		return nil
+	})
+}
+
+func (c *DbMgt) SetDisableFKWhenMigrating(disable bool) error {
+	return c.updateGormConfig(func(cfg *gorm.Config) error {
+		cfg.DisableForeignKeyConstraintWhenMigrating = disable
+		return nil
+	})
+}
+
+// SetPrepareStmt overrides the prepared statement cache, which New enables by default. Turn it off behind
+// pgbouncer in transaction pooling mode. The setting is kept across Reopen.
+func (c *DbMgt) SetPrepareStmt(enabled bool) error {
+	return c.updateGormConfig(func(cfg *gorm.Config) error {
+		cfg.PrepareStmt = enabled
+		return nil
+	})
+}
+
+// SetNowFunc sets the clock used for CreatedAt and UpdatedAt, e.g. a frozen one in tests. Like the other gorm
+// settings it must be called before Open and returns ErrAlreadyOpen afterwards.
+func (c *DbMgt) SetNowFunc(fn func() time.Time) error {
+	return c.updateGormConfig(func(cfg *gorm.Config) error {
+		cfg.NowFunc = fn
+		return nil
+	})
+}
+
+func SetTablePrefix(prefix string) error {
+	return DefaultDbMgt().SetTablePrefix(prefix)
+}
+
+func SetSingularTable(singular bool) error {
+	return DefaultDbMgt().SetSingularTable(singular)
+}
+
+func SetNamingStrategy(namer schema.Namer) error {
+	return DefaultDbMgt().SetNamingStrategy(namer)
+}
+
+func SetSkipDefaultTransaction(skip bool) error {
+	return DefaultDbMgt().SetSkipDefaultTransaction(skip)
+}
+
+func SetFullSaveAssociations(full bool) error {
+	return DefaultDbMgt().SetFullSaveAssociations(full)
+}
+
+func SetCreateBatchSize(size int) error {
+	return DefaultDbMgt().SetCreateBatchSize(size)
+}
+
+func SetDisableFKWhenMigrating(disable bool) error {
+	return DefaultDbMgt().SetDisableFKWhenMigrating(disable)
+}
+
+func SetPrepareStmt(enabled bool) error {
+	return DefaultDbMgt().SetPrepareStmt(enabled)
+}
+
+func SetNowFunc(fn func() time.Time) error {
+	return DefaultDbMgt().SetNowFunc(fn)
+}
@@ -0,0 +1,142 @@
+package dbwrap
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func TestTableNaming(t *testing.T) {
+	tests := []struct {
+		name   string
+		set    func(c *DbMgt) error
+		tables []string
+	}{
+		{"default", func(*DbMgt) error { return nil }, []string{"test_users"}},
+		{"prefix", func(c *DbMgt) error { return c.SetTablePrefix("billing_") }, []string{"billing_test_users"}},
+		{"singular", func(c *DbMgt) error { return c.SetSingularTable(true) }, []string{"test_user"}},
+		{"both", func(c *DbMgt) error {
+			if err := c.SetSingularTable(true); err != nil {
+				return err
+			}
+			return c.SetTablePrefix("billing_")
+		}, []string{"billing_test_user"}},
+		{"naming strategy", func(c *DbMgt) error {
+			return c.SetNamingStrategy(schema.NamingStrategy{TablePrefix: "app_"})
+		}, []string{"app_test_users"}},
+	}
+	for _, tt := range tests {
+		c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+		if err := tt.set(c); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := c.Open(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Migrate(&testUser{}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		tables, err := c.ListTables()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(tables)
+		if !reflect.DeepEqual(tables, tt.tables) {
+			t.Errorf("%s: tables = %v, want %v", tt.name, tables, tt.tables)
+		}
+		c.Close()
+	}
+}
+
+type upperNamer struct {
+	schema.NamingStrategy
+}
+
+func TestTableNamingCustomNamer(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param("test.db")
+	if err := c.SetNamingStrategy(upperNamer{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetTablePrefix("billing_"); err == nil {
+		t.Error("SetTablePrefix changed a custom naming strategy")
+	}
+	if err := c.SetSingularTable(true); err == nil {
+		t.Error("SetSingularTable changed a custom naming strategy")
+	}
+}
+
+func TestGormConfigFlags(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	for _, err := range []error{
+		c.SetSkipDefaultTransaction(true),
+		c.SetFullSaveAssociations(true),
+		c.SetCreateBatchSize(100),
+		c.SetDisableFKWhenMigrating(true),
+		c.SetPrepareStmt(false),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.SetCreateBatchSize(-1); err == nil {
+		t.Error("SetCreateBatchSize accepted a negative size")
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	cfg := c.Db().Config
+	if !cfg.SkipDefaultTransaction || !cfg.FullSaveAssociations || cfg.CreateBatchSize != 100 ||
+		!cfg.DisableForeignKeyConstraintWhenMigrating || cfg.PrepareStmt {
+		t.Errorf("the flags did not reach the open database: %+v", cfg)
+	}
+	if _, ok := c.Db().ConnPool.(*gorm.PreparedStmtDB); ok {
+		t.Error("the prepared statement cache is on")
+	}
+	if err := c.SetSkipDefaultTransaction(false); err != ErrAlreadyOpen {
+		t.Errorf("SetSkipDefaultTransaction after Open = %v, want ErrAlreadyOpen", err)
+	}
+	if !c.Db().Config.SkipDefaultTransaction {
+		t.Error("a setting changed the open database")
+	}
+}
+
+type testStamped struct {
+	ID        uint
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func TestNowFunc(t *testing.T) {
+	frozen := time.Date(2024, 2, 29, 12, 30, 0, 0, time.UTC)
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.SetNowFunc(func() time.Time { return frozen }); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Migrate(&testStamped{}); err != nil {
+		t.Fatal(err)
+	}
+	record := testStamped{}
+	if err := c.Db().Create(&record).Error; err != nil {
+		t.Fatal(err)
+	}
+	var stored testStamped
+	if err := c.Db().First(&stored, record.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !stored.CreatedAt.Equal(frozen) || !stored.UpdatedAt.Equal(frozen) {
+		t.Errorf("CreatedAt %s, UpdatedAt %s, want %s", stored.CreatedAt, stored.UpdatedAt, frozen)
+	}
+	if err := c.SetNowFunc(time.Now); err != ErrAlreadyOpen {
+		t.Errorf("SetNowFunc after Open = %v, want ErrAlreadyOpen", err)
+	}
+}
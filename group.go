@@ -0,0 +1,118 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Group manages several DbMgt together, each one named by its Config Label, or by its position when unlabeled.
+type Group struct {
+	lock    sync.Mutex
+	members []*DbMgt
+}
+
+// MemberError is the error of one Group member.
+type MemberError struct {
+	Name string
+	Err  error
+}
+
+func (e *MemberError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+func (e *MemberError) Unwrap() error {
+	return e.Err
+}
+
+func NewGroup(members ...*DbMgt) *Group {
+	return &Group{members: members}
+}
+
+func (g *Group) Add(mgt *DbMgt) *Group {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.members = append(g.members, mgt)
+	return g
+}
+
+func (g *Group) Members() []*DbMgt {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return append([]*DbMgt(nil), g.members...)
+}
+
+func memberName(i int, mgt *DbMgt) string {
+	if label := mgt.Config().Label; len(label) > 0 {
+		return label
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// each runs fn on every member concurrently and returns the failures as a MultiError of *MemberError.
+func (g *Group) each(fn func(name string, mgt *DbMgt) error) error {
+	members := g.Members()
+	errs := make([]error, len(members))
+	var wg sync.WaitGroup
+	for i, mgt := range members {
+		wg.Add(1)
+		go func(i int, mgt *DbMgt) {
+			defer wg.Done()
+			name := memberName(i, mgt)
+			if err := fn(name, mgt); err != nil {
+				errs[i] = &MemberError{Name: name, Err: err}
+			}
+		}(i, mgt)
+	}
+	wg.Wait()
+	var multi MultiError
+	for _, err := range errs {
+		if err != nil {
+			multi = append(multi, err)
+		}
+	}
+	return multi.errorOrNil()
+}
+
+// OpenAll opens the members in parallel. The members that opened stay open when others fail.
+func (g *Group) OpenAll(ctx context.Context) error {
+	return g.each(func(_ string, mgt *DbMgt) error {
+		return mgt.OpenContext(ctx)
+	})
+}
+
+func (g *Group) CloseAll() error {
+	return g.each(func(_ string, mgt *DbMgt) error {
+		return mgt.Close()
+	})
+}
+
+func (g *Group) MigrateAll(ctx context.Context) error {
+	return g.each(func(_ string, mgt *DbMgt) error {
+		return mgt.MigrateContext(ctx)
+	})
+}
+
+// KeepaliveAll runs Keepalive for every member until ctx is done.
+func (g *Group) KeepaliveAll(ctx context.Context, interval time.Duration) {
+	g.each(func(_ string, mgt *DbMgt) error {
+		mgt.Keepalive(ctx, interval)
+		return nil
+	})
+}
+
+// HealthCheckAll returns the HealthCheck result of every member by name, nil for the healthy ones.
+func (g *Group) HealthCheckAll(ctx context.Context) map[string]error {
+	health := make(map[string]error)
+	var lock sync.Mutex
+	g.each(func(name string, mgt *DbMgt) error {
+		err := mgt.HealthCheck(ctx)
+		lock.Lock()
+		defer lock.Unlock()
+		health[name] = err
+		return nil
+	})
+	return health
+}
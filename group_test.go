@@ -0,0 +1,74 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newSqliteMember(t *testing.T, label, path string) *DbMgt {
+	t.Helper()
+	c, err := NewFromConfig(Config{Label: label, Driver: driverSqlite, Name: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestGroupPartialFailure(t *testing.T) {
+	dir := t.TempDir()
+	orders := newSqliteMember(t, "orders", filepath.Join(dir, "orders.db"))
+	// a directory is no database file
+	analytics := newSqliteMember(t, "analytics", dir)
+	audit := New(false, nil).SetSqlite3Param(filepath.Join(dir, "audit.db"))
+	g := NewGroup(orders, analytics).Add(audit)
+	defer g.CloseAll()
+
+	err := g.OpenAll(context.Background())
+	multi, ok := err.(MultiError)
+	if !ok || len(multi) != 1 {
+		t.Fatalf("OpenAll() = %v, want the error of a single member", err)
+	}
+	var member *MemberError
+	if !errors.As(multi[0], &member) || member.Name != "analytics" || member.Err == nil {
+		t.Errorf("OpenAll() = %v, want the error of analytics", err)
+	}
+	if !orders.IsOpen() || !audit.IsOpen() || analytics.IsOpen() {
+		t.Errorf("open: orders %v, analytics %v, audit %v, want all but analytics",
+			orders.IsOpen(), analytics.IsOpen(), audit.IsOpen())
+	}
+
+	orders.Register(&testUser{})
+	audit.Register(&testOrder{})
+	err = g.MigrateAll(context.Background())
+	if multi, ok = err.(MultiError); !ok || len(multi) != 1 || !errors.Is(multi[0], ErrNotOpened) {
+		t.Errorf("MigrateAll() = %v, want ErrNotOpened for analytics only", err)
+	}
+	if has, err := orders.HasTable(&testUser{}); err != nil || !has {
+		t.Errorf("HasTable() = %v, %v on orders, want the table migrated", has, err)
+	}
+
+	health := g.HealthCheckAll(context.Background())
+	if len(health) != 3 || health["orders"] != nil || health["#2"] != nil ||
+		!errors.Is(health["analytics"], ErrNotOpened) {
+		t.Errorf("HealthCheckAll() = %v, want analytics down only", health)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	g.KeepaliveAll(ctx, 10*time.Millisecond)
+	if orders.Health().State != HealthUp || analytics.Health().State == HealthUp {
+		t.Errorf("health: orders %s, analytics %s", orders.Health().State, analytics.Health().State)
+	}
+
+	if err = g.CloseAll(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range g.Members() {
+		if c.IsOpen() {
+			t.Errorf("%s is still open after CloseAll", c.DSN())
+		}
+	}
+}
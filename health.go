@@ -0,0 +1,126 @@
+package dbwrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrNotOpened is returned when the database is used before Open succeeded or after Close.
+var ErrNotOpened = errors.New("dbwrap: database is not open")
+
+// Ping checks the connection, and that at least one replica answers when SetReplicas is used, for at most
+// 5 seconds unless ctx has a deadline. It returns ErrNotOpened when the database is not open.
+func (c *DbMgt) Ping(ctx context.Context) error {
+	gormDB, err := c.dbE(false)
+	if err != nil {
+		return err
+	}
+	db, err := gormDB.DB()
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxPingTimeout)
+		defer cancel()
+	}
+	if err = db.PingContext(ctx); err != nil {
+		return err
+	}
+	if set := c.replicaSet(); set != nil {
+		return set.ping(ctx)
+	}
+	return nil
+}
+
+// HealthCheck is Ping with an error naming the driver and the redacted connection target.
+func (c *DbMgt) HealthCheck(ctx context.Context) error {
+	if err := c.Ping(ctx); errors.Is(err, ErrNotOpened) {
+		return fmt.Errorf("%w (%s)", err, c.target())
+	} else if err != nil {
+		return fmt.Errorf("dbwrap: ping %s: %w", c.target(), err)
+	}
+	return nil
+}
+
+func (c *DbMgt) Healthy() bool {
+	return c.HealthCheck(context.Background()) == nil
+}
+
+func (c *DbMgt) target() string {
+	driver := c.DriverName()
+	if dsn := c.DSN(); len(dsn) > 0 {
+		return driver + " " + dsn
+	}
+	return driver
+}
+
+type healthReport struct {
+	Status          string  `json:"status"`
+	Driver          string  `json:"driver"`
+	OpenConnections int     `json:"open_connections"`
+	PingMs          float64 `json:"ping_ms"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// HealthHandler serves the health of the database as JSON, with status 503 when it is down. While Keepalive runs
+// its last result is reported, otherwise every request pings the database.
+func (c *DbMgt) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := healthReport{Status: HealthUp.String(), Driver: c.DriverName()}
+		var err error
+		var latency time.Duration
+		if status, ok := c.keepaliveHealth(); ok {
+			err, latency = status.LastError, status.Latency
+		} else {
+			start := time.Now()
+			err = c.HealthCheck(r.Context())
+			latency = time.Since(start)
+		}
+		if gormDB, err := c.dbE(false); err == nil {
+			if db, err := gormDB.DB(); err == nil {
+				report.OpenConnections = db.Stats().OpenConnections
+			}
+		}
+		code := http.StatusOK
+		if err != nil {
+			code = http.StatusServiceUnavailable
+			report.Status, report.Error = HealthDown.String(), err.Error()
+		} else {
+			report.PingMs = float64(latency) / float64(time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// keepaliveHealth returns the status of a running Keepalive, unless the database was closed since its last ping.
+func (c *DbMgt) keepaliveHealth() (HealthStatus, bool) {
+	if !c.IsOpen() {
+		return HealthStatus{}, false
+	}
+	c.healthLock.Lock()
+	defer c.healthLock.Unlock()
+	return c.health, c.keepalives > 0 && c.health.State != HealthUnknown
+}
+
+func HealthHandler() http.Handler {
+	return DefaultDbMgt().HealthHandler()
+}
+
+func Ping(ctx context.Context) error {
+	return DefaultDbMgt().Ping(ctx)
+}
+
+func HealthCheck(ctx context.Context) error {
+	return DefaultDbMgt().HealthCheck(ctx)
+}
+
+func Healthy() bool {
+	return DefaultDbMgt().Healthy()
+}
@@ -0,0 +1,158 @@
+package dbwrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPingNotOpened(t *testing.T) {
+	c := New(false, nil).SetPgParam("localhost", "", "user", "s3cret", "app", false)
+	if err := c.Ping(context.Background()); err != ErrNotOpened {
+		t.Errorf("Ping() = %v, want ErrNotOpened", err)
+	}
+	err := c.HealthCheck(context.Background())
+	if !errors.Is(err, ErrNotOpened) || !strings.Contains(err.Error(), "postgres host=localhost") {
+		t.Errorf("HealthCheck() = %v, want ErrNotOpened naming the target", err)
+	}
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("HealthCheck() = %v leaks the password", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() = %v", err)
+	}
+	if !c.Healthy() {
+		t.Error("Healthy() = false")
+	}
+	server := newFakePgServer(t, false)
+	c = New(false, nil).SetPgParam(server.host(), server.port(), "user", "", "app", false)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() = %v against the fake server", err)
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	server := newFakePgServer(t, false)
+	c := New(false, nil).SetPgParam(server.host(), server.port(), "user", "", "app", false)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	atomic.StoreInt32(&server.hang, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := c.Ping(ctx)
+	if err == nil {
+		t.Fatal("Ping succeeded against a hanging server")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Ping returned after %s, want the deadline of the context", elapsed)
+	}
+	if err = c.HealthCheck(ctx); err == nil || !strings.HasPrefix(err.Error(), "dbwrap: ping postgres ") {
+		t.Errorf("HealthCheck() = %v, want the ping error naming the target", err)
+	}
+}
+
+// serveHealth returns the status code and the report of a request to the HealthHandler of c.
+func serveHealth(t *testing.T, c *DbMgt) (int, healthReport) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c.HealthHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var report healthReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("body %q: %v", w.Body.String(), err)
+	}
+	return w.Code, report
+}
+
+func TestHealthHandler(t *testing.T) {
+	c := openSqlite(t)
+	code, report := serveHealth(t, c)
+	if code != http.StatusOK || report.Status != "up" || report.Driver != "sqlite" || report.OpenConnections < 1 ||
+		report.PingMs < 0 || len(report.Error) > 0 {
+		t.Errorf("HealthHandler() = %d %+v, want 200 up", code, report)
+	}
+	c.Close()
+	code, report = serveHealth(t, c)
+	if code != http.StatusServiceUnavailable || report.Status != "down" || report.OpenConnections != 0 ||
+		!strings.Contains(report.Error, ErrNotOpened.Error()) {
+		t.Errorf("HealthHandler() after Close = %d %+v, want 503 not open", code, report)
+	}
+	code, report = serveHealth(t, New(false, nil).SetSqlite3Param("never.db"))
+	if code != http.StatusServiceUnavailable || !strings.Contains(report.Error, ErrNotOpened.Error()) {
+		t.Errorf("HealthHandler() before Open = %d %+v, want 503 not open", code, report)
+	}
+}
+
+func TestHealthHandlerKeepalive(t *testing.T) {
+	c := openSqlite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Keepalive(ctx, time.Hour)
+	waitFor(t, "the keepalive", func() bool {
+		c.healthLock.Lock()
+		defer c.healthLock.Unlock()
+		return c.keepalives > 0
+	})
+	// the database answers, only the cached status says otherwise
+	c.recordPing(errors.New("cached failure"), 0)
+	if code, report := serveHealth(t, c); code != http.StatusServiceUnavailable || report.Error != "cached failure" {
+		t.Errorf("HealthHandler() = %d %+v, want the cached failure", code, report)
+	}
+	c.recordPing(nil, 3*time.Millisecond)
+	if code, report := serveHealth(t, c); code != http.StatusOK || report.PingMs != 3 {
+		t.Errorf("HealthHandler() = %d %+v, want the cached 3ms ping", code, report)
+	}
+}
+
+func TestHealthAfterClose(t *testing.T) {
+	c := openSqlite(t)
+	var lock sync.Mutex
+	var states []HealthState
+	c.SetHealthChangeHook(func(_, new HealthState, _ error) {
+		lock.Lock()
+		defer lock.Unlock()
+		states = append(states, new)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Keepalive(ctx, 5*time.Millisecond)
+	waitFor(t, "the up state", func() bool { return c.Health().State == HealthUp })
+	c.Close()
+	if code, report := serveHealth(t, c); code != http.StatusServiceUnavailable {
+		t.Errorf("HealthHandler() after Close = %d %+v, want 503", code, report)
+	}
+	waitFor(t, "the down state", func() bool { return c.Health().State == HealthDown })
+	status := c.Health()
+	if !errors.Is(status.LastError, ErrNotOpened) || status.ConsecutiveFailures != 0 {
+		t.Errorf("status after Close = %+v, want down with ErrNotOpened and no failure", status)
+	}
+	if failures := c.Counters().PingFailures; failures != 0 {
+		t.Errorf("%d ping failures counted, want none for a closed database", failures)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if want := []HealthState{HealthUp, HealthDown}; !reflect.DeepEqual(states, want) {
+		t.Errorf("health transitions = %v, want %v", states, want)
+	}
+}
@@ -0,0 +1,62 @@
+package dbwrap
+
+import "gorm.io/gorm"
+
+// RegisterOnOpen runs fn, in registration order, each time a connection pool is established by Open or Reopen.
+// An error fails the Open and closes the new pool. Hooks run with the instance locked, so they must use the
+// given db rather than the DbMgt methods.
+func (c *DbMgt) RegisterOnOpen(fn func(db *gorm.DB) error) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.onOpen = append(c.onOpen, fn)
+	return c
+}
+
+// RegisterOnClose runs fn before the connection pool is closed by Close or replaced by Reopen.
+func (c *DbMgt) RegisterOnClose(fn func() error) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.onClose = append(c.onClose, fn)
+	return c
+}
+
+func (c *DbMgt) runOpenHooks(db *gorm.DB) error {
+	for _, fn := range c.onOpen {
+		if err := fn(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCloseHooks runs every hook and returns the first error.
+func (c *DbMgt) runCloseHooks() error {
+	var first error
+	for _, fn := range c.onClose {
+		if err := fn(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func closeGormDB(db *gorm.DB) error {
+	if set := replicasOf(db); set != nil {
+		if err := set.close(); err != nil {
+			return err
+		}
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func RegisterOnOpen(fn func(db *gorm.DB) error) *DbMgt {
+	return DefaultDbMgt().RegisterOnOpen(fn)
+}
+
+func RegisterOnClose(fn func() error) *DbMgt {
+	return DefaultDbMgt().RegisterOnClose(fn)
+}
@@ -0,0 +1,213 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// IndexOptions tunes the index EnsureIndex creates.
+type IndexOptions struct {
+	Unique bool
+	// Where makes a partial index on postgres and sqlite, a filtered one on sqlserver. It is raw SQL.
+	Where string
+	// Concurrently builds the index on postgres without locking the table against writes, on a dedicated
+	// connection since it cannot run in a transaction.
+	Concurrently bool
+}
+
+// IndexInfo describes an index of a live table, its columns in index order.
+type IndexInfo struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	Primary bool
+}
+
+// EnsureIndex creates the index name on columns of the table of model unless it exists, model being a model
+// or a table name.
+func (c *DbMgt) EnsureIndex(model interface{}, name string, columns []string, opts IndexOptions) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	table, err := tableOf(db, model)
+	if err != nil {
+		return err
+	}
+	if db.Migrator().HasIndex(model, name) {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	create, err := createIndexSQL(db.Dialector.Name(), stmt.Quote, table, name, columns, opts)
+	if err != nil {
+		return err
+	}
+	if !opts.Concurrently {
+		if err = db.Exec(create).Error; err != nil {
+			return fmt.Errorf("dbwrap: create index %s: %w", name, err)
+		}
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, create); err != nil {
+		// a failed concurrent build leaves an invalid index behind
+		conn.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+stmt.Quote(indexName(table, name)))
+		return fmt.Errorf("dbwrap: create index %s: %w", name, err)
+	}
+	return nil
+}
+
+// DropIndex drops the index name of the table of model, model being a model or a table name.
+func (c *DbMgt) DropIndex(model interface{}, name string) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	if _, err = tableOf(db, model); err != nil {
+		return err
+	}
+	if err = db.Migrator().DropIndex(model, name); err != nil {
+		return fmt.Errorf("dbwrap: drop index %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListIndexes returns the indexes of the table of model sorted by name, model being a model or a table name.
+func (c *DbMgt) ListIndexes(model interface{}) ([]IndexInfo, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return nil, err
+	}
+	return listIndexes(db, model)
+}
+
+func listIndexes(db *gorm.DB, model interface{}) ([]IndexInfo, error) {
+	table, err := tableOf(db, model)
+	if err != nil {
+		return nil, err
+	}
+	schema, name := splitTable(table)
+	var rows *sql.Rows
+	switch db.Dialector.Name() {
+	case driverSqlite:
+		rows, err = db.Raw("SELECT il.name, il.\"unique\", il.origin = 'pk', ii.name FROM pragma_index_list(?) il "+
+			"JOIN pragma_index_info(il.name) ii ORDER BY il.name, ii.seqno", table).Rows()
+	case driverPostgres:
+		current := "CURRENT_SCHEMA()"
+		args := []interface{}{name}
+		if len(schema) > 0 {
+			current, args = "?", []interface{}{name, schema}
+		}
+		rows, err = db.Raw("SELECT i.relname, ix.indisunique, ix.indisprimary, a.attname FROM pg_index ix "+
+			"JOIN pg_class t ON t.oid = ix.indrelid JOIN pg_class i ON i.oid = ix.indexrelid "+
+			"JOIN pg_namespace n ON n.oid = t.relnamespace "+
+			"JOIN unnest(ix.indkey) WITH ORDINALITY k(attnum, ord) ON true "+
+			"JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum "+
+			"WHERE t.relname = ? AND n.nspname = "+current+" ORDER BY i.relname, k.ord", args...).Rows()
+	case driverMysql:
+		rows, err = db.Raw("SELECT index_name, non_unique = 0, index_name = 'PRIMARY', column_name "+
+			"FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? "+
+			"ORDER BY index_name, seq_in_index", name).Rows()
+	case driverSqlServer:
+		rows, err = db.Raw("SELECT i.name, i.is_unique, i.is_primary_key, c.name FROM sys.indexes i "+
+			"JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id "+
+			"JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id "+
+			"WHERE i.object_id = OBJECT_ID(?) AND i.name IS NOT NULL ORDER BY i.name, ic.key_ordinal", table).Rows()
+	default:
+		return nil, fmt.Errorf("dbwrap: ListIndexes does not support %s", db.Dialector.Name())
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var indexes []IndexInfo
+	for rows.Next() {
+		var idx IndexInfo
+		var column string
+		if err = rows.Scan(&idx.Name, &idx.Unique, &idx.Primary, &column); err != nil {
+			return nil, err
+		}
+		if n := len(indexes); n > 0 && indexes[n-1].Name == idx.Name {
+			indexes[n-1].Columns = append(indexes[n-1].Columns, column)
+			continue
+		}
+		idx.Columns = []string{column}
+		indexes = append(indexes, idx)
+	}
+	return indexes, rows.Err()
+}
+
+// createIndexSQL returns the statement creating the index name on table for driver, quoting the identifiers
+// with quote.
+func createIndexSQL(driver string, quote func(interface{}) string, table, name string, columns []string,
+	opts IndexOptions) (string, error) {
+	if len(name) <= 0 {
+		return "", errors.New("dbwrap: index without name")
+	}
+	if len(columns) <= 0 {
+		return "", fmt.Errorf("dbwrap: index %s without columns", name)
+	}
+	switch driver {
+	case driverPostgres, driverSqlite, driverSqlServer:
+	case driverMysql:
+		if len(opts.Where) > 0 {
+			return "", errors.New("dbwrap: mysql has no partial indexes")
+		}
+	default:
+		return "", fmt.Errorf("dbwrap: EnsureIndex does not support %s", driver)
+	}
+	if opts.Concurrently && driver != driverPostgres {
+		return "", fmt.Errorf("dbwrap: %s cannot create an index concurrently", driver)
+	}
+	create := "CREATE "
+	if opts.Unique {
+		create += "UNIQUE "
+	}
+	create += "INDEX "
+	if opts.Concurrently {
+		create += "CONCURRENTLY "
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quote(col)
+	}
+	create += quote(name) + " ON " + quote(table) + " (" + strings.Join(quoted, ", ") + ")"
+	if len(opts.Where) > 0 {
+		create += " WHERE " + opts.Where
+	}
+	return create, nil
+}
+
+// indexName returns name in the schema of table, where postgres creates the indexes.
+func indexName(table, name string) string {
+	if schema, _ := splitTable(table); len(schema) > 0 {
+		return schema + "." + name
+	}
+	return name
+}
+
+func EnsureIndex(model interface{}, name string, columns []string, opts IndexOptions) error {
+	return DefaultDbMgt().EnsureIndex(model, name, columns, opts)
+}
+
+func DropIndex(model interface{}, name string) error {
+	return DefaultDbMgt().DropIndex(model, name)
+}
+
+func ListIndexes(model interface{}) ([]IndexInfo, error) {
+	return DefaultDbMgt().ListIndexes(model)
+}
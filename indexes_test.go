@@ -0,0 +1,91 @@
+package dbwrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreateIndexSQL(t *testing.T) {
+	quote := func(v interface{}) string {
+		return `"` + v.(string) + `"`
+	}
+	tests := []struct {
+		driver string
+		opts   IndexOptions
+		want   string
+	}{
+		{driverSqlite, IndexOptions{}, `CREATE INDEX "idx" ON "users" ("name", "email")`},
+		{driverPostgres, IndexOptions{Unique: true, Where: "deleted_at IS NULL", Concurrently: true},
+			`CREATE UNIQUE INDEX CONCURRENTLY "idx" ON "users" ("name", "email") WHERE deleted_at IS NULL`},
+		{driverMysql, IndexOptions{Unique: true}, `CREATE UNIQUE INDEX "idx" ON "users" ("name", "email")`},
+		{driverSqlServer, IndexOptions{Where: "email IS NOT NULL"},
+			`CREATE INDEX "idx" ON "users" ("name", "email") WHERE email IS NOT NULL`},
+	}
+	columns := []string{"name", "email"}
+	for _, tt := range tests {
+		got, err := createIndexSQL(tt.driver, quote, "users", "idx", columns, tt.opts)
+		if err != nil || got != tt.want {
+			t.Errorf("createIndexSQL(%s, %+v) = %s, %v, want %s", tt.driver, tt.opts, got, err, tt.want)
+		}
+	}
+	invalid := []struct {
+		driver, name string
+		columns      []string
+		opts         IndexOptions
+	}{
+		{driverSqlite, "", columns, IndexOptions{}},
+		{driverSqlite, "idx", nil, IndexOptions{}},
+		{driverMysql, "idx", columns, IndexOptions{Where: "a > 1"}},
+		{driverSqlite, "idx", columns, IndexOptions{Concurrently: true}},
+		{"clickhouse", "idx", columns, IndexOptions{}},
+	}
+	for _, tt := range invalid {
+		if got, err := createIndexSQL(tt.driver, quote, "users", tt.name, tt.columns, tt.opts); err == nil {
+			t.Errorf("createIndexSQL(%s, %q, %v, %+v) = %s, want an error", tt.driver, tt.name, tt.columns, tt.opts,
+				got)
+		}
+	}
+	if got := indexName("billing.users", "idx"); got != "billing.idx" {
+		t.Errorf("indexName() = %s, want the schema of the table", got)
+	}
+}
+
+func TestEnsureIndex(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	opts := IndexOptions{Unique: true, Where: "name <> ''"}
+	for i := 0; i < 2; i++ {
+		if err := c.EnsureIndex(&testUser{}, "idx_users_name", []string{"name"}, opts); err != nil {
+			t.Fatalf("EnsureIndex #%d: %v", i+1, err)
+		}
+	}
+	indexes, err := c.ListIndexes(&testUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IndexInfo{{Name: "idx_users_name", Columns: []string{"name"}, Unique: true}}
+	if !reflect.DeepEqual(indexes, want) {
+		t.Errorf("ListIndexes() = %+v, want %+v", indexes, want)
+	}
+	// the partial index only covers the non empty names
+	for _, name := range []string{"", "", "ann"} {
+		if err = c.Db().Create(&testUser{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = c.Db().Create(&testUser{Name: "ann"}).Error; err == nil {
+		t.Error("the unique index accepted a duplicate name")
+	}
+	err = c.EnsureIndex("test_users", "idx_users_concurrently", []string{"name"}, IndexOptions{Concurrently: true})
+	if err == nil {
+		t.Error("EnsureIndex built an index concurrently on sqlite")
+	}
+	if err = c.DropIndex(&testUser{}, "idx_users_name"); err != nil {
+		t.Fatal(err)
+	}
+	if indexes, err = c.ListIndexes("test_users"); err != nil || len(indexes) != 0 {
+		t.Errorf("ListIndexes() = %+v, %v after DropIndex, want none", indexes, err)
+	}
+}
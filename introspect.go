@@ -0,0 +1,196 @@
+package dbwrap
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ColumnInfo describes a column of a live table the same way for every driver.
+type ColumnInfo struct {
+	Name string
+	// DBType is the type name the database reports, e.g. "integer" or "character varying".
+	DBType   string
+	Nullable bool
+	// Default is the default expression as the database reports it, nil without default.
+	Default    *string
+	PrimaryKey bool
+}
+
+// HasTable reports whether the table of model exists, model being a model or a table name.
+func (c *DbMgt) HasTable(model interface{}) (bool, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return false, err
+	}
+	if _, err = tableOf(db, model); err != nil {
+		return false, err
+	}
+	return db.Migrator().HasTable(model), nil
+}
+
+// ListTables returns the tables of the current database, or schema on postgres and sqlserver, sorted by name.
+// With a table prefix configured, only the tables having it are returned.
+func (c *DbMgt) ListTables() ([]string, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return nil, err
+	}
+	return listTables(db)
+}
+
+func listTables(db *gorm.DB) ([]string, error) {
+	var query string
+	switch db.Dialector.Name() {
+	case driverSqlite:
+		query = "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name"
+	case driverPostgres:
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() " +
+			"AND table_type = 'BASE TABLE' ORDER BY table_name"
+	case driverMysql:
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() " +
+			"AND table_type = 'BASE TABLE' ORDER BY table_name"
+	case driverSqlServer:
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = SCHEMA_NAME() " +
+			"AND table_type = 'BASE TABLE' ORDER BY table_name"
+	case "clickhouse":
+		query = "SELECT name FROM system.tables WHERE database = currentDatabase() ORDER BY name"
+	default:
+		return nil, fmt.Errorf("dbwrap: ListTables does not support %s", db.Dialector.Name())
+	}
+	var tables []string
+	if err := db.Raw(query).Scan(&tables).Error; err != nil {
+		return nil, err
+	}
+	prefix := tablePrefix(db)
+	if len(prefix) <= 0 {
+		return tables, nil
+	}
+	filtered := tables[:0]
+	for _, t := range tables {
+		if strings.HasPrefix(t, prefix) {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered, nil
+}
+
+// ListColumns returns the columns of the table of model in their table order, model being a model or a table
+// name. The table has no column when it does not exist.
+func (c *DbMgt) ListColumns(model interface{}) ([]ColumnInfo, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return nil, err
+	}
+	return listColumns(db, model)
+}
+
+func listColumns(db *gorm.DB, model interface{}) ([]ColumnInfo, error) {
+	table, err := tableOf(db, model)
+	if err != nil {
+		return nil, err
+	}
+	var rows *sql.Rows
+	schema, name := splitTable(table)
+	switch db.Dialector.Name() {
+	case driverSqlite:
+		rows, err = db.Raw("SELECT name, type, \"notnull\" = 0 AND pk = 0, dflt_value, pk > 0 FROM pragma_table_info(?) "+
+			"ORDER BY cid", table).Rows()
+	case driverPostgres:
+		rows, err = db.Raw(infoSchemaColumns(schema, "CURRENT_SCHEMA()"), name).Rows()
+	case driverMysql:
+		rows, err = db.Raw(infoSchemaColumns(schema, "DATABASE()"), name).Rows()
+	case driverSqlServer:
+		rows, err = db.Raw(infoSchemaColumns(schema, "SCHEMA_NAME()"), name).Rows()
+	case "clickhouse":
+		rows, err = db.Raw("SELECT name, type, startsWith(type, 'Nullable('), "+
+			"if(default_kind = '', NULL, default_expression), is_in_primary_key FROM system.columns "+
+			"WHERE database = currentDatabase() AND table = ? ORDER BY position", table).Rows()
+	default:
+		return nil, fmt.Errorf("dbwrap: ListColumns does not support %s", db.Dialector.Name())
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []ColumnInfo
+	for rows.Next() {
+		var col ColumnInfo
+		var def sql.NullString
+		if err = rows.Scan(&col.Name, &col.DBType, &col.Nullable, &def, &col.PrimaryKey); err != nil {
+			return nil, err
+		}
+		if def.Valid {
+			col.Default = &def.String
+		}
+		col.DBType = strings.ToLower(col.DBType)
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// infoSchemaColumns queries the columns of a table of schema, or of current when schema is empty, from
+// information_schema.
+func infoSchemaColumns(schema, current string) string {
+	if len(schema) > 0 {
+		current = "'" + strings.ReplaceAll(schema, "'", "''") + "'"
+	}
+	return "SELECT c.column_name, c.data_type, CASE WHEN c.is_nullable = 'YES' THEN 1 ELSE 0 END, " +
+		"c.column_default, CASE WHEN EXISTS (SELECT 1 FROM information_schema.table_constraints tc " +
+		"JOIN information_schema.key_column_usage k ON k.constraint_name = tc.constraint_name " +
+		"AND k.table_schema = tc.table_schema AND k.table_name = tc.table_name " +
+		"WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = c.table_schema " +
+		"AND tc.table_name = c.table_name AND k.column_name = c.column_name) THEN 1 ELSE 0 END " +
+		"FROM information_schema.columns c WHERE c.table_schema = " + current + " AND c.table_name = ? " +
+		"ORDER BY c.ordinal_position"
+}
+
+// tableOf returns the table name of model, following the naming strategy of db.
+func tableOf(db *gorm.DB, model interface{}) (string, error) {
+	if name, ok := model.(string); ok {
+		return name, nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Table, nil
+}
+
+// splitTable splits the schema, e.g. the one of SetPgSchema, from a table name.
+func splitTable(table string) (string, string) {
+	if idx := strings.Index(table, "."); idx >= 0 {
+		return table[:idx], table[idx+1:]
+	}
+	return "", table
+}
+
+// tablePrefix returns the table prefix of db without the schema of SetPgSchema.
+func tablePrefix(db *gorm.DB) string {
+	var prefix string
+	switch ns := db.NamingStrategy.(type) {
+	case schema.NamingStrategy:
+		prefix = ns.TablePrefix
+	case *schema.NamingStrategy:
+		prefix = ns.TablePrefix
+	}
+	if idx := strings.LastIndex(prefix, "."); idx >= 0 {
+		prefix = prefix[idx+1:]
+	}
+	return prefix
+}
+
+func HasTable(model interface{}) (bool, error) {
+	return DefaultDbMgt().HasTable(model)
+}
+
+func ListTables() ([]string, error) {
+	return DefaultDbMgt().ListTables()
+}
+
+func ListColumns(model interface{}) ([]ColumnInfo, error) {
+	return DefaultDbMgt().ListColumns(model)
+}
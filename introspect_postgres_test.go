@@ -0,0 +1,57 @@
+//go:build postgres
+// +build postgres
+
+package dbwrap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntrospectionPostgres(t *testing.T) {
+	c := openPostgres(t)
+	if err := c.Db().Migrator().DropTable(&testColumns{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Migrate(&testColumns{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Db().Migrator().DropTable(&testColumns{})
+	if has, err := c.HasTable(&testColumns{}); err != nil || !has {
+		t.Errorf("HasTable() = %v, %v, want true", has, err)
+	}
+	tables, err := c.ListTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, table := range tables {
+		found = found || table == "test_columns"
+	}
+	if !found {
+		t.Errorf("ListTables() = %v, want test_columns in it", tables)
+	}
+	columns, err := c.ListColumns(&testColumns{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same shape as on sqlite, with the types and the defaults of postgres
+	seq, def := "nextval('test_columns_id_seq'::regclass)", "'new'::text"
+	want := []ColumnInfo{
+		{Name: "id", DBType: "bigint", Default: &seq, PrimaryKey: true},
+		{Name: "name", DBType: "text"},
+		{Name: "status", DBType: "text", Nullable: true, Default: &def},
+		{Name: "note", DBType: "text", Nullable: true},
+	}
+	if len(columns) != len(want) {
+		t.Fatalf("ListColumns() = %+v, want %+v", columns, want)
+	}
+	for i, col := range columns {
+		if !reflect.DeepEqual(col, want[i]) {
+			t.Errorf("column %d = %+v, want %+v", i, col, want[i])
+			if col.Default != nil {
+				t.Logf("default %q", *col.Default)
+			}
+		}
+	}
+}
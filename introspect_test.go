@@ -0,0 +1,75 @@
+package dbwrap
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testColumns struct {
+	ID     uint
+	Name   string `gorm:"not null"`
+	Status string `gorm:"default:'new'"`
+	Note   *string
+}
+
+func TestIntrospection(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.SetTablePrefix("app_"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if has, err := c.HasTable(&testColumns{}); err != nil || has {
+		t.Errorf("HasTable() = %v, %v before the migration, want false", has, err)
+	}
+	if err := c.Migrate(&testColumns{}, &testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Exec("CREATE TABLE other (id INTEGER)").Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, model := range []interface{}{&testColumns{}, "app_test_columns", "other"} {
+		if has, err := c.HasTable(model); err != nil || !has {
+			t.Errorf("HasTable(%v) = %v, %v, want true", model, has, err)
+		}
+	}
+	tables, err := c.ListTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"app_test_columns", "app_test_users"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("ListTables() = %v, want the prefixed %v", tables, want)
+	}
+	columns, err := c.ListColumns(&testColumns{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlite reports the default the way gorm wrote it
+	def := `"new"`
+	want := []ColumnInfo{
+		{Name: "id", DBType: "integer", PrimaryKey: true},
+		{Name: "name", DBType: "text"},
+		{Name: "status", DBType: "text", Nullable: true, Default: &def},
+		{Name: "note", DBType: "text", Nullable: true},
+	}
+	if len(columns) != len(want) {
+		t.Fatalf("ListColumns() = %+v, want %+v", columns, want)
+	}
+	for i, col := range columns {
+		if !reflect.DeepEqual(col, want[i]) {
+			t.Errorf("column %d = %+v, want %+v", i, col, want[i])
+			if col.Default != nil {
+				t.Logf("default %q", *col.Default)
+			}
+		}
+	}
+	if columns, err = c.ListColumns("missing"); err != nil || len(columns) != 0 {
+		t.Errorf("ListColumns(missing) = %+v, %v, want no column", columns, err)
+	}
+	if _, err = New(false, nil).ListTables(); err != ErrNotOpened {
+		t.Errorf("ListTables() = %v before Open, want ErrNotOpened", err)
+	}
+}
@@ -0,0 +1,204 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+type HealthState int
+
+const (
+	// HealthUnknown is the state until the first keepalive ping.
+	HealthUnknown HealthState = iota
+	HealthUp
+	HealthDown
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case HealthUp:
+		return "up"
+	case HealthDown:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+// HealthStatus is the outcome of the last keepalive ping.
+type HealthStatus struct {
+	State               HealthState
+	LastPing            time.Time
+	LastError           error
+	ConsecutiveFailures int
+	// Latency is the duration of the last ping.
+	Latency time.Duration
+}
+
+// HealthChangeHook is called when a keepalive ping changes the health state, err is nil when it becomes up.
+type HealthChangeHook func(old, new HealthState, err error)
+
+// SetHealthChangeHook calls fn from the keepalive goroutine on every health state transition.
+func (c *DbMgt) SetHealthChangeHook(fn HealthChangeHook) *DbMgt {
+	c.healthLock.Lock()
+	defer c.healthLock.Unlock()
+	c.healthHook = fn
+	return c
+}
+
+// Health returns what Keepalive last observed, without pinging the database.
+func (c *DbMgt) Health() HealthStatus {
+	c.healthLock.Lock()
+	defer c.healthLock.Unlock()
+	return c.health
+}
+
+// recordPing updates the health status and returns the number of consecutive failures.
+func (c *DbMgt) recordPing(err error, latency time.Duration) int {
+	c.healthLock.Lock()
+	old := c.health.State
+	c.health.LastPing, c.health.LastError, c.health.Latency = time.Now(), err, latency
+	if err == nil {
+		c.health.State, c.health.ConsecutiveFailures = HealthUp, 0
+	} else {
+		c.health.State = HealthDown
+		c.health.ConsecutiveFailures++
+		atomic.AddInt64(&c.counters.PingFailures, 1)
+	}
+	state, failures, hook := c.health.State, c.health.ConsecutiveFailures, c.healthHook
+	c.healthLock.Unlock()
+	if hook != nil && state != old {
+		hook(old, state, err)
+	}
+	return failures
+}
+
+// recordClosed marks the health down while the database is closed or draining, without counting a failure.
+func (c *DbMgt) recordClosed(err error) {
+	c.healthLock.Lock()
+	old := c.health.State
+	c.health.State, c.health.LastPing, c.health.LastError, c.health.Latency = HealthDown, time.Now(), err, 0
+	hook := c.healthHook
+	c.healthLock.Unlock()
+	if hook != nil && old != HealthDown {
+		hook(old, HealthDown, err)
+	}
+}
+
+const maxPingTimeout = 5 * time.Second
+
+// SetPingTimeout bounds each keepalive ping, by default to half the interval and at most 5 seconds.
+// A ping that times out counts as a failure.
+func (c *DbMgt) SetPingTimeout(d time.Duration) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pingTimeout = d
+	return c
+}
+
+func (c *DbMgt) keepalivePingTimeout(interval time.Duration) time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.pingTimeout > 0 {
+		return c.pingTimeout
+	}
+	if interval/2 < maxPingTimeout {
+		return interval / 2
+	}
+	return maxPingTimeout
+}
+
+func (c *DbMgt) Keepalive(ctx context.Context, interval time.Duration) {
+	c.KeepaliveWithReconnect(ctx, interval, 0)
+}
+
+// KeepaliveWithReconnect pings the database every interval until ctx is done and, after failureThreshold
+// consecutive failures, rebuilds the connection pool with Reopen, backing off while reopening fails.
+// A failureThreshold of 0 only logs the failures, as Keepalive does.
+func (c *DbMgt) KeepaliveWithReconnect(ctx context.Context, interval time.Duration, failureThreshold int) {
+	c.healthLock.Lock()
+	c.keepalives++
+	c.healthLock.Unlock()
+	defer func() {
+		c.healthLock.Lock()
+		c.keepalives--
+		c.healthLock.Unlock()
+	}()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	backoff := RetryPolicy{InitialInterval: interval, MaxInterval: 30 * interval, Multiplier: 2, JitterFraction: 0.2}
+	var reopenFailures int
+	var nextReopen time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, c.keepalivePingTimeout(interval))
+		start := time.Now()
+		err := c.Ping(pingCtx)
+		latency := time.Since(start)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, ErrNotOpened) || errors.Is(err, ErrDraining) {
+			// closed on purpose, nothing to keep alive
+			c.recordClosed(err)
+			continue
+		}
+		failures := c.recordPing(err, latency)
+		if err == nil {
+			reopenFailures = 0
+			continue
+		}
+		if c.log != nil {
+			c.log.Error(nil, err.Error())
+		}
+		if failureThreshold <= 0 || failures < failureThreshold || time.Now().Before(nextReopen) {
+			continue
+		}
+		if err = c.Reopen(ctx); err != nil {
+			reopenFailures++
+			delay := backoff.NextDelay(reopenFailures)
+			nextReopen = time.Now().Add(delay)
+			if c.log != nil {
+				c.log.Error(nil, "dbwrap: reopen after %d failed pings: %v, retrying in %s", failures, err, delay)
+			}
+			continue
+		}
+		reopenFailures = 0
+		c.recordPing(nil, 0)
+		if c.log != nil {
+			c.log.Warn(ctx, "dbwrap: reopened the database after %d failed pings", failures)
+		}
+	}
+}
+
+// ConsecutivePingFailures returns the number of keepalive pings that failed in a row.
+func (c *DbMgt) ConsecutivePingFailures() int {
+	return c.Health().ConsecutiveFailures
+}
+
+func KeepaliveWithReconnect(ctx context.Context, interval time.Duration, failureThreshold int) {
+	DefaultDbMgt().KeepaliveWithReconnect(ctx, interval, failureThreshold)
+}
+
+func ConsecutivePingFailures() int {
+	return DefaultDbMgt().ConsecutivePingFailures()
+}
+
+func SetPingTimeout(d time.Duration) *DbMgt {
+	return DefaultDbMgt().SetPingTimeout(d)
+}
+
+func Health() HealthStatus {
+	return DefaultDbMgt().Health()
+}
+
+func SetHealthChangeHook(fn HealthChangeHook) *DbMgt {
+	return DefaultDbMgt().SetHealthChangeHook(fn)
+}
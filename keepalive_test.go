@@ -0,0 +1,176 @@
+package dbwrap
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+)
+
+// waitFor polls cond until it holds or a second passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestKeepaliveHealth(t *testing.T) {
+	c := openSqlite(t)
+	if status := c.Health(); status.State != HealthUnknown {
+		t.Errorf("state before the first ping = %s, want unknown", status.State)
+	}
+	type transition struct {
+		old, new HealthState
+		failed   bool
+	}
+	var lock sync.Mutex
+	var transitions []transition
+	c.SetHealthChangeHook(func(old, new HealthState, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		transitions = append(transitions, transition{old, new, err != nil})
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Keepalive(ctx, 5*time.Millisecond)
+	waitFor(t, "the up state", func() bool { return c.Health().State == HealthUp })
+	if status := c.Health(); status.LastPing.IsZero() || status.LastError != nil || status.ConsecutiveFailures != 0 {
+		t.Errorf("status after a ping = %+v", status)
+	}
+	// close the pool underneath the instance, which still believes it is open
+	if err := c.CommonDB().Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the down state", func() bool { return c.Health().State == HealthDown })
+	status := c.Health()
+	if status.LastError == nil || status.ConsecutiveFailures < 1 {
+		t.Errorf("status after the pool closed = %+v", status)
+	}
+	waitFor(t, "more failures", func() bool { return c.ConsecutivePingFailures() > status.ConsecutiveFailures })
+	lock.Lock()
+	defer lock.Unlock()
+	want := []transition{{HealthUnknown, HealthUp, false}, {HealthUp, HealthDown, true}}
+	if len(transitions) != len(want) || transitions[0] != want[0] || transitions[1] != want[1] {
+		t.Errorf("transitions = %+v, want %+v", transitions, want)
+	}
+}
+
+func TestKeepaliveStops(t *testing.T) {
+	c := openSqlite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Keepalive(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+	waitFor(t, "the up state", func() bool { return c.Health().State == HealthUp })
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Keepalive did not return after the cancellation")
+	}
+}
+
+func TestKeepalivePingTimeout(t *testing.T) {
+	server := newFakePgServer(t, false)
+	c := New(false, nil).SetPgParam(server.host(), server.port(), "user", "", "app", false)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// the connections stay open but every ping blocks
+	atomic.StoreInt32(&server.hang, 1)
+	c.SetPingTimeout(20 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Keepalive(ctx, 10*time.Millisecond)
+	waitFor(t, "three failed pings", func() bool { return c.ConsecutivePingFailures() >= 3 })
+	status := c.Health()
+	if status.State != HealthDown || status.LastError == nil {
+		t.Errorf("status = %+v, want down", status)
+	}
+	if status.Latency > 200*time.Millisecond {
+		t.Errorf("a ping took %s, want it bounded by the ping timeout", status.Latency)
+	}
+}
+
+func TestKeepalivePingTimeoutDefault(t *testing.T) {
+	c := New(false, nil)
+	tests := []struct {
+		interval, want time.Duration
+	}{
+		{time.Second, 500 * time.Millisecond},
+		{time.Minute, maxPingTimeout},
+	}
+	for _, tt := range tests {
+		if got := c.keepalivePingTimeout(tt.interval); got != tt.want {
+			t.Errorf("ping timeout for %s = %s, want %s", tt.interval, got, tt.want)
+		}
+	}
+	if got := c.SetPingTimeout(time.Second).keepalivePingTimeout(time.Minute); got != time.Second {
+		t.Errorf("ping timeout = %s, want the configured 1s", got)
+	}
+}
+
+func TestKeepaliveReconnect(t *testing.T) {
+	dialector := &flakyDialector{Dialector: sqlite.Open(filepath.Join(t.TempDir(), "test.db"))}
+	c := New(false, nil).SetDialector(dialector)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.KeepaliveWithReconnect(ctx, 5*time.Millisecond, 3)
+		close(done)
+	}()
+	waitFor(t, "the up state", func() bool { return c.Health().State == HealthUp })
+	// the next two reopens fail, the third one succeeds
+	atomic.StoreInt32(&dialector.failures, 3)
+	if err := c.CommonDB().Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the reopen", func() bool { return c.Counters().Reopens == 1 })
+	if attempts := atomic.LoadInt32(&dialector.attempts); attempts != 4 {
+		t.Errorf("%d opens, want the first one and three reopens", attempts)
+	}
+	if status := c.Health(); status.State != HealthUp || status.ConsecutiveFailures != 0 {
+		t.Errorf("status after the reopen = %+v, want up without failures", status)
+	}
+	if failures := c.Counters().PingFailures; failures < 3 {
+		t.Errorf("%d failed pings before the reopen, want at least the threshold of 3", failures)
+	}
+	if err := c.Db().Exec("SELECT 1").Error; err != nil {
+		t.Errorf("query after the reopen: %v", err)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("KeepaliveWithReconnect did not return after the cancellation")
+	}
+}
+
+func TestKeepaliveWithoutReconnect(t *testing.T) {
+	c := openSqlite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.KeepaliveWithReconnect(ctx, 5*time.Millisecond, 0)
+	waitFor(t, "the up state", func() bool { return c.Health().State == HealthUp })
+	if err := c.CommonDB().Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "five failures", func() bool { return c.ConsecutivePingFailures() >= 5 })
+	if reopens := c.Counters().Reopens; reopens != 0 {
+		t.Errorf("%d reopens, want none with a threshold of 0", reopens)
+	}
+}
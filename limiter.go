@@ -0,0 +1,176 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrTooBusy is returned by the operations that waited longer than allowed by SetMaxConcurrentQueries.
+var ErrTooBusy = errors.New("dbwrap: too many concurrent queries")
+
+type concurrencyLimiter struct {
+	slots    chan struct{}
+	timeout  time.Duration
+	waiting  int64
+	rejected int64
+}
+
+type limiterKey struct{}
+
+const limiterInstanceKey = "dbwrap:limiter"
+
+// ConcurrencyStats describes the limiter of SetMaxConcurrentQueries.
+type ConcurrencyStats struct {
+	Limit    int
+	InFlight int
+	Waiting  int
+	// Rejected counts the operations that failed with ErrTooBusy.
+	Rejected int64
+}
+
+// SetMaxConcurrentQueries lets at most n operations run at once, the others wait for up to waitTimeout and
+// then fail with ErrTooBusy, or with the error of their context when it ends first. The statements an
+// operation runs on its own, such as the ones saving associations, share its slot. Rows and Row release
+// the slot when they return, not when the rows are closed. A n of 0 removes the limit.
+func (c *DbMgt) SetMaxConcurrentQueries(n int, waitTimeout time.Duration) *DbMgt {
+	var limiter *concurrencyLimiter
+	if n > 0 {
+		limiter = &concurrencyLimiter{slots: make(chan struct{}, n), timeout: waitTimeout}
+	}
+	c.limiter.Store(limiterHolder{limiter: limiter})
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.limiterOn && c.db != nil {
+		if err := c.installLimiter(c.db); err != nil {
+			c.log.Error(nil, "dbwrap: install the concurrency limiter callbacks: %v", err)
+		}
+	}
+	c.limiterOn = true
+	return c
+}
+
+// limiterHolder lets the limiter be swapped with an atomic.Value, which cannot store nil.
+type limiterHolder struct {
+	limiter *concurrencyLimiter
+}
+
+func (c *DbMgt) QueryConcurrency() ConcurrencyStats {
+	holder, _ := c.limiter.Load().(limiterHolder)
+	l := holder.limiter
+	if l == nil {
+		return ConcurrencyStats{}
+	}
+	return ConcurrencyStats{
+		Limit:    cap(l.slots),
+		InFlight: len(l.slots),
+		Waiting:  int(atomic.LoadInt64(&l.waiting)),
+		Rejected: atomic.LoadInt64(&l.rejected),
+	}
+}
+
+func (c *DbMgt) installLimiter(db *gorm.DB) error {
+	cb := db.Callback()
+	processors := []struct {
+		op            string
+		before, after callbackRegisterer
+	}{
+		{"create", cb.Create().Before("*"), cb.Create().After("*")},
+		{"query", cb.Query().Before("*"), cb.Query().After("*")},
+		{"update", cb.Update().Before("*"), cb.Update().After("*")},
+		{"delete", cb.Delete().Before("*"), cb.Delete().After("*")},
+		{"row", cb.Row().Before("*"), cb.Row().After("*")},
+		{"raw", cb.Raw().Before("*"), cb.Raw().After("*")},
+	}
+	for _, p := range processors {
+		if err := p.before.Register("dbwrap:limiter_acquire_"+p.op, c.acquireSlot); err != nil {
+			return err
+		}
+		if err := p.after.Register("dbwrap:limiter_release_"+p.op, releaseSlot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DbMgt) acquireSlot(db *gorm.DB) {
+	holder, _ := c.limiter.Load().(limiterHolder)
+	l := holder.limiter
+	if l == nil || db.Error != nil || db.DryRun {
+		return
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ctx.Value(limiterKey{}) != nil {
+		// a statement of an operation holding a slot
+		return
+	}
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		atomic.AddInt64(&l.waiting, 1)
+		err := l.wait(ctx)
+		atomic.AddInt64(&l.waiting, -1)
+		if err != nil {
+			if err == ErrTooBusy {
+				atomic.AddInt64(&l.rejected, 1)
+			}
+			db.AddError(err)
+			return
+		}
+	}
+	db.InstanceSet(limiterInstanceKey, heldSlot{limiter: l, ctx: db.Statement.Context})
+	db.Statement.Context = context.WithValue(ctx, limiterKey{}, true)
+}
+
+// heldSlot is kept on the statement holding a slot until its release.
+type heldSlot struct {
+	limiter *concurrencyLimiter
+	ctx     context.Context
+}
+
+func (l *concurrencyLimiter) wait(ctx context.Context) error {
+	var timeout <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return ErrTooBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func releaseSlot(db *gorm.DB) {
+	v, ok := db.InstanceGet(limiterInstanceKey)
+	if !ok {
+		return
+	}
+	held, ok := v.(heldSlot)
+	if !ok {
+		return
+	}
+	// the statement may run again, e.g. a session reused with clone 0, and must then acquire a slot again
+	db.Statement.Settings.Delete(fmt.Sprintf("%p", db.Statement) + limiterInstanceKey)
+	db.Statement.Context = held.ctx
+	<-held.limiter.slots
+}
+
+func SetMaxConcurrentQueries(n int, waitTimeout time.Duration) *DbMgt {
+	return DefaultDbMgt().SetMaxConcurrentQueries(n, waitTimeout)
+}
+
+func QueryConcurrency() ConcurrencyStats {
+	return DefaultDbMgt().QueryConcurrency()
+}
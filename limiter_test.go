@@ -0,0 +1,115 @@
+package dbwrap
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runConcurrently runs n copies of query at once and returns their errors.
+func runConcurrently(n int, query func() error) []error {
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = query()
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestMaxConcurrentQueriesRejects(t *testing.T) {
+	const limit = 3
+	c := openSqliteSleep(t)
+	c.SetConnPool(limit+5, limit+5, 0, 0)
+	c.SetMaxConcurrentQueries(limit, 50*time.Millisecond)
+	done := make(chan []error)
+	go func() {
+		done <- runConcurrently(limit+5, func() error {
+			return c.Db().Exec("SELECT sleep(300)").Error
+		})
+	}()
+	waitFor(t, "the queries to queue", func() bool {
+		stats := c.QueryConcurrency()
+		return stats.InFlight == limit && stats.Waiting == 5
+	})
+	var rejected int
+	for _, err := range <-done {
+		switch {
+		case errors.Is(err, ErrTooBusy):
+			rejected++
+		case err != nil:
+			t.Errorf("query error %v, want nil or ErrTooBusy", err)
+		}
+	}
+	if rejected != 5 {
+		t.Errorf("%d queries got ErrTooBusy, want 5", rejected)
+	}
+	want := ConcurrencyStats{Limit: limit, Rejected: 5}
+	if stats := c.QueryConcurrency(); stats != want {
+		t.Errorf("QueryConcurrency() = %+v, want %+v", stats, want)
+	}
+}
+
+func TestMaxConcurrentQueriesQueues(t *testing.T) {
+	const limit = 3
+	c := openSqliteSleep(t)
+	c.SetConnPool(limit+5, limit+5, 0, 0)
+	c.SetMaxConcurrentQueries(limit, 5*time.Second)
+	start := time.Now()
+	errs := runConcurrently(limit+5, func() error {
+		return c.Db().Exec("SELECT sleep(100)").Error
+	})
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("query error %v, want it queued", err)
+		}
+	}
+	// 8 queries by 3 at most take 3 rounds
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("the queries took %s, want at most %d at once", elapsed, limit)
+	}
+	if stats := c.QueryConcurrency(); stats.InFlight != 0 || stats.Waiting != 0 || stats.Rejected != 0 {
+		t.Errorf("QueryConcurrency() = %+v, want the slots released", stats)
+	}
+}
+
+func TestMaxConcurrentQueriesClone(t *testing.T) {
+	c := openSqliteSleep(t)
+	c.SetMaxConcurrentQueries(1, 10*time.Millisecond)
+	clone := c.Clone()
+	if err := clone.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer clone.Close()
+	if stats := clone.QueryConcurrency(); stats.Limit != 1 {
+		t.Fatalf("clone Limit = %d, want 1", stats.Limit)
+	}
+	busy := make(chan error)
+	go func() {
+		busy <- c.Db().Exec("SELECT sleep(200)").Error
+	}()
+	waitFor(t, "the query to take the slot", func() bool {
+		return c.QueryConcurrency().InFlight == 1
+	})
+	if err := clone.Db().Exec("SELECT 1").Error; err != nil {
+		t.Errorf("clone query error %v, want its own slot", err)
+	}
+	if err := c.Db().Exec("SELECT 1").Error; !errors.Is(err, ErrTooBusy) {
+		t.Errorf("query error %v, want ErrTooBusy", err)
+	}
+	if err := <-busy; err != nil {
+		t.Fatal(err)
+	}
+	c.SetMaxConcurrentQueries(0, 0)
+	if stats := c.QueryConcurrency(); stats != (ConcurrencyStats{}) {
+		t.Errorf("QueryConcurrency() = %+v after removing the limit, want zero", stats)
+	}
+	if err := c.Db().Exec("SELECT 1").Error; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,145 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+
+	"gorm.io/gorm"
+)
+
+// TableOptioner is implemented by models whose table needs driver specific options on creation,
+// e.g. "ENGINE=MergeTree() ORDER BY id" for clickhouse or "ENGINE=InnoDB" for mysql.
+type TableOptioner interface {
+	TableOptions() string
+}
+
+// autoMigrate migrates the models one at a time, in order, with their ModelOptions, until the context of db is
+// done.
+func autoMigrate(db *gorm.DB, models []interface{}, opts map[reflect.Type]ModelOptions) error {
+	ctx := db.Statement.Context
+	for _, model := range models {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("dbwrap: migrate %s: %w", modelType(model), err)
+		}
+		options, err := tableOptions(db.Dialector.Name(), model, opts[modelType(model)])
+		if err != nil {
+			return err
+		}
+		tx := db
+		if len(options) > 0 {
+			tx = db.Set("gorm:table_options", options)
+		}
+		if err = tx.AutoMigrate(model); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				// the driver error of an aborted statement says less than the context
+				return fmt.Errorf("dbwrap: migrate %s: %w", modelType(model), ctxErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrate registers models, creates or updates the tables of every registered model but the MigrateSkipper
+// ones, after the ones it depends on according to RegisterModel, and runs the association funcs. It stops at the
+// migration error or the first association func error, which names the failing func, leaving the database open.
+func (c *DbMgt) Migrate(models ...interface{}) error {
+	return c.MigrateContext(context.Background(), models...)
+}
+
+// MigrateSkipper is implemented by models whose table Migrate must leave alone, e.g. in the deployments that
+// only read it.
+type MigrateSkipper interface {
+	SkipAutoMigrate() bool
+}
+
+// MigrateContext is Migrate bound to ctx: once ctx is done the statement in progress is aborted and the error
+// wraps ctx.Err() with the model being migrated.
+func (c *DbMgt) MigrateContext(ctx context.Context, models ...interface{}) error {
+	return c.migrate(ctx, models, nil)
+}
+
+// MigrateMatching is Migrate without registering models, which only migrates the registered models pred
+// returns true for.
+func (c *DbMgt) MigrateMatching(pred func(model interface{}) bool) error {
+	return c.migrate(context.Background(), nil, pred)
+}
+
+// migrate registers models and migrates the registered ones that pred, when not nil, returns true for, but the
+// MigrateSkipper ones.
+func (c *DbMgt) migrate(ctx context.Context, models []interface{}, pred func(model interface{}) bool) error {
+	c.lock.Lock()
+	c.models = append(c.models, models...)
+	db := c.db
+	registered, err := sortModels(c.models, c.modelDeps)
+	funcs := append([]AssociationErrFunc(nil), c.associationFunc...)
+	strict := c.strictMigrate
+	opts := copyModelOpts(c.modelOpts)
+	c.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if db == nil {
+		return ErrNotOpened
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	selected := make([]interface{}, 0, len(registered))
+	for _, model := range registered {
+		if skipper, ok := model.(MigrateSkipper); ok && skipper.SkipAutoMigrate() {
+			continue
+		}
+		if pred == nil || pred(model) {
+			selected = append(selected, model)
+		}
+	}
+	registered = selected
+	db = db.WithContext(ctx)
+	// migrations run one at a time, but without holding the lock that Db needs
+	c.migrateLock.Lock()
+	defer c.migrateLock.Unlock()
+	if err := autoMigrate(db, registered, opts); err != nil {
+		return err
+	}
+	for _, fc := range funcs {
+		if err := fc(db); err != nil {
+			return err
+		}
+	}
+	if strict {
+		report, err := schemaDiff(db, registered)
+		if err != nil {
+			return err
+		}
+		if !report.Empty() {
+			return &SchemaDriftError{Report: report}
+		}
+	}
+	return nil
+}
+
+// namedAssociationFunc wraps fn so its error names orig, the func registered.
+func namedAssociationFunc(orig interface{}, fn AssociationErrFunc) AssociationErrFunc {
+	name := runtime.FuncForPC(reflect.ValueOf(orig).Pointer()).Name()
+	return func(db *gorm.DB) error {
+		if err := fn(db); err != nil {
+			return fmt.Errorf("dbwrap: association func %s: %w", name, err)
+		}
+		return nil
+	}
+}
+
+func Migrate(models ...interface{}) error {
+	return DefaultDbMgt().Migrate(models...)
+}
+
+func MigrateContext(ctx context.Context, models ...interface{}) error {
+	return DefaultDbMgt().MigrateContext(ctx, models...)
+}
+
+func MigrateMatching(pred func(model interface{}) bool) error {
+	return DefaultDbMgt().MigrateMatching(pred)
+}
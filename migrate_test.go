@@ -0,0 +1,260 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type testAccount struct {
+	ID   uint
+	Name string
+}
+
+type testInvoice struct {
+	ID            uint
+	TestAccountID uint
+	Total         int
+}
+
+type testLine struct {
+	ID            uint
+	TestInvoiceID uint
+	Item          string
+}
+
+func TestRegisterAndMigrateRace(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	defer c.Close()
+	var associations int32
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		if err := c.Open(); err != nil {
+			t.Error(err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		c.Register(&testUser{}, &testAccount{})
+	}()
+	go func() {
+		defer wg.Done()
+		c.RegisterModel(&testInvoice{}, &testAccount{})
+		c.RegisterModel(&testLine{}, &testInvoice{})
+	}()
+	go func() {
+		defer wg.Done()
+		c.RegisterAssociationErrFunc(func(*gorm.DB) error {
+			lock.Lock()
+			defer lock.Unlock()
+			associations++
+			return nil
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		// the database may not be open yet
+		c.Migrate(&testOrder{})
+	}()
+	wg.Wait()
+
+	var errs = make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.Migrate()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	for _, model := range []interface{}{&testUser{}, &testAccount{}, &testInvoice{}, &testLine{}, &testOrder{}} {
+		if has, err := c.HasTable(model); err != nil || !has {
+			t.Errorf("HasTable(%T) = %v, %v, want true", model, has, err)
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if associations < 4 {
+		t.Errorf("the association func ran %d times, want once per Migrate", associations)
+	}
+}
+
+func TestCreateTablesFailure(t *testing.T) {
+	c := openSqlite(t)
+	c.RegisterAssociationErrFunc(func(*gorm.DB) error {
+		return errors.New("association failed")
+	})
+	r := panicked(func() {
+		c.CreateTables(&testUser{})
+	})
+	if err, ok := r.(error); !ok || !strings.Contains(err.Error(), "association failed") {
+		t.Errorf("CreateTables panicked with %v, want the association error", r)
+	}
+	if c.IsOpen() {
+		t.Error("CreateTables left the database open")
+	}
+}
+
+type testBadTag struct {
+	ID    uint
+	Owner testUser `gorm:"foreignKey:Missing"`
+}
+
+func TestMigrateInvalidTag(t *testing.T) {
+	c := openSqlite(t)
+	err := c.Migrate(&testUser{}, &testBadTag{})
+	if err == nil {
+		t.Fatal("Migrate succeeded with an invalid foreign key tag")
+	}
+	if !strings.Contains(err.Error(), "Owner") {
+		t.Errorf("Migrate() = %v, want the invalid field named", err)
+	}
+	if !c.IsOpen() {
+		t.Fatal("Migrate closed the database")
+	}
+	if err = c.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() = %v after the failed migration", err)
+	}
+	if has, err := c.HasTable(&testUser{}); err != nil || !has {
+		t.Errorf("HasTable(testUser) = %v, %v, want the valid model migrated", has, err)
+	}
+}
+
+func TestMigrateAssociationError(t *testing.T) {
+	c := openSqlite(t)
+	c.RegisterAssociationErrFunc(func(*gorm.DB) error {
+		return errors.New("association failed")
+	})
+	if err := c.Migrate(&testUser{}); err == nil || !strings.Contains(err.Error(), "association failed") {
+		t.Errorf("Migrate() = %v, want the association error", err)
+	}
+	if !c.IsOpen() {
+		t.Error("Migrate closed the database")
+	}
+}
+
+// TestGroup and TestMember are exported, gorm builds the join table of many2many from their names.
+type TestGroup struct {
+	ID      uint
+	Members []TestMember `gorm:"many2many:test_group_members"`
+}
+
+type TestMember struct {
+	ID   uint
+	Name string
+}
+
+// setupMembersJoinTable is an association func setting up a join table on a field TestGroup does not have.
+func setupMembersJoinTable(db *gorm.DB) error {
+	return db.SetupJoinTable(&TestGroup{}, "Users", &testGroupMember{})
+}
+
+type testGroupMember struct {
+	TestGroupID  uint `gorm:"primaryKey"`
+	TestMemberID uint `gorm:"primaryKey"`
+}
+
+func TestMigrateSetupJoinTableError(t *testing.T) {
+	c := openSqlite(t)
+	var ran []string
+	c.RegisterAssociationFunc(func(db *gorm.DB) *gorm.DB {
+		ran = append(ran, "old")
+		return db
+	})
+	c.RegisterAssociationErrFunc(setupMembersJoinTable, func(*gorm.DB) error {
+		ran = append(ran, "after")
+		return nil
+	})
+	err := c.Migrate(&TestGroup{})
+	if err == nil {
+		t.Fatal("Migrate ignored the SetupJoinTable error")
+	}
+	if !strings.Contains(err.Error(), "setupMembersJoinTable") || !strings.Contains(err.Error(), "Users") {
+		t.Errorf("Migrate error %q does not name the func and the field", err)
+	}
+	if want := []string{"old"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %v, want the funcs before the failure only", ran)
+	}
+}
+
+func TestMigrateAssociationFuncError(t *testing.T) {
+	c := openSqlite(t)
+	// the old style funcs fail the migration with the Error of the *gorm.DB they return
+	c.RegisterAssociationFunc(func(db *gorm.DB) *gorm.DB {
+		return db.Exec("INSERT INTO missing_table VALUES (1)")
+	}, func(*gorm.DB) *gorm.DB {
+		return nil
+	})
+	if err := c.Migrate(&testUser{}); err == nil || !strings.Contains(err.Error(), "missing_table") {
+		t.Errorf("Migrate() = %v, want the error of the old style func", err)
+	}
+}
+
+// testReport is read only in some deployments, its table is left alone there.
+type testReport struct {
+	ID    uint
+	Total int
+}
+
+var skipReports bool
+
+func (testReport) SkipAutoMigrate() bool {
+	return skipReports
+}
+
+func TestMigrateMatching(t *testing.T) {
+	c := openSqlite(t)
+	skipReports = true
+	defer func() {
+		skipReports = false
+	}()
+	c.Register(&testUser{}, &testAccount{}, &testInvoice{}, &testReport{})
+	err := c.MigrateMatching(func(model interface{}) bool {
+		_, invoice := model.(*testInvoice)
+		return !invoice
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for model, want := range map[interface{}]bool{&testUser{}: true, &testAccount{}: true, &testInvoice{}: false,
+		&testReport{}: false} {
+		if has, err := c.HasTable(model); err != nil || has != want {
+			t.Errorf("HasTable(%T) = %v, %v, want %v", model, has, err, want)
+		}
+	}
+	if len(c.models) != 4 {
+		t.Errorf("%d models registered, want all 4", len(c.models))
+	}
+	// Migrate takes every registered model but the skipped ones
+	if err = c.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := c.HasTable(&testInvoice{}); !has {
+		t.Error("Migrate did not create the table filtered out before")
+	}
+	if has, _ := c.HasTable(&testReport{}); has {
+		t.Error("Migrate created the table of a MigrateSkipper")
+	}
+	skipReports = false
+	if err = c.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := c.HasTable(&testReport{}); !has {
+		t.Error("Migrate did not create the table of a model no longer skipped")
+	}
+}
@@ -0,0 +1,59 @@
+//go:build postgres
+// +build postgres
+
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testLockedV1 struct {
+	ID uint
+}
+
+func (testLockedV1) TableName() string {
+	return "dbwrap_test_locked"
+}
+
+type testLockedV2 struct {
+	ID   uint
+	Name string
+}
+
+func (testLockedV2) TableName() string {
+	return "dbwrap_test_locked"
+}
+
+func TestMigrateContextLockedPostgres(t *testing.T) {
+	c := openPostgres(t)
+	if err := c.Db().Migrator().DropTable(&testLockedV1{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().AutoMigrate(&testLockedV1{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Db().Migrator().DropTable(&testLockedV1{})
+	// a long transaction holds the lock the ALTER TABLE of the migration waits for
+	tx := c.Db().Begin()
+	if err := tx.Exec("LOCK TABLE dbwrap_test_locked IN ACCESS EXCLUSIVE MODE").Error; err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := c.MigrateContext(ctx, &testLockedV2{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("MigrateContext() = %v, want context.DeadlineExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "dbwrap.testLockedV2") {
+		t.Errorf("MigrateContext error %q does not name the model", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("MigrateContext returned after %s", elapsed)
+	}
+}
@@ -0,0 +1,79 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrateContextCancelled(t *testing.T) {
+	c := openSqlite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.MigrateContext(ctx, &testUser{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("MigrateContext() = %v, want context.Canceled", err)
+	}
+	if has, err := c.HasTable(&testUser{}); err != nil || has {
+		t.Errorf("HasTable() = %v, %v after the cancelled migration, want false", has, err)
+	}
+	// the model stays registered for the next migration
+	if err := c.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := c.HasTable(&testUser{}); err != nil || !has {
+		t.Errorf("HasTable() = %v, %v, want true", has, err)
+	}
+}
+
+func TestMigrateContextDeadline(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	// sqlite waits for the lock without looking at the context, until the busy timeout
+	if err := c.SetSqlite3Pragmas(map[string]string{"busy_timeout": "300"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Migrate(&testAccount{}); err != nil {
+		t.Fatal(err)
+	}
+	// another connection holds the write lock the migration of testInvoice waits for
+	tx := c.Db().Begin()
+	if err := tx.Exec("INSERT INTO test_accounts (name) VALUES ('lock')").Error; err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := c.MigrateContext(ctx, &testInvoice{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("MigrateContext() = %v, want context.DeadlineExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "dbwrap.testInvoice") {
+		t.Errorf("MigrateContext error %q does not name the model", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("MigrateContext returned after %s", elapsed)
+	}
+}
+
+func TestOpenUntilOkAndMigrate(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.OpenUntilOkAndMigrate(context.Background(), time.Millisecond, &testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if has, err := c.HasTable(&testUser{}); err != nil || !has {
+		t.Errorf("HasTable() = %v, %v, want true", has, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.OpenUntilOkAndMigrate(ctx, time.Millisecond, &testAccount{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("OpenUntilOkAndMigrate() = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,190 @@
+package dbwrap
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LocksTable holds the migration locks on sqlite, which has no named locks.
+const LocksTable = "dbwrap_locks"
+
+const defaultMigrationLockTimeout = time.Minute
+
+// ErrMigrationLocked is returned by MigrateWithLock when another process held the migration lock for the whole
+// timeout.
+var ErrMigrationLocked = errors.New("dbwrap: timed out waiting for the migration lock")
+
+func init() {
+	internalTables[LocksTable] = true
+}
+
+// SetMigrationLock sets how long MigrateWithLock, and RunMigrations on mysql and sqlserver, wait for the lock,
+// 1 minute by default, and a namespace telling apart the services migrating the same database.
+func (c *DbMgt) SetMigrationLock(timeout time.Duration, namespace string) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lockTimeout, c.lockNamespace = timeout, namespace
+	return c
+}
+
+// MigrateWithLock is MigrateContext holding a database wide lock, so the instances of a service starting
+// together migrate one after the other: pg_advisory_lock on postgres, GET_LOCK on mysql, sp_getapplock on
+// sqlserver and a row of the LocksTable on sqlite. The lock is named after the database and the namespace of
+// SetMigrationLock. A sqlite lock left behind by a crashed process has to be deleted by hand.
+func (c *DbMgt) MigrateWithLock(ctx context.Context, models ...interface{}) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	timeout, namespace := c.lockTimeout, c.lockNamespace
+	c.lock.Unlock()
+	if timeout <= 0 {
+		timeout = defaultMigrationLockTimeout
+	}
+	db = db.WithContext(ctx)
+	key := "dbwrap_migrate:" + db.Migrator().CurrentDatabase()
+	if len(namespace) > 0 {
+		key += ":" + namespace
+	}
+	release, err := acquireMigrationLock(ctx, db, key, timeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil && c.log != nil {
+			c.log.Error(nil, "dbwrap: release the migration lock: %v", err)
+		}
+	}()
+	return c.MigrateContext(ctx, models...)
+}
+
+// acquireMigrationLock takes the lock key for at most timeout and returns the func releasing it.
+func acquireMigrationLock(ctx context.Context, db *gorm.DB, key string, timeout time.Duration) (func() error, error) {
+	driver := db.Dialector.Name()
+	if driver == driverSqlite {
+		return acquireLockRow(ctx, db, key, timeout)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	// the named locks belong to the session, so they are taken and released on a dedicated connection
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var lock, unlock string
+	var arg interface{} = key
+	switch driver {
+	case driverPostgres:
+		lock, unlock, arg = "SELECT pg_advisory_lock($1)", "SELECT pg_advisory_unlock($1)", lockID(key)
+	case driverMysql:
+		if len(key) > 64 {
+			key = fmt.Sprintf("dbwrap_migrate:%x", lockID(key))
+		}
+		lock = fmt.Sprintf("SELECT COALESCE(GET_LOCK(?, %d), 0)", int(timeout.Seconds()+0.5))
+		unlock, arg = "SELECT RELEASE_LOCK(?)", key
+	case driverSqlServer:
+		lock = fmt.Sprintf("DECLARE @r int; EXEC @r = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', "+
+			"@LockOwner = 'Session', @LockTimeout = %d; SELECT CASE WHEN @r >= 0 THEN 1 ELSE 0 END",
+			timeout.Milliseconds())
+		unlock = "EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'"
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("dbwrap: MigrateWithLock does not support %s", driver)
+	}
+	// mysql and sqlserver enforce the timeout themselves
+	wait := timeout + 5*time.Second
+	if driver == driverPostgres {
+		wait = timeout
+	}
+	lockCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	acquired := int64(1)
+	if driver == driverPostgres {
+		_, err = conn.ExecContext(lockCtx, lock, arg)
+	} else {
+		var result sql.NullInt64
+		err = conn.QueryRowContext(lockCtx, lock, arg).Scan(&result)
+		acquired = result.Int64
+	}
+	if (err != nil && lockCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil) || (err == nil && acquired != 1) {
+		err = ErrMigrationLocked
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(context.Background(), unlock, arg)
+		return err
+	}, nil
+}
+
+// lockID hashes key into the bigint postgres advisory locks are identified with.
+func lockID(key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+type lockRecord struct {
+	Name       string `gorm:"primaryKey;size:255"`
+	Owner      string `gorm:"size:32"`
+	AcquiredAt time.Time
+}
+
+func (lockRecord) TableName() string {
+	return LocksTable
+}
+
+// acquireLockRow inserts the row of key in the LocksTable, retrying while the primary key rejects it.
+func acquireLockRow(ctx context.Context, db *gorm.DB, key string, timeout time.Duration) (func() error, error) {
+	// the runners starting together race to create the table, the losers find it created
+	if err := db.AutoMigrate(&lockRecord{}); err != nil && !db.Migrator().HasTable(&lockRecord{}) {
+		return nil, fmt.Errorf("dbwrap: create %s: %w", LocksTable, err)
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	owner := hex.EncodeToString(buf)
+	deadline := time.Now().Add(timeout)
+	for {
+		// a busy database fails the insert as the lock does, both are retried
+		err := db.Create(&lockRecord{Name: key, Owner: owner, AcquiredAt: time.Now()}).Error
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrMigrationLocked
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return func() error {
+		return db.WithContext(context.Background()).Where("name = ? AND owner = ?", key, owner).
+			Delete(&lockRecord{}).Error
+	}, nil
+}
+
+func SetMigrationLock(timeout time.Duration, namespace string) *DbMgt {
+	return DefaultDbMgt().SetMigrationLock(timeout, namespace)
+}
+
+func MigrateWithLock(ctx context.Context, models ...interface{}) error {
+	return DefaultDbMgt().MigrateWithLock(ctx, models...)
+}
@@ -0,0 +1,93 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestMigrateWithLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	var running, peak, runs int32
+	// two instances on one file stand for two processes
+	instances := make([]*DbMgt, 2)
+	for i := range instances {
+		c := New(false, nil).SetSqlite3Param(path)
+		if err := c.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		c.RegisterAssociationErrFunc(func(*gorm.DB) error {
+			n := atomic.AddInt32(&running, 1)
+			for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); {
+				p = atomic.LoadInt32(&peak)
+			}
+			time.Sleep(100 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&runs, 1)
+			return nil
+		})
+		instances[i] = c
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(instances))
+	for i, c := range instances {
+		wg.Add(1)
+		go func(i int, c *DbMgt) {
+			defer wg.Done()
+			errs[i] = c.MigrateWithLock(context.Background(), &testUser{})
+		}(i, c)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("instance %d: MigrateWithLock() = %v", i, err)
+		}
+	}
+	if runs != 2 || peak != 1 {
+		t.Errorf("%d migrations, up to %d at once, want 2 one after the other", runs, peak)
+	}
+	var count int64
+	if err := instances[0].Db().Model(&lockRecord{}).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("%d locks left, %v, want the lock released", count, err)
+	}
+}
+
+func TestMigrateWithLockTimeout(t *testing.T) {
+	c := openSqlite(t)
+	c.SetMigrationLock(200*time.Millisecond, "billing")
+	db := c.Db()
+	key := "dbwrap_migrate:" + db.Migrator().CurrentDatabase() + ":billing"
+	release, err := acquireMigrationLock(context.Background(), db, key, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err = c.MigrateWithLock(context.Background(), &testUser{}); !errors.Is(err, ErrMigrationLocked) {
+		t.Errorf("MigrateWithLock() = %v, want ErrMigrationLocked", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Errorf("MigrateWithLock gave up after %s, want the 200ms timeout", elapsed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = c.MigrateWithLock(ctx, &testUser{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("MigrateWithLock() = %v, want context.Canceled", err)
+	}
+	// another namespace has another lock
+	if err = c.SetMigrationLock(200*time.Millisecond, "crm").MigrateWithLock(context.Background()); err != nil {
+		t.Errorf("MigrateWithLock() = %v in another namespace", err)
+	}
+	if err = release(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.SetMigrationLock(0, "billing").MigrateWithLock(context.Background()); err != nil {
+		t.Errorf("MigrateWithLock() = %v after the release", err)
+	}
+}
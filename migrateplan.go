@@ -0,0 +1,210 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// UnpredictablePrefix starts the entries of a MigratePlan standing for a step whose SQL depends on what the
+// migration reads as it goes, e.g. the rebuild of a table that sqlite needs to alter a column.
+const UnpredictablePrefix = "-- unpredictable: "
+
+// MigratePlan returns the DDL statements Migrate(models...) would execute, in order, without executing them or
+// registering models. It compares the registered models and models with the live schema the way AutoMigrate
+// does, creating tables, adding and altering columns and creating constraints and indexes, on a DryRun session.
+// The association funcs are not planned.
+func (c *DbMgt) MigratePlan(models ...interface{}) ([]string, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	registered, err := sortModels(append(append([]interface{}(nil), c.models...), models...), c.modelDeps)
+	opts := copyModelOpts(c.modelOpts)
+	c.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	rec := &planRecorder{created: make(map[string]bool)}
+	dry := db.Session(&gorm.Session{DryRun: true, Logger: rec})
+	for _, model := range registered {
+		options, err := tableOptions(db.Dialector.Name(), model, opts[modelType(model)])
+		if err != nil {
+			return nil, err
+		}
+		tx := dry
+		if len(options) > 0 {
+			tx = dry.Set("gorm:table_options", options)
+		}
+		for _, value := range reorderModels(db, model) {
+			if err := planModel(db, tx, value, rec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rec.statements, nil
+}
+
+// WriteMigratePlan writes the MigratePlan of the registered models to w, one statement per line terminated with
+// ";", the unpredictable steps as SQL comments.
+func (c *DbMgt) WriteMigratePlan(w io.Writer) error {
+	plan, err := c.MigratePlan()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range plan {
+		if !strings.HasPrefix(stmt, UnpredictablePrefix) {
+			stmt += ";"
+		}
+		if _, err = fmt.Fprintln(w, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reorderModels adds the join tables of model, as AutoMigrate does.
+func reorderModels(db *gorm.DB, model interface{}) []interface{} {
+	if m, ok := db.Migrator().(interface {
+		ReorderModels(values []interface{}, autoAdd bool) []interface{}
+	}); ok {
+		return m.ReorderModels([]interface{}{model}, true)
+	}
+	return []interface{}{model}
+}
+
+// planModel follows AutoMigrate, reading the schema with db and writing with the DryRun session dry.
+func planModel(db, dry *gorm.DB, value interface{}, rec *planRecorder) error {
+	live, plan := db.Migrator(), dry.Migrator()
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(value); err != nil {
+		return err
+	}
+	table := stmt.Table
+	if rec.created[table] {
+		return nil
+	}
+	if !live.HasTable(value) {
+		rec.created[table] = true
+		return rec.step("create table "+table, func() error { return plan.CreateTable(value) })
+	}
+	columnTypes, _ := live.ColumnTypes(value)
+	for _, dbName := range stmt.Schema.DBNames {
+		field := stmt.Schema.FieldsByDBName[dbName]
+		var found gorm.ColumnType
+		for _, columnType := range columnTypes {
+			if columnType.Name() == dbName {
+				found = columnType
+				break
+			}
+		}
+		var err error
+		if found == nil {
+			err = rec.step("add column "+dbName+" to "+table, func() error { return plan.AddColumn(value, dbName) })
+		} else {
+			err = rec.step("alter column "+dbName+" of "+table, func() error {
+				return plan.MigrateColumn(value, field, found)
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var constraints []string
+	for _, rel := range stmt.Schema.Relationships.Relations {
+		if !db.Config.DisableForeignKeyConstraintWhenMigrating {
+			if constraint := rel.ParseConstraint(); constraint != nil && constraint.Schema == stmt.Schema {
+				constraints = append(constraints, constraint.Name)
+			}
+		}
+	}
+	// AutoMigrate only checks the check constraints of models with relationships
+	if len(stmt.Schema.Relationships.Relations) > 0 {
+		for _, chk := range stmt.Schema.ParseCheckConstraints() {
+			constraints = append(constraints, chk.Name)
+		}
+	}
+	for _, name := range constraints {
+		if live.HasConstraint(value, name) {
+			continue
+		}
+		if err := rec.step("create constraint "+name+" on "+table, func() error {
+			return plan.CreateConstraint(value, name)
+		}); err != nil {
+			return err
+		}
+	}
+	indexes := stmt.Schema.ParseIndexes()
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if live.HasIndex(value, name) {
+			continue
+		}
+		if err := rec.step("create index "+name+" on "+table, func() error {
+			return plan.CreateIndex(value, name)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planRecorder is the logger of the DryRun session of MigratePlan, collecting the SQL it builds.
+type planRecorder struct {
+	statements  []string
+	created     map[string]bool
+	unsupported bool
+}
+
+// step records the statements of fn, or a single unpredictable entry for desc when fn needs to read through
+// the DryRun session.
+func (r *planRecorder) step(desc string, fn func() error) (err error) {
+	start := len(r.statements)
+	r.unsupported = false
+	defer func() {
+		if p := recover(); p != nil || r.unsupported {
+			r.statements = append(r.statements[:start], UnpredictablePrefix+desc)
+			err = nil
+		}
+	}()
+	return fn()
+}
+
+func (r *planRecorder) LogMode(logger.LogLevel) logger.Interface {
+	return r
+}
+
+func (r *planRecorder) Info(context.Context, string, ...interface{}) {}
+
+func (r *planRecorder) Warn(context.Context, string, ...interface{}) {}
+
+func (r *planRecorder) Error(_ context.Context, msg string, _ ...interface{}) {
+	if strings.Contains(msg, gorm.ErrDryRunModeUnsupported.Error()) {
+		r.unsupported = true
+	}
+}
+
+func (r *planRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	if sql, _ := fc(); len(sql) > 0 {
+		r.statements = append(r.statements, sql)
+	}
+}
+
+func MigratePlan(models ...interface{}) ([]string, error) {
+	return DefaultDbMgt().MigratePlan(models...)
+}
+
+func WriteMigratePlan(w io.Writer) error {
+	return DefaultDbMgt().WriteMigratePlan(w)
+}
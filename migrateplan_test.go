@@ -0,0 +1,113 @@
+package dbwrap
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testPlanV1 struct {
+	ID   uint
+	Name string `gorm:"index"`
+}
+
+func (testPlanV1) TableName() string {
+	return "plans"
+}
+
+type testPlanV2 struct {
+	ID    uint
+	Name  string `gorm:"index"`
+	Price int
+	Code  string `gorm:"uniqueIndex"`
+}
+
+func (testPlanV2) TableName() string {
+	return "plans"
+}
+
+type testPlanV3 struct {
+	ID    uint
+	Name  string `gorm:"index"`
+	Price int
+	Code  string `gorm:"uniqueIndex;size:20;type:varchar(20)"`
+}
+
+func (testPlanV3) TableName() string {
+	return "plans"
+}
+
+// executedDDL returns the DDL statements of sql.
+func executedDDL(sql []string) []string {
+	var ddl []string
+	for _, s := range sql {
+		if strings.HasPrefix(s, "CREATE ") || strings.HasPrefix(s, "ALTER ") || strings.HasPrefix(s, "DROP ") {
+			ddl = append(ddl, s)
+		}
+	}
+	return ddl
+}
+
+func TestMigratePlan(t *testing.T) {
+	l := &recordLogger{}
+	// the prepared statements of sqlite keep the columns of the table when they were prepared
+	c := NewWithOptions(WithLogger(l), WithPrepareStmt(false)).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i, model := range []interface{}{&testPlanV1{}, &testPlanV2{}} {
+		plan, err := c.MigratePlan(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plan) <= 0 {
+			t.Fatalf("step %d: empty plan", i)
+		}
+		// the plan runs nothing
+		if has := c.Db().Migrator().HasTable("plans"); has != (i > 0) {
+			t.Fatalf("step %d: HasTable() = %v after MigratePlan", i, has)
+		}
+		start := len(l.SQL())
+		if err = c.db.AutoMigrate(model); err != nil {
+			t.Fatal(err)
+		}
+		if executed := executedDDL(l.SQL()[start:]); !reflect.DeepEqual(plan, executed) {
+			t.Errorf("step %d: MigratePlan() = %q, executed %q", i, plan, executed)
+		}
+		if plan, err = c.MigratePlan(model); err != nil || len(plan) != 0 {
+			t.Errorf("step %d: MigratePlan() = %q, %v after migrating, want nothing", i, plan, err)
+		}
+	}
+	// sqlite alters a column by rebuilding the table, from what it reads
+	plan, err := c.MigratePlan(&testPlanV3{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{UnpredictablePrefix + "alter column code of plans"}; !reflect.DeepEqual(plan, want) {
+		t.Errorf("MigratePlan() = %q, want %q", plan, want)
+	}
+	c.Register(&testPlanV3{})
+	var buf bytes.Buffer
+	if err = c.WriteMigratePlan(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), UnpredictablePrefix+"alter column code of plans\n"; got != want {
+		t.Errorf("WriteMigratePlan() wrote %q, want %q", got, want)
+	}
+}
+
+func TestWriteMigratePlan(t *testing.T) {
+	c := openSqlite(t)
+	c.Register(&testUser{})
+	var buf bytes.Buffer
+	if err := c.WriteMigratePlan(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "CREATE TABLE `test_users` (`id` integer,`name` text,PRIMARY KEY (`id`));\n"
+	if buf.String() != want {
+		t.Errorf("WriteMigratePlan() wrote %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,392 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MigrationsTable records the versioned migrations RunMigrations applied.
+const MigrationsTable = "dbwrap_migrations"
+
+// Migration is a versioned step for what AutoMigrate cannot express, e.g. a backfill or a column rename.
+// Migrations run once each, in ID order, so IDs are usually timestamps like "20210601120000_backfill_names".
+type Migration struct {
+	ID   string
+	Up   func(tx *gorm.DB) error
+	Down func(tx *gorm.DB) error
+}
+
+type migrationRecord struct {
+	ID        string `gorm:"primaryKey;size:255"`
+	AppliedAt time.Time
+}
+
+func (migrationRecord) TableName() string {
+	return MigrationsTable
+}
+
+// RegisterMigration registers versioned migrations for RunMigrations. A migration without ID or Up, without Down
+// after SetRequireDown, or with the ID of a registered one, is rejected.
+func (c *DbMgt) RegisterMigration(m ...Migration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ids := make(map[string]bool, len(c.migrations)+len(m))
+	for _, registered := range c.migrations {
+		ids[registered.ID] = true
+	}
+	for _, migration := range m {
+		if len(migration.ID) <= 0 {
+			return errors.New("dbwrap: migration without ID")
+		}
+		if migration.Up == nil {
+			return fmt.Errorf("dbwrap: migration %s without Up", migration.ID)
+		}
+		if migration.Down == nil && c.requireDown {
+			return fmt.Errorf("dbwrap: migration %s without Down", migration.ID)
+		}
+		if ids[migration.ID] {
+			return fmt.Errorf("dbwrap: migration %s is already registered", migration.ID)
+		}
+		ids[migration.ID] = true
+	}
+	c.migrations = append(c.migrations, m...)
+	return nil
+}
+
+// RunMigrations creates the MigrationsTable if needed and applies the pending migrations in ID order, recording
+// each one as it completes. On drivers with transactional DDL, i.e. postgres, sqlite and sqlserver, a migration
+// and its record are committed together. A runner of another process racing for the same migration waits for it
+// and skips the migration instead of applying it twice: on postgres thanks to a lock of the MigrationsTable, on
+// mysql and sqlserver to the named lock of MigrateWithLock held for the whole run, on sqlite it fails on the
+// record. On CockroachDB, where the migrations run outside of transactions, the record is inserted first so only
+// one runner applies the migration, and deleted again when it fails. It stops at the first failure.
+func (c *DbMgt) RunMigrations(ctx context.Context) error {
+	db, migrations, err := c.migrationsDB(ctx)
+	if err != nil {
+		return err
+	}
+	c.migrateLock.Lock()
+	defer c.migrateLock.Unlock()
+	release, err := c.lockMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer release()
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(applied))
+	for _, r := range applied {
+		done[r.ID] = true
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].ID < migrations[j].ID })
+	cockroach := isCockroach(db)
+	for _, m := range migrations {
+		if done[m.ID] {
+			continue
+		}
+		m, raced := m, false
+		err := runMigrationStep(db, func(tx *gorm.DB) error {
+			if cockroach {
+				raced, err = claimMigration(tx, m)
+				return err
+			}
+			if raced, err = lockMigration(tx, m.ID); err != nil || raced {
+				return err
+			}
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&migrationRecord{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("dbwrap: migration %s: %w", m.ID, err)
+		}
+		if c.log != nil && !raced {
+			c.log.Info(ctx, "dbwrap: applied migration %s", m.ID)
+		}
+	}
+	return nil
+}
+
+// MigrationStatus tells whether a migration was applied. A migration applied but no longer registered is
+// listed too, with Registered false.
+type MigrationStatus struct {
+	ID         string
+	Applied    bool
+	AppliedAt  time.Time
+	Registered bool
+}
+
+// RollbackError reports a rollback stopped by the failure of the migration Failed.
+type RollbackError struct {
+	// RolledBack are the migrations rolled back before the failure, the most recent first.
+	RolledBack []string
+	Failed     string
+	// Remaining are the migrations that were to be rolled back after Failed, which are still applied.
+	Remaining []string
+	Err       error
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("dbwrap: rollback %s: %v (rolled back %v, still applied %v)", e.Failed, e.Err,
+		e.RolledBack, e.Remaining)
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// SetRequireDown makes RegisterMigration reject the migrations without Down.
+func (c *DbMgt) SetRequireDown(require bool) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.requireDown = require
+	return c
+}
+
+// RollbackLast runs the Down of the last n applied migrations, the most recent first, each in a transaction with
+// the removal of its record. Nothing is rolled back when one of them is not registered or has no Down, and a
+// failure stops the rollback with a RollbackError.
+func (c *DbMgt) RollbackLast(ctx context.Context, n int) error {
+	return c.rollback(ctx, func(applied []migrationRecord) ([]migrationRecord, error) {
+		if n > len(applied) {
+			n = len(applied)
+		}
+		if n <= 0 {
+			return nil, nil
+		}
+		return applied[len(applied)-n:], nil
+	})
+}
+
+// RollbackTo rolls back, as RollbackLast does, the migrations applied after targetID, which stays applied.
+func (c *DbMgt) RollbackTo(ctx context.Context, targetID string) error {
+	return c.rollback(ctx, func(applied []migrationRecord) ([]migrationRecord, error) {
+		for i, r := range applied {
+			if r.ID == targetID {
+				return applied[i+1:], nil
+			}
+		}
+		return nil, fmt.Errorf("dbwrap: rollback to %s: migration is not applied", targetID)
+	})
+}
+
+// rollback rolls back the migrations pick selects among the applied ones, given in applied order.
+func (c *DbMgt) rollback(ctx context.Context, pick func(applied []migrationRecord) ([]migrationRecord, error)) error {
+	db, migrations, err := c.migrationsDB(ctx)
+	if err != nil {
+		return err
+	}
+	c.migrateLock.Lock()
+	defer c.migrateLock.Unlock()
+	release, err := c.lockMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer release()
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	picked, err := pick(applied)
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]Migration, len(migrations))
+	for _, m := range migrations {
+		byID[m.ID] = m
+	}
+	ids := make([]string, 0, len(picked))
+	for i := len(picked) - 1; i >= 0; i-- {
+		id := picked[i].ID
+		if m, ok := byID[id]; !ok {
+			return fmt.Errorf("dbwrap: rollback %s: migration is not registered", id)
+		} else if m.Down == nil {
+			return fmt.Errorf("dbwrap: rollback %s: migration has no Down", id)
+		}
+		ids = append(ids, id)
+	}
+	for i, id := range ids {
+		m := byID[id]
+		err := runMigrationStep(db, func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&migrationRecord{ID: id}).Error
+		})
+		if err != nil {
+			return &RollbackError{RolledBack: ids[:i], Failed: id, Remaining: ids[i+1:], Err: err}
+		}
+		if c.log != nil {
+			c.log.Info(ctx, "dbwrap: rolled back migration %s", id)
+		}
+	}
+	return nil
+}
+
+// Status lists the registered migrations in ID order, followed by the applied ones no longer registered.
+func (c *DbMgt) Status(ctx context.Context) ([]MigrationStatus, error) {
+	db, migrations, err := c.migrationsDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	records := make(map[string]migrationRecord, len(applied))
+	for _, r := range applied {
+		records[r.ID] = r
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].ID < migrations[j].ID })
+	status := make([]MigrationStatus, 0, len(migrations))
+	registered := make(map[string]bool, len(migrations))
+	for _, m := range migrations {
+		r, ok := records[m.ID]
+		status = append(status, MigrationStatus{ID: m.ID, Applied: ok, AppliedAt: r.AppliedAt, Registered: true})
+		registered[m.ID] = true
+	}
+	for _, r := range applied {
+		if !registered[r.ID] {
+			status = append(status, MigrationStatus{ID: r.ID, Applied: true, AppliedAt: r.AppliedAt})
+		}
+	}
+	return status, nil
+}
+
+// migrationsDB returns the database, with the MigrationsTable created, and a copy of the registered migrations.
+func (c *DbMgt) migrationsDB(ctx context.Context) (*gorm.DB, []Migration, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.lock.Lock()
+	migrations := append([]Migration(nil), c.migrations...)
+	c.lock.Unlock()
+	db = db.WithContext(ctx)
+	// the runners starting together race to create the table, the losers find it created
+	if err = db.AutoMigrate(&migrationRecord{}); err != nil && !db.Migrator().HasTable(&migrationRecord{}) {
+		return nil, nil, fmt.Errorf("dbwrap: create %s: %w", MigrationsTable, err)
+	}
+	return db, migrations, nil
+}
+
+// appliedMigrations returns the applied migrations in the order they were applied.
+func appliedMigrations(db *gorm.DB) ([]migrationRecord, error) {
+	var applied []migrationRecord
+	if err := db.Order("applied_at, id").Find(&applied).Error; err != nil {
+		return nil, fmt.Errorf("dbwrap: read %s: %w", MigrationsTable, err)
+	}
+	return applied, nil
+}
+
+// claimMigration records the migration m before applying it, and reports whether another runner recorded it
+// first.
+func claimMigration(db *gorm.DB, m Migration) (bool, error) {
+	claim := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&migrationRecord{ID: m.ID, AppliedAt: time.Now()})
+	if claim.Error != nil {
+		return false, claim.Error
+	}
+	if claim.RowsAffected <= 0 {
+		return true, nil
+	}
+	if err := m.Up(db); err != nil {
+		if delErr := db.Delete(&migrationRecord{ID: m.ID}).Error; delErr != nil {
+			return false, fmt.Errorf("%w (and delete its record: %v)", err, delErr)
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// lockMigration locks the MigrationsTable on postgres until the transaction ends, and reports whether another
+// runner applied the migration id meanwhile.
+func lockMigration(tx *gorm.DB, id string) (bool, error) {
+	if tx.Dialector.Name() == driverPostgres {
+		if err := tx.Exec("LOCK TABLE " + MigrationsTable + " IN EXCLUSIVE MODE").Error; err != nil {
+			return false, err
+		}
+	}
+	var count int64
+	if err := tx.Model(&migrationRecord{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// lockMigrations takes, on mysql and sqlserver, the named lock serializing the runners of the migrations of the
+// database, which the transactions cannot do there, and returns the func releasing it.
+func (c *DbMgt) lockMigrations(ctx context.Context, db *gorm.DB) (func(), error) {
+	switch db.Dialector.Name() {
+	case driverMysql, driverSqlServer:
+	default:
+		return func() {}, nil
+	}
+	c.lock.Lock()
+	timeout, namespace := c.lockTimeout, c.lockNamespace
+	c.lock.Unlock()
+	if timeout <= 0 {
+		timeout = defaultMigrationLockTimeout
+	}
+	key := "dbwrap_migrations:" + db.Migrator().CurrentDatabase()
+	if len(namespace) > 0 {
+		key += ":" + namespace
+	}
+	release, err := acquireMigrationLock(ctx, db, key, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := release(); err != nil && c.log != nil {
+			c.log.Error(nil, "dbwrap: release the migrations lock: %v", err)
+		}
+	}, nil
+}
+
+func runMigrationStep(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	switch db.Dialector.Name() {
+	case driverPostgres:
+		if isCockroach(db) {
+			// CockroachDB runs the schema changes of a transaction after its commit, where they can fail
+			return fn(db)
+		}
+		return db.Transaction(fn)
+	case driverSqlite, driverSqlServer:
+		return db.Transaction(fn)
+	default:
+		// DDL commits implicitly on mysql and clickhouse has no transactions
+		return fn(db)
+	}
+}
+
+func RegisterMigration(m ...Migration) error {
+	return DefaultDbMgt().RegisterMigration(m...)
+}
+
+func RunMigrations(ctx context.Context) error {
+	return DefaultDbMgt().RunMigrations(ctx)
+}
+
+func SetRequireDown(require bool) *DbMgt {
+	return DefaultDbMgt().SetRequireDown(require)
+}
+
+func RollbackLast(ctx context.Context, n int) error {
+	return DefaultDbMgt().RollbackLast(ctx, n)
+}
+
+func RollbackTo(ctx context.Context, targetID string) error {
+	return DefaultDbMgt().RollbackTo(ctx, targetID)
+}
+
+func Status(ctx context.Context) ([]MigrationStatus, error) {
+	return DefaultDbMgt().Status(ctx)
+}
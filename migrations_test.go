@@ -0,0 +1,230 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// tableMigration creates the table in Up and drops it in Down, counting the runs of each.
+func tableMigration(id, table string, ups, downs *int) Migration {
+	return Migration{
+		ID: id,
+		Up: func(tx *gorm.DB) error {
+			*ups++
+			return tx.Exec("CREATE TABLE " + table + " (id INTEGER PRIMARY KEY)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			*downs++
+			return tx.Exec("DROP TABLE " + table).Error
+		},
+	}
+}
+
+// appliedIDs returns the IDs of the applied migrations, in the order they were applied.
+func appliedIDs(t *testing.T, c *DbMgt) []string {
+	t.Helper()
+	var ids []string
+	if err := c.Db().Model(&migrationRecord{}).Order("applied_at, id").Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestRunMigrations(t *testing.T) {
+	c := openSqlite(t)
+	var ups, downs int
+	// registered out of order, applied in ID order
+	err := c.RegisterMigration(tableMigration("002_orders", "orders", &ups, &downs),
+		tableMigration("001_users", "users", &ups, &downs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err = c.RunMigrations(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := appliedIDs(t, c), []string{"001_users", "002_orders"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("applied %v, want %v", got, want)
+	}
+	for _, table := range []string{"users", "orders"} {
+		if !c.Db().Migrator().HasTable(table) {
+			t.Errorf("table %s is missing", table)
+		}
+	}
+	// a second run applies the new migrations only
+	if err = c.RegisterMigration(tableMigration("003_items", "items", &ups, &downs)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = c.RunMigrations(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ups != 3 {
+		t.Errorf("%d Up ran, want 3", ups)
+	}
+	if err = c.RollbackLast(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := appliedIDs(t, c), []string{"001_users"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("applied %v after the rollback, want %v", got, want)
+	}
+	if downs != 2 || c.Db().Migrator().HasTable("orders") || c.Db().Migrator().HasTable("items") {
+		t.Errorf("%d Down ran, want the last 2", downs)
+	}
+	if err = c.RollbackLast(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+	if ids := appliedIDs(t, c); len(ids) != 0 || downs != 3 {
+		t.Errorf("applied %v after rolling back everything, %d Down ran", ids, downs)
+	}
+	if err = c.RunMigrations(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ups != 6 {
+		t.Errorf("%d Up ran after the rollback, want 6", ups)
+	}
+}
+
+func TestRunMigrationsFailure(t *testing.T) {
+	c := openSqlite(t)
+	errUp := errors.New("up failed")
+	var ups, downs int
+	err := c.RegisterMigration(tableMigration("001_users", "users", &ups, &downs), Migration{
+		ID: "002_broken",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("CREATE TABLE broken (id INTEGER)").Error; err != nil {
+				return err
+			}
+			return errUp
+		},
+	}, tableMigration("003_items", "items", &ups, &downs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.RunMigrations(context.Background()); !errors.Is(err, errUp) {
+		t.Fatalf("RunMigrations error %v, want the Up error", err)
+	}
+	if got, want := appliedIDs(t, c), []string{"001_users"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("applied %v, want %v", got, want)
+	}
+	// the DDL of the failed migration is rolled back with its transaction
+	if c.Db().Migrator().HasTable("broken") || c.Db().Migrator().HasTable("items") {
+		t.Error("the failed migration or the next one left a table")
+	}
+}
+
+func TestRegisterMigration(t *testing.T) {
+	c := New(false, nil)
+	up := func(*gorm.DB) error { return nil }
+	if err := c.RegisterMigration(Migration{ID: "001", Up: up}); err != nil {
+		t.Fatal(err)
+	}
+	c.SetRequireDown(true)
+	for _, m := range []Migration{{Up: up}, {ID: "002"}, {ID: "002", Up: up},
+		{ID: "001", Up: up, Down: up}} {
+		if err := c.RegisterMigration(m); err == nil {
+			t.Errorf("RegisterMigration accepted %+v", m)
+		}
+	}
+	if err := c.RegisterMigration(Migration{ID: "002", Up: up, Down: up}); err != nil {
+		t.Error(err)
+	}
+	if err := c.RunMigrations(context.Background()); !errors.Is(err, ErrNotOpened) {
+		t.Errorf("RunMigrations error %v before Open, want ErrNotOpened", err)
+	}
+}
+
+func TestRollbackPartialFailure(t *testing.T) {
+	c := openSqlite(t)
+	errDown := errors.New("down failed")
+	var ups, downs int
+	broken := tableMigration("002_orders", "orders", &ups, &downs)
+	broken.Down = func(tx *gorm.DB) error {
+		if err := tx.Exec("DROP TABLE orders").Error; err != nil {
+			return err
+		}
+		return errDown
+	}
+	err := c.RegisterMigration(tableMigration("001_users", "users", &ups, &downs), broken,
+		tableMigration("003_items", "items", &ups, &downs), tableMigration("004_tags", "tags", &ups, &downs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err = c.RunMigrations(ctx); err != nil {
+		t.Fatal(err)
+	}
+	err = c.RollbackTo(ctx, "001_users")
+	var rollbackErr *RollbackError
+	if !errors.As(err, &rollbackErr) || !errors.Is(err, errDown) {
+		t.Fatalf("RollbackTo() = %v, want a RollbackError", err)
+	}
+	want := RollbackError{RolledBack: []string{"004_tags", "003_items"}, Failed: "002_orders", Remaining: []string{},
+		Err: errDown}
+	if !reflect.DeepEqual(*rollbackErr, want) {
+		t.Errorf("RollbackError = %+v, want %+v", *rollbackErr, want)
+	}
+	// the failed Down is rolled back with its transaction
+	if got, want := appliedIDs(t, c), []string{"001_users", "002_orders"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("applied %v, want %v", got, want)
+	}
+	if !c.Db().Migrator().HasTable("orders") {
+		t.Error("the failed Down dropped its table")
+	}
+	status, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range status {
+		got = append(got, fmt.Sprintf("%s %v %v", s.ID, s.Applied, s.Registered))
+		if s.Applied == s.AppliedAt.IsZero() {
+			t.Errorf("%s: applied %v at %v", s.ID, s.Applied, s.AppliedAt)
+		}
+	}
+	wantStatus := []string{"001_users true true", "002_orders true true", "003_items false true",
+		"004_tags false true"}
+	if !reflect.DeepEqual(got, wantStatus) {
+		t.Errorf("Status() = %v, want %v", got, wantStatus)
+	}
+	if err = c.RollbackTo(ctx, "003_items"); err == nil {
+		t.Error("RollbackTo accepted a migration that is not applied")
+	}
+}
+
+func TestRollbackUnknownMigration(t *testing.T) {
+	c := openSqlite(t)
+	var ups, downs int
+	if err := c.RegisterMigration(tableMigration("001_users", "users", &ups, &downs)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := c.RunMigrations(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// applied by a newer version of the service
+	if err := c.Db().Create(&migrationRecord{ID: "002_newer", AppliedAt: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	status, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 || status[1].ID != "002_newer" || !status[1].Applied || status[1].Registered {
+		t.Errorf("Status() = %+v, want the unregistered migration last", status)
+	}
+	// nothing is rolled back when a migration cannot be
+	if err = c.RollbackLast(ctx, 2); err == nil {
+		t.Error("RollbackLast rolled back an unregistered migration")
+	}
+	if downs != 0 {
+		t.Errorf("%d Down ran, want none", downs)
+	}
+}
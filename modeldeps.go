@@ -0,0 +1,111 @@
+package dbwrap
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// RegisterModel registers model to be migrated after the models it depends on, e.g. the ones its foreign keys
+// reference, whatever their registration order. The dependencies are registered too when they are not yet.
+// Register adds models without dependencies.
+func (c *DbMgt) RegisterModel(model interface{}, dependsOn ...interface{}) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	registered := make(map[reflect.Type]bool, len(c.models))
+	for _, m := range c.models {
+		registered[modelType(m)] = true
+	}
+	for _, dep := range dependsOn {
+		if !registered[modelType(dep)] {
+			registered[modelType(dep)] = true
+			c.models = append(c.models, dep)
+		}
+	}
+	t := modelType(model)
+	if !registered[t] {
+		c.models = append(c.models, model)
+	}
+	if c.modelDeps == nil {
+		c.modelDeps = make(map[reflect.Type][]reflect.Type)
+	}
+	for _, dep := range dependsOn {
+		c.modelDeps[t] = append(c.modelDeps[t], modelType(dep))
+	}
+	return c
+}
+
+func modelType(model interface{}) reflect.Type {
+	t := reflect.TypeOf(model)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// sortModels orders models so each comes after its dependencies, keeping the registration order otherwise
+// and dropping the models registered twice.
+func sortModels(models []interface{}, deps map[reflect.Type][]reflect.Type) ([]interface{}, error) {
+	byType := make(map[reflect.Type]interface{}, len(models))
+	var order []reflect.Type
+	for _, m := range models {
+		t := modelType(m)
+		if _, ok := byType[t]; !ok {
+			byType[t] = m
+			order = append(order, t)
+		}
+	}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[reflect.Type]int, len(order))
+	sorted := make([]interface{}, 0, len(order))
+	var path []reflect.Type
+	var visit func(t reflect.Type) error
+	visit = func(t reflect.Type) error {
+		switch state[t] {
+		case done:
+			return nil
+		case visiting:
+			return cycleError(path, t)
+		}
+		state[t] = visiting
+		path = append(path, t)
+		for _, dep := range deps[t] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[t] = done
+		if m, ok := byType[t]; ok {
+			sorted = append(sorted, m)
+		}
+		return nil
+	}
+	for _, t := range order {
+		if err := visit(t); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+func cycleError(path []reflect.Type, t reflect.Type) error {
+	var names []string
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i] == t {
+			for _, p := range path[i:] {
+				names = append(names, p.String())
+			}
+			break
+		}
+	}
+	names = append(names, t.String())
+	return fmt.Errorf("dbwrap: model dependency cycle: %s", strings.Join(names, " -> "))
+}
+
+func RegisterModel(model interface{}, dependsOn ...interface{}) *DbMgt {
+	return DefaultDbMgt().RegisterModel(model, dependsOn...)
+}
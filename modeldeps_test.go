@@ -0,0 +1,69 @@
+package dbwrap
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortModels(t *testing.T) {
+	c := New(false, nil)
+	c.RegisterModel(&testLine{}, &testInvoice{})
+	c.RegisterModel(&testInvoice{}, &testAccount{})
+	c.Register(&testUser{}, &testLine{})
+	sorted, err := sortModels(c.models, c.modelDeps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range sorted {
+		got = append(got, modelType(m).Name())
+	}
+	want := []string{"testAccount", "testInvoice", "testLine", "testUser"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortModels() = %v, want %v", got, want)
+	}
+}
+
+func TestSortModelsCycle(t *testing.T) {
+	c := New(false, nil)
+	c.RegisterModel(&testAccount{}, &testLine{})
+	c.RegisterModel(&testLine{}, &testInvoice{})
+	c.RegisterModel(&testInvoice{}, &testAccount{})
+	_, err := sortModels(c.models, c.modelDeps)
+	if err == nil {
+		t.Fatal("sortModels accepted a cycle")
+	}
+	want := "dbwrap.testLine -> dbwrap.testInvoice -> dbwrap.testAccount -> dbwrap.testLine"
+	if !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("sortModels error %q, want the cycle %s", err, want)
+	}
+	if err = c.Migrate(); err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("Migrate error %v, want the cycle", err)
+	}
+}
+
+func TestMigrateDependencyOrder(t *testing.T) {
+	l := &recordLogger{}
+	c := NewWithOptions(WithLogger(l)).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.RegisterModel(&testLine{}, &testInvoice{})
+	c.RegisterModel(&testInvoice{}, &testAccount{})
+	if err := c.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var created []string
+	for _, sql := range l.SQL() {
+		if strings.HasPrefix(sql, "CREATE TABLE") {
+			created = append(created, strings.Fields(sql)[2])
+		}
+	}
+	want := []string{"`test_accounts`", "`test_invoices`", "`test_lines`"}
+	if !reflect.DeepEqual(created, want) {
+		t.Errorf("created %v, want %v", created, want)
+	}
+}
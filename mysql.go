@@ -0,0 +1,85 @@
+package dbwrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+var mysqlTLSSeq uint64
+
+func (c *DbMgt) SetMysqlSocketParam(socketPath, user, password, name, charset, loc string, parseTime bool) *DbMgt {
+	return c.SetMysqlParam(socketPath, "", user, password, name, charset, loc, parseTime)
+}
+
+func (c *DbMgt) SetMysqlCollation(collation string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverMysql {
+		return errors.New("dbwrap: mysql collation requires the mysql driver")
+	}
+	if err := checkMysqlCollation(c.config.mysqlCharset(), collation); err != nil {
+		return err
+	}
+	c.config.Collation = collation
+	return nil
+}
+
+// SetMysqlTimeouts sets the dial, read and write timeouts of the mysql driver, zero leaves the driver default.
+func (c *DbMgt) SetMysqlTimeouts(dial, read, write time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverMysql {
+		return errors.New("dbwrap: mysql timeouts require the mysql driver")
+	}
+	for key, d := range map[string]time.Duration{"timeout": dial, "readTimeout": read, "writeTimeout": write} {
+		if d > 0 {
+			c.config.setOption(key, d.String())
+		} else {
+			delete(c.config.Options, key)
+		}
+	}
+	return nil
+}
+
+// SetMysqlTLS registers a TLS config with the mysql driver under a name unique to this call.
+func (c *DbMgt) SetMysqlTLS(serverName string, rootCAs *x509.CertPool, clientCerts []tls.Certificate, skipVerify bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverMysql {
+		return errors.New("dbwrap: mysql tls requires the mysql driver")
+	}
+	// a new name every call, as a clone keeps using the name, and so the TLS config, it was made with
+	c.config.tlsName = fmt.Sprintf("dbwrap-%d", atomic.AddUint64(&mysqlTLSSeq, 1))
+	c.config.tlsErr = mysqldriver.RegisterTLSConfig(c.config.tlsName, &tls.Config{
+		ServerName:         serverName,
+		RootCAs:            rootCAs,
+		Certificates:       clientCerts,
+		InsecureSkipVerify: skipVerify,
+	})
+	if c.config.tlsErr != nil {
+		c.config.tlsErr = fmt.Errorf("dbwrap: register mysql tls config: %w", c.config.tlsErr)
+	}
+	return c.config.tlsErr
+}
+
+func SetMysqlSocketParam(socketPath, user, password, name, charset, loc string, parseTime bool) *DbMgt {
+	return DefaultDbMgt().SetMysqlSocketParam(socketPath, user, password, name, charset, loc, parseTime)
+}
+
+func SetMysqlCollation(collation string) error {
+	return DefaultDbMgt().SetMysqlCollation(collation)
+}
+
+func SetMysqlTimeouts(dial, read, write time.Duration) error {
+	return DefaultDbMgt().SetMysqlTimeouts(dial, read, write)
+}
+
+func SetMysqlTLS(serverName string, rootCAs *x509.CertPool, clientCerts []tls.Certificate, skipVerify bool) error {
+	return DefaultDbMgt().SetMysqlTLS(serverName, rootCAs, clientCerts, skipVerify)
+}
@@ -0,0 +1,157 @@
+package dbwrap
+
+import (
+	"database/sql"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeMysqlCollations are the collations known to fakeMysqlServer, by the id the driver sends in the handshake.
+var fakeMysqlCollations = map[byte]string{33: "utf8_general_ci", 45: "utf8mb4_general_ci", 192: "utf8_unicode_ci",
+	224: "utf8mb4_unicode_ci"}
+
+// fakeMysqlServer is a mysql server accepting any user, which keeps the collation of each connection the way
+// mysql does: the one of the handshake, then the default one of the charset of a SET NAMES without COLLATE. It
+// answers SELECT @@collation_connection and SELECT VERSION(), and the other statements with an OK.
+type fakeMysqlServer struct {
+	ln net.Listener
+}
+
+func newFakeMysqlServer(t *testing.T) *fakeMysqlServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ln.Close()
+	})
+	s := &fakeMysqlServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeMysqlServer) addr() string {
+	return s.ln.Addr().String()
+}
+
+func writeMysqlPacket(w io.Writer, seq byte, payload []byte) error {
+	header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), seq}
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+func readMysqlPacket(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+func mysqlLenencString(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+var (
+	mysqlOK  = []byte{0x00, 0, 0, 0x02, 0, 0, 0}
+	mysqlEOF = []byte{0xfe, 0, 0, 0x02, 0}
+)
+
+func (s *fakeMysqlServer) serve(conn net.Conn) {
+	defer conn.Close()
+	var caps uint32 = 0x0001 | 0x0008 | 0x0200 | 0x8000 | 0x80000 // long password, with db, 4.1, secure auth, plugin
+	handshake := append([]byte{10}, "8.0.0-fake\x00"...)
+	handshake = append(handshake, 1, 0, 0, 0)
+	handshake = append(handshake, "12345678\x00"...)
+	handshake = append(handshake, byte(caps), byte(caps>>8), 45, 0x02, 0, byte(caps>>16), byte(caps>>24), 21)
+	handshake = append(handshake, make([]byte, 10)...)
+	handshake = append(handshake, "123456789012\x00mysql_native_password\x00"...)
+	if writeMysqlPacket(conn, 0, handshake) != nil {
+		return
+	}
+	response, err := readMysqlPacket(conn)
+	if err != nil || len(response) < 9 || writeMysqlPacket(conn, 2, mysqlOK) != nil {
+		return
+	}
+	collation := fakeMysqlCollations[response[8]]
+	for {
+		packet, err := readMysqlPacket(conn)
+		if err != nil || len(packet) <= 0 || packet[0] == 0x01 {
+			return
+		}
+		query := strings.TrimSpace(string(packet[1:]))
+		var value string
+		switch {
+		case packet[0] != 0x03:
+		case strings.HasPrefix(query, "SET NAMES "):
+			names := strings.Fields(query)
+			if len(names) >= 5 && strings.EqualFold(names[3], "COLLATE") {
+				collation = names[4]
+			} else {
+				collation = names[2] + "_general_ci"
+			}
+		case query == "SELECT @@collation_connection":
+			value = collation
+		case query == "SELECT VERSION()":
+			value = "8.0.0-fake"
+		}
+		if len(value) <= 0 {
+			if writeMysqlPacket(conn, 1, mysqlOK) != nil {
+				return
+			}
+			continue
+		}
+		column := append(mysqlLenencString("def"), 0, 0, 0)
+		column = append(column, mysqlLenencString("value")...)
+		column = append(column, 0, 0x0c, 33, 0, 255, 0, 0, 0, 0xfd, 0, 0, 0, 0, 0)
+		for i, payload := range [][]byte{{1}, column, mysqlEOF, mysqlLenencString(value), mysqlEOF} {
+			if writeMysqlPacket(conn, byte(i+1), payload) != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestMysqlCollationConnection(t *testing.T) {
+	s := newFakeMysqlServer(t)
+	host, port, _ := net.SplitHostPort(s.addr())
+	tests := []struct {
+		charset, collation string
+		want               string
+	}{
+		{"", "", "utf8mb4_general_ci"},
+		{"utf8", "", "utf8_general_ci"},
+		{"", "utf8mb4_unicode_ci", "utf8mb4_unicode_ci"},
+		{"utf8", "utf8_unicode_ci", "utf8_unicode_ci"},
+	}
+	for _, tt := range tests {
+		c := New(false, nil).SetMysqlParam(host, port, "user", "", "app", tt.charset, "", false)
+		if err := c.SetMysqlCollation(tt.collation); err != nil {
+			t.Fatal(err)
+		}
+		db, err := sql.Open("mysql", c.UnsafeDSN())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		if err = db.QueryRow("SELECT @@collation_connection").Scan(&got); err != nil {
+			t.Errorf("%s: %v", c.UnsafeDSN(), err)
+		} else if got != tt.want {
+			t.Errorf("%s: @@collation_connection = %q, want %q", c.UnsafeDSN(), got, tt.want)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,92 @@
+package dbwrap
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+)
+
+// notOpenedDialector backs the *gorm.DB returned by Db when the database is not open. It registers no
+// callbacks and has no connection, so every operation ends with the ErrNotOpened the db carries.
+type notOpenedDialector struct{}
+
+func (notOpenedDialector) Name() string {
+	return "dbwrap"
+}
+
+func (notOpenedDialector) Initialize(*gorm.DB) error {
+	return nil
+}
+
+func (d notOpenedDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return notOpenedMigrator{migrator.Migrator{Config: migrator.Config{DB: db, Dialector: d}}}
+}
+
+func (notOpenedDialector) DataTypeOf(field *schema.Field) string {
+	return string(field.DataType)
+}
+
+func (notOpenedDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (notOpenedDialector) BindVarTo(writer clause.Writer, _ *gorm.Statement, _ interface{}) {
+	writer.WriteByte('?')
+}
+
+func (notOpenedDialector) QuoteTo(writer clause.Writer, str string) {
+	writer.WriteString(str)
+}
+
+func (notOpenedDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, `'`, vars...)
+}
+
+// notOpenedMigrator fails every operation, the generic migrator would query the missing connection.
+type notOpenedMigrator struct {
+	migrator.Migrator
+}
+
+func (notOpenedMigrator) AutoMigrate(...interface{}) error               { return ErrNotOpened }
+func (notOpenedMigrator) CurrentDatabase() string                        { return "" }
+func (notOpenedMigrator) CreateTable(...interface{}) error               { return ErrNotOpened }
+func (notOpenedMigrator) DropTable(...interface{}) error                 { return ErrNotOpened }
+func (notOpenedMigrator) HasTable(interface{}) bool                      { return false }
+func (notOpenedMigrator) RenameTable(_, _ interface{}) error             { return ErrNotOpened }
+func (notOpenedMigrator) AddColumn(interface{}, string) error            { return ErrNotOpened }
+func (notOpenedMigrator) DropColumn(interface{}, string) error           { return ErrNotOpened }
+func (notOpenedMigrator) AlterColumn(interface{}, string) error          { return ErrNotOpened }
+func (notOpenedMigrator) HasColumn(interface{}, string) bool             { return false }
+func (notOpenedMigrator) RenameColumn(interface{}, string, string) error { return ErrNotOpened }
+func (notOpenedMigrator) ColumnTypes(interface{}) ([]gorm.ColumnType, error) {
+	return nil, ErrNotOpened
+}
+func (notOpenedMigrator) CreateView(string, gorm.ViewOption) error      { return ErrNotOpened }
+func (notOpenedMigrator) DropView(string) error                         { return ErrNotOpened }
+func (notOpenedMigrator) CreateConstraint(interface{}, string) error    { return ErrNotOpened }
+func (notOpenedMigrator) DropConstraint(interface{}, string) error      { return ErrNotOpened }
+func (notOpenedMigrator) HasConstraint(interface{}, string) bool        { return false }
+func (notOpenedMigrator) CreateIndex(interface{}, string) error         { return ErrNotOpened }
+func (notOpenedMigrator) DropIndex(interface{}, string) error           { return ErrNotOpened }
+func (notOpenedMigrator) HasIndex(interface{}, string) bool             { return false }
+func (notOpenedMigrator) RenameIndex(interface{}, string, string) error { return ErrNotOpened }
+
+var notOpenedDB = newNotOpenedDB()
+
+func newNotOpenedDB() *gorm.DB {
+	db, err := gorm.Open(notOpenedDialector{}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		panic(err)
+	}
+	db.Error = ErrNotOpened
+	return db
+}
+
+// unusable returns a new session failing with err.
+func unusable(err error) *gorm.DB {
+	db := notOpenedDB.Session(&gorm.Session{NewDB: true})
+	db.Error = err
+	return db
+}
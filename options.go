@@ -0,0 +1,137 @@
+package dbwrap
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const defaultSlowThreshold = 200 * time.Millisecond
+
+type options struct {
+	debug         bool
+	cfg           *gorm.Config
+	log           logger.Interface
+	eventLog      logger.Interface
+	slowThreshold time.Duration
+	prepareStmt   *bool
+	retryInterval time.Duration
+	retryMax      int
+}
+
+type Option func(*options)
+
+func WithDebug() Option {
+	return func(o *options) {
+		o.debug = true
+	}
+}
+
+// WithGormConfig uses a copy of cfg, so the same option can be shared by several instances.
+func WithGormConfig(cfg *gorm.Config) Option {
+	return func(o *options) {
+		if cfg == nil {
+			o.cfg = nil
+			return
+		}
+		copied := *cfg
+		o.cfg = &copied
+	}
+}
+
+func WithLogger(l logger.Interface) Option {
+	return func(o *options) {
+		o.log = l
+	}
+}
+
+// WithEventLogger sets the logger of the connection info, pool statistics and autotune lines, at Info level.
+func WithEventLogger(l logger.Interface) Option {
+	return func(o *options) {
+		o.eventLog = l
+	}
+}
+
+func WithSlowThreshold(d time.Duration) Option {
+	return func(o *options) {
+		o.slowThreshold = d
+	}
+}
+
+func WithPrepareStmt(enabled bool) Option {
+	return func(o *options) {
+		o.prepareStmt = &enabled
+	}
+}
+
+// WithOpenRetry makes Open retry a failed connection up to max more times, waiting interval between attempts.
+func WithOpenRetry(interval time.Duration, max int) Option {
+	return func(o *options) {
+		o.retryInterval, o.retryMax = interval, max
+	}
+}
+
+func NewWithOptions(opts ...Option) *DbMgt {
+	o := options{slowThreshold: defaultSlowThreshold}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	mgt := &DbMgt{cfg: o.cfg, retryInterval: o.retryInterval, retryMax: o.retryMax,
+		stateChanged: time.Now()}
+	if mgt.cfg == nil {
+		mgt.cfg = &gorm.Config{
+			PrepareStmt: true,
+		}
+	}
+	if o.prepareStmt != nil {
+		mgt.cfg.PrepareStmt = *o.prepareStmt
+	}
+	mgt.log = logger.Default
+	if o.log != nil {
+		mgt.log = o.log
+		if mgt.cfg.Logger == nil {
+			mgt.cfg.Logger = o.log
+		}
+	}
+	if o.debug {
+		logger.Default = newStderrLogger(o.slowThreshold)
+		if mgt.cfg.Logger == nil {
+			mgt.cfg.Logger = logger.Default
+		}
+		mgt.debug = 1
+	} else {
+		logger.Default = logger.Discard
+	}
+	// the lines asked for with SetLogConnectionInfo, StartPoolStatsLogger and StartPoolAutotune must not be discarded
+	switch {
+	case o.eventLog != nil:
+		mgt.eventLog = o.eventLog
+	case o.log != nil:
+		mgt.eventLog = o.log.LogMode(logger.Info)
+	default:
+		mgt.eventLog = newEventLogger()
+	}
+	// the logger of debug sessions, which must not be the discarding default when debug is turned on later
+	if mgt.cfg.Logger != nil {
+		mgt.debugLog = mgt.cfg.Logger
+	} else {
+		mgt.debugLog = newStderrLogger(o.slowThreshold)
+	}
+	return mgt
+}
+
+func newEventLogger() logger.Interface {
+	return logger.New(log.New(os.Stderr, "", log.LstdFlags), logger.Config{LogLevel: logger.Info})
+}
+
+func newStderrLogger(slowThreshold time.Duration) logger.Interface {
+	return logger.New(
+		log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile),
+		logger.Config{SlowThreshold: slowThreshold, LogLevel: logger.Warn, Colorful: true},
+	)
+}
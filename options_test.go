@@ -0,0 +1,163 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordLogger is a logger.Interface keeping the lines logged and the SQL traced.
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+	sql   []string
+}
+
+func (l *recordLogger) LogMode(logger.LogLevel) logger.Interface {
+	return l
+}
+
+func (l *recordLogger) Info(_ context.Context, msg string, args ...interface{}) {
+	l.add(fmt.Sprintf(msg, args...))
+}
+
+func (l *recordLogger) Warn(_ context.Context, msg string, args ...interface{}) {
+	l.add(fmt.Sprintf(msg, args...))
+}
+
+func (l *recordLogger) Error(_ context.Context, msg string, args ...interface{}) {
+	l.add(fmt.Sprintf(msg, args...))
+}
+
+func (l *recordLogger) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sql = append(l.sql, sql)
+}
+
+func (l *recordLogger) add(line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, line)
+}
+
+func (l *recordLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func (l *recordLogger) SQL() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.sql...)
+}
+
+func TestNewWithOptionsDefaults(t *testing.T) {
+	c := NewWithOptions()
+	if c.cfg == nil || !c.cfg.PrepareStmt {
+		t.Errorf("cfg = %+v, want PrepareStmt", c.cfg)
+	}
+	if c.debug != 0 || c.retryMax != 0 || c.retryInterval != 0 {
+		t.Errorf("debug %d, retry %d/%s, want none", c.debug, c.retryMax, c.retryInterval)
+	}
+	if c.log != logger.Default {
+		t.Error("log is not the default logger")
+	}
+	if c.eventLog == nil || c.debugLog == nil {
+		t.Error("eventLog or debugLog is nil")
+	}
+}
+
+func TestWithDebug(t *testing.T) {
+	c := NewWithOptions(WithDebug())
+	if c.debug != 1 {
+		t.Errorf("debug = %d, want 1", c.debug)
+	}
+	if c.cfg.Logger == nil || c.cfg.Logger != c.debugLog {
+		t.Error("the gorm logger is not the debug logger")
+	}
+}
+
+func TestWithGormConfig(t *testing.T) {
+	cfg := &gorm.Config{SkipDefaultTransaction: true}
+	c := NewWithOptions(WithGormConfig(cfg))
+	if c.cfg == cfg {
+		t.Fatal("the gorm config is not copied")
+	}
+	if !c.cfg.SkipDefaultTransaction || c.cfg.PrepareStmt {
+		t.Errorf("cfg = %+v, want the given flags", c.cfg)
+	}
+	cfg.SkipDefaultTransaction = false
+	if !c.cfg.SkipDefaultTransaction {
+		t.Error("changing the given config changed the instance")
+	}
+	if c = NewWithOptions(WithGormConfig(nil)); c.cfg == nil || !c.cfg.PrepareStmt {
+		t.Errorf("cfg = %+v, want the default config", c.cfg)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	l := &recordLogger{}
+	c := NewWithOptions(WithLogger(l))
+	if c.log != l || c.cfg.Logger != l || c.debugLog != l || c.eventLog != l {
+		t.Error("the logger is not used for every log")
+	}
+	c = NewWithOptions(WithGormConfig(&gorm.Config{Logger: logger.Discard}), WithLogger(l))
+	if c.log != l || c.cfg.Logger != logger.Discard {
+		t.Error("WithLogger replaced the logger of the gorm config")
+	}
+}
+
+func TestWithEventLogger(t *testing.T) {
+	l, events := &recordLogger{}, &recordLogger{}
+	c := NewWithOptions(WithLogger(l), WithEventLogger(events))
+	if c.eventLog != events || c.log != l {
+		t.Error("WithEventLogger is not used for the events only")
+	}
+	other := &recordLogger{}
+	if c.SetEventLogger(other); c.events() != other {
+		t.Error("SetEventLogger did not replace the event logger")
+	}
+}
+
+func TestWithSlowThreshold(t *testing.T) {
+	c := NewWithOptions(WithSlowThreshold(time.Second))
+	threshold := reflect.ValueOf(c.debugLog).Elem().FieldByName("SlowThreshold")
+	if !threshold.IsValid() || time.Duration(threshold.Int()) != time.Second {
+		t.Errorf("SlowThreshold = %v, want 1s", threshold)
+	}
+}
+
+func TestWithPrepareStmt(t *testing.T) {
+	if c := NewWithOptions(WithPrepareStmt(false)); c.cfg.PrepareStmt {
+		t.Error("PrepareStmt is still on")
+	}
+	cfg := &gorm.Config{}
+	if c := NewWithOptions(WithGormConfig(cfg), WithPrepareStmt(true)); !c.cfg.PrepareStmt || cfg.PrepareStmt {
+		t.Error("WithPrepareStmt did not turn PrepareStmt on the copy only")
+	}
+}
+
+func TestWithOpenRetry(t *testing.T) {
+	c := NewWithOptions(WithOpenRetry(time.Millisecond, 3), nil)
+	if c.retryInterval != time.Millisecond || c.retryMax != 3 {
+		t.Errorf("retry %d/%s, want 3/1ms", c.retryMax, c.retryInterval)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if c := New(true, nil); c.debug != 1 || !c.cfg.PrepareStmt {
+		t.Errorf("New(true, nil): debug %d, cfg %+v", c.debug, c.cfg)
+	}
+	if c := New(false, &gorm.Config{}); c.debug != 0 || c.cfg.PrepareStmt {
+		t.Errorf("New(false, cfg): debug %d, cfg %+v", c.debug, c.cfg)
+	}
+}
@@ -0,0 +1,134 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ModelOptions tunes how Migrate creates the table of a model registered with RegisterModelWithOptions.
+type ModelOptions struct {
+	// PartitionBy makes the table a partitioned one on postgres, e.g. "RANGE (created_at)". It is raw SQL and
+	// Migrate fails on the other drivers when it is set.
+	PartitionBy string
+}
+
+// PartitionInfo describes a partition of a table, Bound being its bound as postgres prints it, e.g.
+// "FOR VALUES FROM ('2024-01-01') TO ('2024-02-01')".
+type PartitionInfo struct {
+	Name  string
+	Bound string
+}
+
+// RegisterModelWithOptions is RegisterModel creating the table of model with opts.
+func (c *DbMgt) RegisterModelWithOptions(model interface{}, opts ModelOptions, dependsOn ...interface{}) *DbMgt {
+	c.RegisterModel(model, dependsOn...)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.modelOpts == nil {
+		c.modelOpts = make(map[reflect.Type]ModelOptions)
+	}
+	c.modelOpts[modelType(model)] = opts
+	return c
+}
+
+func copyModelOpts(opts map[reflect.Type]ModelOptions) map[reflect.Type]ModelOptions {
+	copied := make(map[reflect.Type]ModelOptions, len(opts))
+	for t, o := range opts {
+		copied[t] = o
+	}
+	return copied
+}
+
+// tableOptions returns the options of the CREATE TABLE of model on driver, from its ModelOptions and
+// TableOptioner.
+func tableOptions(driver string, model interface{}, opts ModelOptions) (string, error) {
+	var options []string
+	if len(opts.PartitionBy) > 0 {
+		if driver != driverPostgres {
+			return "", fmt.Errorf("dbwrap: %s: %s has no partitioned tables", modelType(model), driver)
+		}
+		options = append(options, "PARTITION BY "+opts.PartitionBy)
+	}
+	if t, ok := model.(TableOptioner); ok {
+		options = append(options, t.TableOptions())
+	}
+	return strings.Join(options, " "), nil
+}
+
+// CreatePartition creates the partition name of the table of model, registered with a RANGE PartitionBy,
+// holding the rows from fromExpr included to toExpr excluded. The expressions are raw SQL, e.g.
+// "'2024-01-01'", or MINVALUE and MAXVALUE. It does nothing when the partition exists.
+func (c *DbMgt) CreatePartition(ctx context.Context, model interface{}, name, fromExpr, toExpr string) error {
+	db, parent, err := c.partitioned(ctx, model)
+	if err != nil {
+		return err
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err = db.Exec(partitionSQL(stmt.Quote, parent, name, fromExpr, toExpr)).Error; err != nil {
+		return fmt.Errorf("dbwrap: create partition %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListPartitions returns the partitions of the table of model sorted by name.
+func (c *DbMgt) ListPartitions(ctx context.Context, model interface{}) ([]PartitionInfo, error) {
+	db, parent, err := c.partitioned(ctx, model)
+	if err != nil {
+		return nil, err
+	}
+	stmt := &gorm.Statement{DB: db}
+	var partitions []PartitionInfo
+	err = db.Raw("SELECT c.relname AS name, pg_get_expr(c.relpartbound, c.oid) AS bound FROM pg_inherits i "+
+		"JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = ?::regclass ORDER BY c.relname",
+		stmt.Quote(parent)).Scan(&partitions).Error
+	if err != nil {
+		return nil, err
+	}
+	return partitions, nil
+}
+
+// partitioned returns the database bound to ctx and the table of model, which must be registered with a
+// RANGE PartitionBy on postgres.
+func (c *DbMgt) partitioned(ctx context.Context, model interface{}) (*gorm.DB, string, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return nil, "", err
+	}
+	if db.Dialector.Name() != driverPostgres {
+		return nil, "", fmt.Errorf("dbwrap: %s has no partitioned tables", db.Dialector.Name())
+	}
+	c.lock.Lock()
+	opts := c.modelOpts[modelType(model)]
+	c.lock.Unlock()
+	if fields := strings.Fields(opts.PartitionBy); len(fields) <= 0 || !strings.EqualFold(fields[0], "RANGE") {
+		return nil, "", fmt.Errorf("dbwrap: %s is not registered with a RANGE PartitionBy", modelType(model))
+	}
+	table, err := tableOf(db, model)
+	if err != nil {
+		return nil, "", err
+	}
+	return db.WithContext(ctx), table, nil
+}
+
+// partitionSQL returns the statement creating the partition name of the range partitioned table parent, in
+// the schema of parent, quoting the identifiers with quote.
+func partitionSQL(quote func(interface{}) string, parent, name, fromExpr, toExpr string) string {
+	return "CREATE TABLE IF NOT EXISTS " + quote(indexName(parent, name)) + " PARTITION OF " + quote(parent) +
+		" FOR VALUES FROM (" + fromExpr + ") TO (" + toExpr + ")"
+}
+
+func RegisterModelWithOptions(model interface{}, opts ModelOptions, dependsOn ...interface{}) *DbMgt {
+	return DefaultDbMgt().RegisterModelWithOptions(model, opts, dependsOn...)
+}
+
+func CreatePartition(ctx context.Context, model interface{}, name, fromExpr, toExpr string) error {
+	return DefaultDbMgt().CreatePartition(ctx, model, name, fromExpr, toExpr)
+}
+
+func ListPartitions(ctx context.Context, model interface{}) ([]PartitionInfo, error) {
+	return DefaultDbMgt().ListPartitions(ctx, model)
+}
@@ -0,0 +1,77 @@
+//go:build postgres
+// +build postgres
+
+package dbwrap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPartitionsPostgres(t *testing.T) {
+	c := openPostgres(t)
+	drop := func() {
+		if err := c.DropTables(context.Background(), true, &testEvent{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	drop()
+	defer drop()
+	c.RegisterModelWithOptions(&testEvent{}, ModelOptions{PartitionBy: "RANGE (created_at)"})
+	if err := c.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	var strategy string
+	err := c.Db().Raw("SELECT partstrat FROM pg_partitioned_table WHERE partrelid = 'test_events'::regclass").
+		Scan(&strategy).Error
+	if err != nil || strategy != "r" {
+		t.Fatalf("partition strategy = %q, %v, want r for range", strategy, err)
+	}
+	ctx := context.Background()
+	partitions := []struct{ name, from, to string }{
+		{"test_events_2024_02", "'2024-02-01'", "'2024-03-01'"},
+		{"test_events_2024_01", "'2024-01-01'", "'2024-02-01'"},
+	}
+	for i := 0; i < 2; i++ {
+		for _, p := range partitions {
+			if err = c.CreatePartition(ctx, &testEvent{}, p.name, p.from, p.to); err != nil {
+				t.Fatalf("CreatePartition(%s) #%d: %v", p.name, i+1, err)
+			}
+		}
+	}
+	got, err := c.ListPartitions(ctx, &testEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the bounds are printed in the time zone of the server
+	want := []struct{ name, from string }{
+		{"test_events_2024_01", "FOR VALUES FROM ('2024-01-01"},
+		{"test_events_2024_02", "FOR VALUES FROM ('2024-02-01"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ListPartitions() = %+v, want %d partitions", got, len(want))
+	}
+	for i, p := range got {
+		if p.Name != want[i].name || !strings.HasPrefix(p.Bound, want[i].from) {
+			t.Errorf("partition %d = %+v, want %s %s...", i, p, want[i].name, want[i].from)
+		}
+	}
+	// the rows go to the partition of their date, and nowhere without one
+	event := testEvent{ID: 1, CreatedAt: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), Kind: "login"}
+	if err = c.Db().Create(&event).Error; err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err = c.Db().Table("test_events_2024_01").Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("%d rows, %v in the January partition, want 1", count, err)
+	}
+	event = testEvent{ID: 2, CreatedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err = c.Db().Create(&event).Error; err == nil {
+		t.Error("a row without partition was inserted")
+	}
+	if err = c.CreatePartition(ctx, &testUser{}, "test_users_1", "1", "10"); err == nil {
+		t.Error("CreatePartition accepted a model registered without PartitionBy")
+	}
+}
@@ -0,0 +1,89 @@
+package dbwrap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type testEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"primaryKey"`
+	Kind      string
+}
+
+// testMergeEvent has the table options of a clickhouse table.
+type testMergeEvent struct {
+	ID uint
+}
+
+func (testMergeEvent) TableOptions() string {
+	return "ENGINE=MergeTree() ORDER BY id"
+}
+
+func TestPartitionSQL(t *testing.T) {
+	stmt := &gorm.Statement{DB: &gorm.DB{Config: &gorm.Config{Dialector: postgres.Dialector{}}}}
+	tests := []struct {
+		parent, name, from, to, want string
+	}{
+		{"events", "events_2024_01", "'2024-01-01'", "'2024-02-01'", `CREATE TABLE IF NOT EXISTS "events_2024_01" ` +
+			`PARTITION OF "events" FOR VALUES FROM ('2024-01-01') TO ('2024-02-01')`},
+		// the partition goes to the schema of its parent
+		{"billing.events", "events_old", "MINVALUE", "'2024-01-01'", `CREATE TABLE IF NOT EXISTS ` +
+			`"billing"."events_old" PARTITION OF "billing"."events" FOR VALUES FROM (MINVALUE) TO ('2024-01-01')`},
+	}
+	for _, tt := range tests {
+		if got := partitionSQL(stmt.Quote, tt.parent, tt.name, tt.from, tt.to); got != tt.want {
+			t.Errorf("partitionSQL(%s, %s) = %s, want %s", tt.parent, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTableOptions(t *testing.T) {
+	partitioned := ModelOptions{PartitionBy: "RANGE (created_at)"}
+	tests := []struct {
+		driver string
+		model  interface{}
+		opts   ModelOptions
+		want   string
+	}{
+		{driverPostgres, &testEvent{}, partitioned, "PARTITION BY RANGE (created_at)"},
+		{driverPostgres, &testEvent{}, ModelOptions{}, ""},
+		{driverSqlite, &testEvent{}, ModelOptions{}, ""},
+		{"clickhouse", &testMergeEvent{}, ModelOptions{}, "ENGINE=MergeTree() ORDER BY id"},
+		{driverPostgres, &testMergeEvent{}, partitioned, "PARTITION BY RANGE (created_at) ENGINE=MergeTree() ORDER BY id"},
+	}
+	for _, tt := range tests {
+		if got, err := tableOptions(tt.driver, tt.model, tt.opts); err != nil || got != tt.want {
+			t.Errorf("tableOptions(%s, %T, %+v) = %q, %v, want %q", tt.driver, tt.model, tt.opts, got, err, tt.want)
+		}
+	}
+	for _, driver := range []string{driverSqlite, driverMysql, driverSqlServer, "clickhouse"} {
+		_, err := tableOptions(driver, &testEvent{}, partitioned)
+		if err == nil || !strings.Contains(err.Error(), "no partitioned tables") {
+			t.Errorf("tableOptions(%s) = %v, want the partitions refused", driver, err)
+		}
+	}
+}
+
+func TestPartitionsSqlite(t *testing.T) {
+	c := openSqlite(t)
+	c.RegisterModelWithOptions(&testEvent{}, ModelOptions{PartitionBy: "RANGE (created_at)"})
+	if err := c.Migrate(); err == nil || !strings.Contains(err.Error(), "sqlite has no partitioned tables") {
+		t.Errorf("Migrate() = %v, want the partitions refused", err)
+	}
+	if has, _ := c.HasTable(&testEvent{}); has {
+		t.Error("Migrate created the table without its partitioning")
+	}
+	err := c.CreatePartition(context.Background(), &testEvent{}, "events_2024", "'2024-01-01'", "'2025-01-01'")
+	if err == nil {
+		t.Error("CreatePartition succeeded on sqlite")
+	}
+	if _, err = c.ListPartitions(context.Background(), &testEvent{}); err == nil {
+		t.Error("ListPartitions succeeded on sqlite")
+	}
+}
@@ -0,0 +1,62 @@
+//go:build postgres
+// +build postgres
+
+package dbwrap
+
+import (
+	"testing"
+)
+
+func TestPgSchemaPostgres(t *testing.T) {
+	admin := openPostgres(t)
+	schemas := []string{"dbwrap_test_a", "dbwrap_test_b"}
+	drop := func() {
+		for _, name := range schemas {
+			if err := admin.Db().Exec("DROP SCHEMA IF EXISTS " + pgQuoteIdent(name) + " CASCADE").Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	drop()
+	defer drop()
+	instances := make([]*DbMgt, len(schemas))
+	for i, name := range schemas {
+		c, err := NewFromConfig(admin.Config())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.SetPgSchema(name); err != nil {
+			t.Fatal(err)
+		}
+		if err = c.SetEnsureSchema(true).Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		// the same model in each schema
+		if err = c.Migrate(&testUser{}); err != nil {
+			t.Fatal(err)
+		}
+		instances[i] = c
+	}
+	for i, c := range instances {
+		for j := 0; j <= i; j++ {
+			if err := c.Db().Create(&testUser{Name: schemas[i]}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i, c := range instances {
+		var count int64
+		if err := c.Db().Model(&testUser{}).Count(&count).Error; err != nil || count != int64(i+1) {
+			t.Errorf("schema %s: %d users, %v, want %d", schemas[i], count, err, i+1)
+		}
+		var searchPath string
+		if err := c.Db().Raw("SHOW search_path").Scan(&searchPath).Error; err != nil || searchPath != schemas[i] {
+			t.Errorf("search_path = %q, %v, want %s", searchPath, err, schemas[i])
+		}
+		tables, err := c.ListTables()
+		if err != nil || len(tables) != 1 || tables[0] != "test_users" {
+			t.Errorf("ListTables() = %v, %v, want the table of the schema", tables, err)
+		}
+	}
+}
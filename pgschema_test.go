@@ -0,0 +1,47 @@
+package dbwrap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetPgSchema(t *testing.T) {
+	c := New(false, nil).SetPgParam("db.local", "", "user", "", "app", false)
+	if err := c.SetTablePrefix("app_"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetPgSchema("billing"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(c.UnsafeDSN(), ` search_path="billing"`) {
+		t.Errorf("UnsafeDSN() = %q, want the schema in the search_path", c.UnsafeDSN())
+	}
+	if got := c.cfg.NamingStrategy.TableName("TestUser"); got != "billing.app_test_users" {
+		t.Errorf("TableName() = %q, want the schema and the prefix", got)
+	}
+	// another schema or prefix replaces the previous one
+	if err := c.SetPgSchema("Sales_2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetTablePrefix("crm_"); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.cfg.NamingStrategy.TableName("TestUser"); got != "Sales_2.crm_test_users" {
+		t.Errorf("TableName() = %q, want the new schema and prefix", got)
+	}
+	if !strings.HasSuffix(c.UnsafeDSN(), ` search_path="Sales_2"`) {
+		t.Errorf("UnsafeDSN() = %q, want the new schema in the search_path", c.UnsafeDSN())
+	}
+	for _, name := range []string{"", "1st", "pg_catalog", "PG_temp", `a"b`, "a;DROP", "a b",
+		strings.Repeat("a", 64)} {
+		if err := c.SetPgSchema(name); err == nil {
+			t.Errorf("SetPgSchema(%q) accepted an invalid name", name)
+		}
+	}
+	if err := New(false, nil).SetSqlite3Param("test.db").SetPgSchema("billing"); err == nil {
+		t.Error("SetPgSchema accepted the sqlite driver")
+	}
+	if got := pgQuoteIdent(`my "schema"`); got != `"my ""schema"""` {
+		t.Errorf("pgQuoteIdent() = %s", got)
+	}
+}
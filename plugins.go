@@ -0,0 +1,48 @@
+package dbwrap
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// RegisterPlugin registers p on the database when it is open, and on every connection pool Open and Reopen
+// establish, an error of p.Initialize failing them. A plugin is initialized again for each pool, the ones of
+// the instances Clone returns included, so it must support being used by several pools. A second plugin with
+// the same name is rejected.
+func (c *DbMgt) RegisterPlugin(p gorm.Plugin) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	name := p.Name()
+	for _, registered := range c.plugins {
+		if registered.Name() == name {
+			return fmt.Errorf("dbwrap: plugin %s is already registered", name)
+		}
+	}
+	if c.cfg != nil {
+		if _, ok := c.cfg.Plugins[name]; ok {
+			return fmt.Errorf("dbwrap: plugin %s is already in the gorm config", name)
+		}
+	}
+	if c.db != nil {
+		if err := c.db.Use(p); err != nil {
+			return fmt.Errorf("dbwrap: register plugin %s: %w", name, err)
+		}
+	}
+	c.plugins = append(c.plugins, p)
+	return nil
+}
+
+// usePlugins must be called with c locked.
+func (c *DbMgt) usePlugins(db *gorm.DB) error {
+	for _, p := range c.plugins {
+		if err := db.Use(p); err != nil {
+			return fmt.Errorf("dbwrap: register plugin %s: %w", p.Name(), err)
+		}
+	}
+	return nil
+}
+
+func RegisterPlugin(p gorm.Plugin) error {
+	return DefaultDbMgt().RegisterPlugin(p)
+}
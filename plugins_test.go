@@ -0,0 +1,101 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// countingPlugin counts the pools it is initialized on, failing with err when it is set.
+type countingPlugin struct {
+	name  string
+	inits int32
+	err   error
+}
+
+func (p *countingPlugin) Name() string {
+	return p.name
+}
+
+func (p *countingPlugin) Initialize(*gorm.DB) error {
+	atomic.AddInt32(&p.inits, 1)
+	return p.err
+}
+
+func (p *countingPlugin) count() int32 {
+	return atomic.LoadInt32(&p.inits)
+}
+
+func TestRegisterPlugin(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	p := &countingPlugin{name: "counting"}
+	if err := c.RegisterPlugin(p); err != nil {
+		t.Fatal(err)
+	}
+	if p.count() != 0 {
+		t.Fatalf("the plugin is initialized %d times before Open, want 0", p.count())
+	}
+	if err := c.RegisterPlugin(&countingPlugin{name: "counting"}); err == nil {
+		t.Error("RegisterPlugin accepted a second plugin with the same name")
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if p.count() != 1 {
+		t.Errorf("the plugin is initialized %d times after Open, want 1", p.count())
+	}
+	if _, ok := c.Db().Config.Plugins["counting"]; !ok {
+		t.Error("the plugin is not in the gorm config")
+	}
+	if err := c.Reopen(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.count() != 2 {
+		t.Errorf("the plugin is initialized %d times after Reopen, want 2", p.count())
+	}
+	// an open instance registers the plugin at once
+	late := &countingPlugin{name: "late"}
+	if err := c.RegisterPlugin(late); err != nil {
+		t.Fatal(err)
+	}
+	if late.count() != 1 {
+		t.Errorf("the late plugin is initialized %d times, want 1", late.count())
+	}
+	clone := c.Clone()
+	if err := clone.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer clone.Close()
+	if p.count() != 3 || late.count() != 2 {
+		t.Errorf("the plugins are initialized %d and %d times after opening the clone, want 3 and 2",
+			p.count(), late.count())
+	}
+}
+
+func TestRegisterPluginFailure(t *testing.T) {
+	errInit := errors.New("init failed")
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.RegisterPlugin(&countingPlugin{name: "failing", err: errInit}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Open()
+	if !errors.Is(err, errInit) {
+		t.Errorf("Open error %v, want the plugin error", err)
+	}
+	if c.IsOpen() {
+		c.Close()
+		t.Fatal("the instance is open after the plugin failed")
+	}
+	c = openSqlite(t)
+	if err = c.RegisterPlugin(&countingPlugin{name: "failing", err: errInit}); !errors.Is(err, errInit) {
+		t.Errorf("RegisterPlugin error %v on an open instance, want the plugin error", err)
+	}
+	if err = c.RegisterPlugin(&countingPlugin{name: "failing"}); err != nil {
+		t.Errorf("RegisterPlugin error %v after the failed plugin, want it not kept", err)
+	}
+}
@@ -0,0 +1,228 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// PoolStats returns the statistics of the open pool, also while it is drained. It returns ErrNotOpened instead
+// of opening the database when EnableLazyOpen was called.
+func (c *DbMgt) PoolStats() (sql.DBStats, error) {
+	c.lock.Lock()
+	gormDB := c.db
+	c.lock.Unlock()
+	if gormDB == nil {
+		return sql.DBStats{}, ErrNotOpened
+	}
+	db, err := gormDB.DB()
+	if err != nil {
+		return sql.DBStats{}, err
+	}
+	return db.Stats(), nil
+}
+
+// poolConsumer receives the pool statistics every interval, until its ctx, if any, is done.
+type poolConsumer struct {
+	ctx      context.Context
+	interval time.Duration
+	due      time.Time
+	fn       func(stats sql.DBStats)
+}
+
+// poolSampler runs one goroutine sampling the pool for the stats logger and the pressure hook, at the
+// interval of each.
+type poolSampler struct {
+	lock      sync.Mutex
+	consumers []*poolConsumer
+	wake      chan struct{}
+	running   bool
+}
+
+func (c *DbMgt) addPoolConsumer(pc *poolConsumer) {
+	if pc.interval <= 0 {
+		return
+	}
+	s := &c.sampler
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pc.due = time.Now().Add(pc.interval)
+	s.consumers = append(s.consumers, pc)
+	if s.wake == nil {
+		s.wake = make(chan struct{}, 1)
+	}
+	if pc.ctx != nil && pc.ctx.Done() != nil {
+		// the sampler drops pc as soon as its ctx is done, not at its next due time
+		go func() {
+			<-pc.ctx.Done()
+			c.removePoolConsumer(pc)
+		}()
+	}
+	if !s.running {
+		s.running = true
+		go c.samplePool()
+		return
+	}
+	s.wakeUp()
+}
+
+// wakeUp makes the sampler look at its consumers again, it is called with the lock held.
+func (s *poolSampler) wakeUp() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *DbMgt) removePoolConsumer(pc *poolConsumer) {
+	s := &c.sampler
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, consumer := range s.consumers {
+		if consumer == pc {
+			s.consumers = append(s.consumers[:i], s.consumers[i+1:]...)
+			s.wakeUp()
+			return
+		}
+	}
+}
+
+func (c *DbMgt) samplePool() {
+	s := &c.sampler
+	for {
+		s.lock.Lock()
+		var next time.Time
+		live := s.consumers[:0]
+		for _, pc := range s.consumers {
+			if pc.ctx != nil && pc.ctx.Err() != nil {
+				continue
+			}
+			live = append(live, pc)
+			if next.IsZero() || pc.due.Before(next) {
+				next = pc.due
+			}
+		}
+		s.consumers = live
+		if len(live) <= 0 {
+			s.running = false
+			s.lock.Unlock()
+			return
+		}
+		wake := s.wake
+		s.lock.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-wake:
+			// a consumer was added, maybe due earlier, or removed
+			timer.Stop()
+			continue
+		}
+		stats, err := c.PoolStats()
+		now := time.Now()
+		var due []*poolConsumer
+		s.lock.Lock()
+		for _, pc := range s.consumers {
+			if !pc.due.After(now) {
+				due = append(due, pc)
+				pc.due = now.Add(pc.interval)
+			}
+		}
+		s.lock.Unlock()
+		if err != nil {
+			continue
+		}
+		for _, pc := range due {
+			if pc.ctx == nil || pc.ctx.Err() == nil {
+				pc.fn(stats)
+			}
+		}
+	}
+}
+
+// StartPoolStatsLogger logs the pool statistics, with the growth of the counters since the previous line,
+// every interval until ctx is done. Nothing is logged while the statistics do not change.
+func (c *DbMgt) StartPoolStatsLogger(ctx context.Context, interval time.Duration) {
+	var prev sql.DBStats
+	c.addPoolConsumer(&poolConsumer{ctx: ctx, interval: interval, fn: func(stats sql.DBStats) {
+		if stats == prev {
+			return
+		}
+		c.events().Info(ctx, "dbwrap: pool max_open=%d open=%d in_use=%d idle=%d wait_count=%d(+%d) wait_duration=%s(+%s) "+
+			"max_idle_closed=%d(+%d) max_idle_time_closed=%d(+%d) max_lifetime_closed=%d(+%d)",
+			stats.MaxOpenConnections, stats.OpenConnections, stats.InUse, stats.Idle,
+			stats.WaitCount, stats.WaitCount-prev.WaitCount, stats.WaitDuration, stats.WaitDuration-prev.WaitDuration,
+			stats.MaxIdleClosed, stats.MaxIdleClosed-prev.MaxIdleClosed,
+			stats.MaxIdleTimeClosed, stats.MaxIdleTimeClosed-prev.MaxIdleTimeClosed,
+			stats.MaxLifetimeClosed, stats.MaxLifetimeClosed-prev.MaxLifetimeClosed)
+		prev = stats
+	}})
+}
+
+// pressureHysteresis is how far below the threshold the usage must fall before the hook can fire again.
+const pressureHysteresis = 0.1
+
+// poolPressure fires once when the pool usage reaches the threshold, and again only after it went back
+// under the threshold minus the hysteresis.
+type poolPressure struct {
+	threshold float64
+	alerted   bool
+}
+
+func (p *poolPressure) observe(stats sql.DBStats) bool {
+	if stats.MaxOpenConnections <= 0 {
+		// an unlimited pool is never exhausted
+		return false
+	}
+	usage := float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	if p.alerted {
+		if usage < p.threshold-pressureHysteresis {
+			p.alerted = false
+		}
+		return false
+	}
+	if usage >= p.threshold {
+		p.alerted = true
+		return true
+	}
+	return false
+}
+
+// SetPoolPressureHook calls fn when the share of the connections in use, sampled every interval, reaches
+// threshold, e.g. 0.9. It fires again only once the usage went 10 points under threshold. A nil fn removes it.
+// It only works with a limit on the open connections.
+func (c *DbMgt) SetPoolPressureHook(fn func(stats sql.DBStats), threshold float64, interval time.Duration) *DbMgt {
+	c.lock.Lock()
+	old := c.pressure
+	c.pressure = nil
+	if fn != nil && interval > 0 {
+		p := &poolPressure{threshold: threshold}
+		c.pressure = &poolConsumer{interval: interval, fn: func(stats sql.DBStats) {
+			if p.observe(stats) {
+				fn(stats)
+			}
+		}}
+	}
+	pressure := c.pressure
+	c.lock.Unlock()
+	if old != nil {
+		c.removePoolConsumer(old)
+	}
+	if pressure != nil {
+		c.addPoolConsumer(pressure)
+	}
+	return c
+}
+
+func PoolStats() (sql.DBStats, error) {
+	return DefaultDbMgt().PoolStats()
+}
+
+func StartPoolStatsLogger(ctx context.Context, interval time.Duration) {
+	DefaultDbMgt().StartPoolStatsLogger(ctx, interval)
+}
+
+func SetPoolPressureHook(fn func(stats sql.DBStats), threshold float64, interval time.Duration) *DbMgt {
+	return DefaultDbMgt().SetPoolPressureHook(fn, threshold, interval)
+}
@@ -0,0 +1,135 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolPressure(t *testing.T) {
+	p := &poolPressure{threshold: 0.8}
+	// each step is the connections in use out of 20
+	steps := []struct {
+		inUse int
+		want  bool
+	}{
+		{10, false},
+		{16, true},
+		// fired once while the usage stays high
+		{20, false},
+		{16, false},
+		// under the threshold but within the hysteresis
+		{15, false},
+		{17, false},
+		// under the threshold minus the hysteresis, it can fire again
+		{13, false},
+		{15, false},
+		{18, true},
+		{20, false},
+	}
+	for i, step := range steps {
+		if got := p.observe(sql.DBStats{MaxOpenConnections: 20, InUse: step.inUse}); got != step.want {
+			t.Errorf("step %d: observe(%d/20) = %v, want %v", i, step.inUse, got, step.want)
+		}
+	}
+	if p.observe(sql.DBStats{InUse: 100}) {
+		t.Error("observe fired on an unlimited pool")
+	}
+}
+
+func TestSetPoolPressureHook(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db")).SetConnPool(2, 2, 0, 0)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var fired int32
+	c.SetPoolPressureHook(func(stats sql.DBStats) {
+		if stats.InUse == 2 {
+			atomic.AddInt32(&fired, 1)
+		}
+	}, 1, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.StartPoolStatsLogger(ctx, time.Hour)
+	c.sampler.lock.Lock()
+	consumers, running := len(c.sampler.consumers), c.sampler.running
+	c.sampler.lock.Unlock()
+	if consumers != 2 || !running {
+		t.Errorf("%d consumers, running %v, want the hook and the logger on one sampler", consumers, running)
+	}
+	conns := make([]*sql.Conn, 2)
+	for i := range conns {
+		var err error
+		if conns[i], err = c.CommonDB().Conn(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "the hook", func() bool {
+		return atomic.LoadInt32(&fired) > 0
+	})
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&fired); n != 1 {
+		t.Errorf("the hook fired %d times while the pool stayed exhausted, want 1", n)
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	c.SetPoolPressureHook(nil, 0, 0)
+	cancel()
+	waitFor(t, "the sampler to stop", func() bool {
+		c.sampler.lock.Lock()
+		defer c.sampler.lock.Unlock()
+		return !c.sampler.running
+	})
+}
+
+func TestPoolStatsLoggerStops(t *testing.T) {
+	c := openSqlite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.StartPoolStatsLogger(ctx, time.Hour)
+	// let the sampler wait for the first sample, an hour from now
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	waitFor(t, "the sampler to stop", func() bool {
+		c.sampler.lock.Lock()
+		defer c.sampler.lock.Unlock()
+		return !c.sampler.running && len(c.sampler.consumers) == 0
+	})
+}
+
+func TestPoolStats(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db")).
+		EnableLazyOpen(ConstantRetryPolicy(time.Millisecond, 1))
+	if _, err := c.PoolStats(); err != ErrNotOpened {
+		t.Errorf("PoolStats() = %v before the lazy open, want ErrNotOpened", err)
+	}
+	if c.IsOpen() {
+		t.Fatal("PoolStats opened the database")
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDrainBlocking(true)
+	if err := c.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Resume()
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.PoolStats()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("PoolStats() = %v while drained", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("PoolStats blocked while drained")
+	}
+}
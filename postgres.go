@@ -0,0 +1,120 @@
+package dbwrap
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var pgTargetSessionAttrs = []string{"any", "read-write", "read-only", "primary", "standby", "prefer-standby"}
+
+// SetPgHosts lists several postgres servers, tried in order until one accepts the connection. ports holds
+// either one port per host, a single port shared by every host, or nothing for the default port.
+func (c *DbMgt) SetPgHosts(hosts []string, ports []string) error {
+	if len(hosts) <= 0 {
+		return errors.New("dbwrap: no postgres hosts given")
+	}
+	if len(ports) > 1 && len(ports) != len(hosts) {
+		return fmt.Errorf("dbwrap: %d postgres ports given for %d hosts", len(ports), len(hosts))
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverPostgres {
+		return errors.New("dbwrap: postgres hosts require the postgres driver")
+	}
+	c.config.Host, c.config.Port = strings.Join(hosts, ","), strings.Join(ports, ",")
+	c.config.resolvePort()
+	return c.config.checkPort()
+}
+
+// SetPgTargetSessionAttrs selects which of the servers given to SetPgHosts is acceptable, e.g. read-write to
+// always land on the primary after a failover.
+func (c *DbMgt) SetPgTargetSessionAttrs(attrs string) error {
+	valid := false
+	for _, a := range pgTargetSessionAttrs {
+		valid = valid || a == attrs
+	}
+	if !valid {
+		return fmt.Errorf("dbwrap: invalid postgres target_session_attrs %q, must be one of %v", attrs, pgTargetSessionAttrs)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverPostgres {
+		return errors.New("dbwrap: target_session_attrs requires the postgres driver")
+	}
+	c.config.setOption("target_session_attrs", attrs)
+	return nil
+}
+
+var pgSchemaPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]{0,62}$`)
+
+// SetPgSchema puts the tables of the instance in a postgres schema: it is first in the search_path of the
+// connections and prefixes the table names, so migrations create the tables inside it. With SetEnsureSchema,
+// Open creates it when missing. It must be called after the connection parameters are set and before Open.
+func (c *DbMgt) SetPgSchema(name string) error {
+	if !pgSchemaPattern.MatchString(name) || strings.HasPrefix(strings.ToLower(name), "pg_") {
+		return fmt.Errorf("dbwrap: invalid postgres schema name %q", name)
+	}
+	c.lock.Lock()
+	isPg := c.config.Driver == driverPostgres && len(c.config.DSN) <= 0
+	c.lock.Unlock()
+	if !isPg {
+		return errors.New("dbwrap: a postgres schema requires the postgres driver and connection parameters")
+	}
+	return c.updateNamingStrategy(func(ns *schema.NamingStrategy) {
+		ns.TablePrefix = name + "." + strings.TrimPrefix(ns.TablePrefix, c.pgSchemaPrefix())
+		c.pgSchema = name
+		c.config.setOption("search_path", pgQuoteIdent(name))
+	})
+}
+
+// SetEnsureSchema makes Open run CREATE SCHEMA IF NOT EXISTS for the schema given to SetPgSchema.
+func (c *DbMgt) SetEnsureSchema(ensure bool) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ensureSchema = ensure
+	return c
+}
+
+// pgSchemaPrefix must be called with c locked.
+func (c *DbMgt) pgSchemaPrefix() string {
+	if len(c.pgSchema) <= 0 {
+		return ""
+	}
+	return c.pgSchema + "."
+}
+
+// ensurePgSchema must be called with c locked.
+func (c *DbMgt) ensurePgSchema(db *gorm.DB) error {
+	if !c.ensureSchema || len(c.pgSchema) <= 0 {
+		return nil
+	}
+	if err := db.Exec("CREATE SCHEMA IF NOT EXISTS " + pgQuoteIdent(c.pgSchema)).Error; err != nil {
+		return fmt.Errorf("dbwrap: create schema %s: %w", c.pgSchema, err)
+	}
+	return nil
+}
+
+func pgQuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func SetPgSchema(name string) error {
+	return DefaultDbMgt().SetPgSchema(name)
+}
+
+func SetEnsureSchema(ensure bool) *DbMgt {
+	return DefaultDbMgt().SetEnsureSchema(ensure)
+}
+
+func SetPgHosts(hosts []string, ports []string) error {
+	return DefaultDbMgt().SetPgHosts(hosts, ports)
+}
+
+func SetPgTargetSessionAttrs(attrs string) error {
+	return DefaultDbMgt().SetPgTargetSessionAttrs(attrs)
+}
@@ -0,0 +1,245 @@
+package dbwrap
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jackc/pgproto3/v2"
+)
+
+// fakePgServer is a postgres server accepting any user and answering the queries of a connection check:
+// "show transaction_read_only" with its readOnly flag, and everything else with an empty result, over the
+// simple and the extended query protocol. Once hang is set, it reads the queries but never answers. Once
+// askPassword is set, it asks for a cleartext password and keeps it.
+type fakePgServer struct {
+	ln          net.Listener
+	readOnly    bool
+	conns       int32
+	hang        int32
+	askPassword int32
+	lock        sync.Mutex
+	users       []string
+	passwords   []string
+}
+
+func newFakePgServer(t *testing.T, readOnly bool) *fakePgServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakePgServer{ln: ln, readOnly: readOnly}
+	t.Cleanup(func() {
+		ln.Close()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&s.conns, 1)
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakePgServer) host() string {
+	host, _, _ := net.SplitHostPort(s.ln.Addr().String())
+	return host
+}
+
+func (s *fakePgServer) port() string {
+	_, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return port
+}
+
+func (s *fakePgServer) serve(conn net.Conn) {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(pgproto3.NewChunkReader(conn), conn)
+	startup, err := backend.ReceiveStartupMessage()
+	if err != nil {
+		return
+	}
+	if msg, ok := startup.(*pgproto3.StartupMessage); ok {
+		s.lock.Lock()
+		s.users = append(s.users, msg.Parameters["user"])
+		s.lock.Unlock()
+	}
+	if atomic.LoadInt32(&s.askPassword) != 0 {
+		if backend.Send(&pgproto3.AuthenticationCleartextPassword{}) != nil {
+			return
+		}
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		if password, ok := msg.(*pgproto3.PasswordMessage); ok {
+			s.lock.Lock()
+			s.passwords = append(s.passwords, password.Password)
+			s.lock.Unlock()
+		}
+	}
+	for _, msg := range []pgproto3.BackendMessage{
+		&pgproto3.AuthenticationOk{},
+		&pgproto3.ParameterStatus{Name: "server_version", Value: "13.0"},
+		&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1},
+		&pgproto3.ReadyForQuery{TxStatus: 'I'},
+	} {
+		if err = backend.Send(msg); err != nil {
+			return
+		}
+	}
+	// query is the statement of the simple query, or the one parsed by the extended protocol
+	var query string
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		if atomic.LoadInt32(&s.hang) != 0 {
+			continue
+		}
+		var reply []pgproto3.BackendMessage
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			query = msg.String
+			reply = append(s.describe(query), s.execute(query)...)
+			reply = append(reply, &pgproto3.ReadyForQuery{TxStatus: 'I'})
+		case *pgproto3.Parse:
+			query = msg.Query
+			reply = []pgproto3.BackendMessage{&pgproto3.ParseComplete{}}
+		case *pgproto3.Bind:
+			reply = []pgproto3.BackendMessage{&pgproto3.BindComplete{}}
+		case *pgproto3.Describe:
+			if reply = s.describe(query); len(reply) <= 0 {
+				reply = []pgproto3.BackendMessage{&pgproto3.NoData{}}
+			}
+		case *pgproto3.Execute:
+			reply = s.execute(query)
+		case *pgproto3.Sync:
+			reply = []pgproto3.BackendMessage{&pgproto3.ReadyForQuery{TxStatus: 'I'}}
+		case *pgproto3.Terminate:
+			return
+		}
+		for _, msg := range reply {
+			if err = backend.Send(msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *fakePgServer) describe(query string) []pgproto3.BackendMessage {
+	if !strings.Contains(query, "transaction_read_only") {
+		return nil
+	}
+	return []pgproto3.BackendMessage{&pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{
+		{Name: []byte("transaction_read_only"), DataTypeOID: 25, DataTypeSize: -1, TypeModifier: -1}}}}
+}
+
+func (s *fakePgServer) execute(query string) []pgproto3.BackendMessage {
+	if !strings.Contains(query, "transaction_read_only") {
+		return []pgproto3.BackendMessage{&pgproto3.EmptyQueryResponse{}}
+	}
+	value := "off"
+	if s.readOnly {
+		value = "on"
+	}
+	return []pgproto3.BackendMessage{&pgproto3.DataRow{Values: [][]byte{[]byte(value)}},
+		&pgproto3.CommandComplete{CommandTag: []byte("SHOW")}}
+}
+
+// connectedUsers returns the user names of the connections made so far.
+func (s *fakePgServer) connectedUsers() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.users...)
+}
+
+// connectedPasswords returns the passwords asked for so far.
+func (s *fakePgServer) connectedPasswords() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.passwords...)
+}
+
+// refusedPort returns a local port nothing listens on.
+func refusedPort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	return port
+}
+
+func TestPgHostsFailover(t *testing.T) {
+	server := newFakePgServer(t, false)
+	c := New(false, nil).SetPgParam("127.0.0.1", "", "user", "", "app", false)
+	err := c.SetPgHosts([]string{"127.0.0.1", server.host()}, []string{refusedPort(t), server.port()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(); err != nil {
+		t.Fatalf("Open did not fail over to the second host: %v", err)
+	}
+	defer c.Close()
+	if atomic.LoadInt32(&server.conns) <= 0 {
+		t.Error("the second host got no connection")
+	}
+}
+
+func TestPgTargetSessionAttrs(t *testing.T) {
+	standby, primary := newFakePgServer(t, true), newFakePgServer(t, false)
+	c := New(false, nil).SetPgParam("127.0.0.1", "", "user", "", "app", false)
+	err := c.SetPgHosts([]string{standby.host(), primary.host()}, []string{standby.port(), primary.port()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.SetPgTargetSessionAttrs("read-write"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(c.UnsafeDSN(), " target_session_attrs=read-write") {
+		t.Errorf("UnsafeDSN() = %q", c.UnsafeDSN())
+	}
+	if err = c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	standbyConns, primaryConns := atomic.LoadInt32(&standby.conns), atomic.LoadInt32(&primary.conns)
+	if standbyConns <= 0 || primaryConns <= 0 {
+		t.Errorf("standby got %d connections and primary %d, want both tried", standbyConns, primaryConns)
+	}
+}
+
+func TestPgHostsConfig(t *testing.T) {
+	c := New(false, nil).SetPgParam("db1", "", "user", "", "app", false)
+	if err := c.SetPgHosts([]string{"db1", "db2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.UnsafeDSN(); !strings.HasPrefix(got, "host=db1,db2 port=5432 ") {
+		t.Errorf("UnsafeDSN() = %q, want both hosts on the default port", got)
+	}
+	if err := c.SetPgHosts([]string{"db1", "db2"}, []string{"5432", "5433"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.UnsafeDSN(); !strings.HasPrefix(got, "host=db1,db2 port=5432,5433 ") {
+		t.Errorf("UnsafeDSN() = %q, want a port per host", got)
+	}
+	if err := c.SetPgHosts([]string{"db1", "db2", "db3"}, []string{"5432", "5433"}); err == nil {
+		t.Error("SetPgHosts accepted 2 ports for 3 hosts")
+	}
+	if err := c.SetPgHosts(nil, nil); err == nil {
+		t.Error("SetPgHosts accepted no hosts")
+	}
+	if err := c.SetPgTargetSessionAttrs("writable"); err == nil {
+		t.Error("SetPgTargetSessionAttrs accepted an invalid value")
+	}
+}
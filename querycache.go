@@ -0,0 +1,375 @@
+package dbwrap
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// CacheBackend stores the results of EnableQueryCache. A ttl of 0 means no expiry.
+type CacheBackend interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+type queryCacheConfig struct {
+	backend CacheBackend
+	ttl     time.Duration
+	tables  map[string]bool
+}
+
+// cachedResult is what the cache holds for a query.
+type cachedResult struct {
+	RowsAffected int64
+	Dest         []byte
+}
+
+// EnableQueryCache caches, for ttl, the results of the Find, First, Take, Last, Count and Pluck queries on the
+// given tables outside of transactions. Creates, updates and deletes through gorm invalidate the cached
+// results of their table, again when their transaction ends, raw statements and the writes of other processes
+// do not: call InvalidateQueryCache for them or rely on ttl. Queries with joins or locking clauses are not
+// cached.
+// The results are gob encoded, so only the exported fields of the destination survive the cache.
+func (c *DbMgt) EnableQueryCache(cache CacheBackend, ttl time.Duration, tables ...string) *DbMgt {
+	cfg := queryCacheConfig{backend: cache, ttl: ttl, tables: make(map[string]bool, len(tables))}
+	for _, table := range tables {
+		cfg.tables[table] = true
+	}
+	c.cacheConfig.Store(cfg)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.queryCache && c.db != nil {
+		if err := c.installQueryCache(c.db); err != nil {
+			c.log.Error(nil, "dbwrap: install the query cache callbacks: %v", err)
+		}
+	}
+	c.queryCache = true
+	return c
+}
+
+// SetQueryCacheNamespace sets the prefix of the cache keys of c. By default it is a hash of the driver and the
+// redacted connection string, so the instances sharing a CacheBackend only share the results of the same
+// database. Set it when the connection string does not tell the databases apart, e.g. with SetDialector.
+func (c *DbMgt) SetQueryCacheNamespace(namespace string) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cacheNamespace = namespace
+	return c
+}
+
+func (c *DbMgt) queryCacheNamespace() string {
+	c.lock.Lock()
+	namespace := c.cacheNamespace
+	c.lock.Unlock()
+	if len(namespace) > 0 {
+		return namespace
+	}
+	sum := sha256.Sum256([]byte(c.target()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// InvalidateQueryCache drops the cached results of the given tables.
+func (c *DbMgt) InvalidateQueryCache(tables ...string) {
+	cfg, ok := c.cacheConfig.Load().(queryCacheConfig)
+	if !ok || cfg.backend == nil {
+		return
+	}
+	namespace := c.queryCacheNamespace()
+	for _, table := range tables {
+		if cfg.tables[table] {
+			cfg.backend.Delete(cacheGenerationKey(namespace, table))
+		}
+	}
+}
+
+// cacheConnPool is the connection pool of a database with the query cache, whose transactions invalidate the
+// tables they wrote once they end.
+type cacheConnPool struct {
+	gorm.ConnPool
+	c *DbMgt
+}
+
+func (p *cacheConnPool) BeginTx(ctx context.Context, opt *sql.TxOptions) (gorm.ConnPool, error) {
+	var tx gorm.ConnPool
+	switch beginner := p.ConnPool.(type) {
+	case gorm.TxBeginner:
+		sqlTx, err := beginner.BeginTx(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		tx = sqlTx
+	case gorm.ConnPoolBeginner:
+		pool, err := beginner.BeginTx(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		tx = pool
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+	return &cacheTx{ConnPool: tx, c: p.c, tables: make(map[string]bool)}, nil
+}
+
+func (p *cacheConnPool) GetDBConn() (*sql.DB, error) {
+	if connector, ok := p.ConnPool.(gorm.GetDBConnector); ok && connector != nil {
+		return connector.GetDBConn()
+	}
+	if sqlDB, ok := p.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// cacheTx is a transaction of a cacheConnPool.
+type cacheTx struct {
+	gorm.ConnPool
+	c      *DbMgt
+	lock   sync.Mutex
+	tables map[string]bool
+}
+
+func (tx *cacheTx) written(table string) {
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	tx.tables[table] = true
+}
+
+func (tx *cacheTx) Commit() error {
+	defer tx.invalidate()
+	return tx.ConnPool.(gorm.TxCommitter).Commit()
+}
+
+func (tx *cacheTx) Rollback() error {
+	defer tx.invalidate()
+	return tx.ConnPool.(gorm.TxCommitter).Rollback()
+}
+
+// invalidate drops what the readers cached while the transaction wrote.
+func (tx *cacheTx) invalidate() {
+	tx.lock.Lock()
+	tables := make([]string, 0, len(tx.tables))
+	for table := range tx.tables {
+		tables = append(tables, table)
+	}
+	tx.tables = make(map[string]bool)
+	tx.lock.Unlock()
+	tx.c.InvalidateQueryCache(tables...)
+}
+
+func (c *DbMgt) installQueryCache(db *gorm.DB) error {
+	cb := db.Callback()
+	query := cb.Query().Get("gorm:query")
+	if query == nil {
+		return fmt.Errorf("dbwrap: the %s dialector has no gorm:query callback", db.Dialector.Name())
+	}
+	if err := cb.Query().Replace("gorm:query", func(db *gorm.DB) {
+		c.cachedQuery(db, query)
+	}); err != nil {
+		return err
+	}
+	invalidate := func(db *gorm.DB) {
+		if db.Error == nil && !db.DryRun {
+			if tx, ok := db.Statement.ConnPool.(*cacheTx); ok {
+				// a reader outside the transaction may cache the old rows again until it commits
+				tx.written(db.Statement.Table)
+			}
+			c.InvalidateQueryCache(db.Statement.Table)
+		}
+	}
+	if _, ok := db.ConnPool.(*cacheConnPool); !ok {
+		db.ConnPool = &cacheConnPool{ConnPool: db.ConnPool, c: c}
+		db.Statement.ConnPool = db.ConnPool
+	}
+	if err := cb.Create().After("gorm:create").Register("dbwrap:cache_invalidate_create", invalidate); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("dbwrap:cache_invalidate_update", invalidate); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("dbwrap:cache_invalidate_delete", invalidate)
+}
+
+func (c *DbMgt) cachedQuery(db *gorm.DB, query func(*gorm.DB)) {
+	cfg, ok := c.cacheConfig.Load().(queryCacheConfig)
+	if !ok || cfg.backend == nil || !cacheable(db, cfg) {
+		query(db)
+		return
+	}
+	// build the statement now to know the key, the query callback does not build it again
+	callbacks.BuildQuerySQL(db)
+	if db.Error != nil {
+		return
+	}
+	key := queryCacheKey(c.queryCacheNamespace(), db, cfg.backend)
+	if data, ok := cfg.backend.Get(key); ok {
+		if restoreResult(db, data) {
+			return
+		}
+	}
+	query(db)
+	if db.Error != nil {
+		return
+	}
+	if data, err := encodeResult(db); err == nil {
+		cfg.backend.Set(key, data, cfg.ttl)
+	}
+}
+
+func cacheable(db *gorm.DB, cfg queryCacheConfig) bool {
+	stmt := db.Statement
+	if db.Error != nil || db.DryRun || stmt.SQL.Len() > 0 || !cfg.tables[stmt.Table] || len(stmt.Joins) > 0 {
+		return false
+	}
+	if _, locking := stmt.Clauses["FOR"]; locking {
+		return false
+	}
+	if _, inTx := stmt.ConnPool.(gorm.TxCommitter); inTx {
+		return false
+	}
+	return stmt.Dest != nil && reflect.TypeOf(stmt.Dest).Kind() == reflect.Ptr
+}
+
+func cacheGenerationKey(namespace, table string) string {
+	return "dbwrap:" + namespace + ":generation:" + table
+}
+
+// queryCacheKey includes the generation of the table, which invalidating replaces.
+func queryCacheKey(namespace string, db *gorm.DB, backend CacheBackend) string {
+	table := db.Statement.Table
+	generation, ok := backend.Get(cacheGenerationKey(namespace, table))
+	if !ok {
+		generation = []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+		backend.Set(cacheGenerationKey(namespace, table), generation, 0)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%#v\x00%T", db.Statement.SQL.String(), db.Statement.Vars, db.Statement.Dest)
+	return "dbwrap:" + namespace + ":query:" + table + ":" + string(generation) + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+func encodeResult(db *gorm.DB) ([]byte, error) {
+	var dest bytes.Buffer
+	if err := gob.NewEncoder(&dest).Encode(db.Statement.Dest); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(cachedResult{RowsAffected: db.RowsAffected, Dest: dest.Bytes()})
+	return buf.Bytes(), err
+}
+
+// restoreResult decodes a cached result into the destination, reporting whether it could.
+func restoreResult(db *gorm.DB, data []byte) bool {
+	var result cachedResult
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&result); err != nil {
+		return false
+	}
+	dest := reflect.ValueOf(db.Statement.Dest).Elem()
+	// gob leaves the fields that are zero in the cached value untouched
+	decoded := reflect.New(dest.Type())
+	if err := gob.NewDecoder(bytes.NewReader(result.Dest)).DecodeValue(decoded); err != nil {
+		return false
+	}
+	dest.Set(decoded.Elem())
+	db.RowsAffected = result.RowsAffected
+	if db.RowsAffected == 0 && db.Statement.RaiseErrorOnNotFound {
+		db.AddError(gorm.ErrRecordNotFound)
+	}
+	return true
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// LRUCache is an in-memory CacheBackend holding at most capacity entries.
+type LRUCache struct {
+	lock     sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRUCache{capacity: capacity, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (l *LRUCache) Get(key string) ([]byte, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	elem, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		l.order.Remove(elem)
+		delete(l.entries, key)
+		return nil, false
+	}
+	l.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (l *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	entry := &lruEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	if elem, ok := l.entries[key]; ok {
+		elem.Value = entry
+		l.order.MoveToFront(elem)
+		return
+	}
+	l.entries[key] = l.order.PushFront(entry)
+	for l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (l *LRUCache) Delete(key string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if elem, ok := l.entries[key]; ok {
+		l.order.Remove(elem)
+		delete(l.entries, key)
+	}
+}
+
+func (l *LRUCache) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.order.Len()
+}
+
+func EnableQueryCache(cache CacheBackend, ttl time.Duration, tables ...string) *DbMgt {
+	return DefaultDbMgt().EnableQueryCache(cache, ttl, tables...)
+}
+
+func InvalidateQueryCache(tables ...string) {
+	DefaultDbMgt().InvalidateQueryCache(tables...)
+}
+
+func SetQueryCacheNamespace(namespace string) *DbMgt {
+	return DefaultDbMgt().SetQueryCacheNamespace(namespace)
+}
@@ -0,0 +1,237 @@
+package dbwrap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// openCached opens a sqlite database with the users a and b, caching the queries on test_users.
+func openCached(t *testing.T, ttl time.Duration) *DbMgt {
+	t.Helper()
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}, &testOrder{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Create(&[]testUser{{Name: "a"}, {Name: "b"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	c.EnableQueryCache(NewLRUCache(100), ttl, "test_users")
+	return c
+}
+
+// renameBehindCache renames the user id with a raw statement, which does not invalidate the cache.
+func renameBehindCache(t *testing.T, c *DbMgt, id uint, name string) {
+	t.Helper()
+	if err := c.Db().Exec("UPDATE test_users SET name = ? WHERE id = ?", name, id).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryCacheStruct(t *testing.T) {
+	c := openCached(t, 0)
+	var user testUser
+	if err := c.Db().First(&user, 1).Error; err != nil || user.Name != "a" {
+		t.Fatalf("First() = %+v, %v", user, err)
+	}
+	renameBehindCache(t, c, 1, "renamed")
+	var cached testUser
+	if err := c.Db().First(&cached, 1).Error; err != nil || cached != user {
+		t.Errorf("First() = %+v, %v, want the cached %+v", cached, err, user)
+	}
+	// a pointer destination, and a destination with another type, are other queries
+	var ptr *testUser
+	if err := c.Db().Model(&testUser{}).First(&ptr, 1).Error; err != nil || ptr == nil || ptr.Name != "renamed" {
+		t.Errorf("First(&ptr) = %+v, %v, want the renamed user", ptr, err)
+	}
+	c.InvalidateQueryCache("test_users")
+	if err := c.Db().First(&cached, 1).Error; err != nil || cached.Name != "renamed" {
+		t.Errorf("First() = %+v, %v after InvalidateQueryCache", cached, err)
+	}
+	// not found is cached too, with its error
+	for i := 0; i < 2; i++ {
+		if err := c.Db().First(&testUser{}, 99).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("First() = %v, want ErrRecordNotFound", err)
+		}
+	}
+}
+
+func TestQueryCacheSlice(t *testing.T) {
+	c := openCached(t, 0)
+	var users []testUser
+	if err := c.Db().Order("id").Find(&users).Error; err != nil || len(users) != 2 {
+		t.Fatalf("Find() = %+v, %v", users, err)
+	}
+	renameBehindCache(t, c, 2, "renamed")
+	var cached []testUser
+	tx := c.Db().Order("id").Find(&cached)
+	if tx.Error != nil || len(cached) != 2 || cached[1].Name != "b" || tx.RowsAffected != 2 {
+		t.Errorf("Find() = %+v, %d rows, %v, want the cached users", cached, tx.RowsAffected, tx.Error)
+	}
+	// a shorter destination is overwritten, not merged
+	cached = []testUser{{ID: 7}, {ID: 8}, {ID: 9}}
+	if err := c.Db().Order("id").Find(&cached).Error; err != nil || len(cached) != 2 || cached[0].ID != 1 {
+		t.Errorf("Find() = %+v, %v, want the 2 cached users only", cached, err)
+	}
+	var names []string
+	if err := c.Db().Model(&testUser{}).Order("id").Pluck("name", &names).Error; err != nil ||
+		len(names) != 2 || names[1] != "renamed" {
+		t.Errorf("Pluck() = %v, %v", names, err)
+	}
+	if err := c.Db().Create(&testUser{Name: "c"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Order("id").Find(&cached).Error; err != nil || len(cached) != 3 || cached[1].Name != "renamed" {
+		t.Errorf("Find() = %+v, %v after Create, want the fresh users", cached, err)
+	}
+}
+
+func TestQueryCacheCount(t *testing.T) {
+	c := openCached(t, 0)
+	count := func() int64 {
+		var n int64
+		if err := c.Db().Model(&testUser{}).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(); n != 2 {
+		t.Fatalf("count = %d, want 2", n)
+	}
+	if err := c.Db().Exec("INSERT INTO test_users (name) VALUES ('raw')").Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("count = %d, want the cached 2", n)
+	}
+	if err := c.Db().Where("name = ?", "raw").Delete(&testUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("count = %d after Delete, want 2", n)
+	}
+	if err := c.Db().Model(&testUser{}).Where("id = ?", 1).Update("name", "x").Error; err != nil {
+		t.Fatal(err)
+	}
+	var user testUser
+	if err := c.Db().First(&user, 1).Error; err != nil || user.Name != "x" {
+		t.Errorf("First() = %+v, %v after Update", user, err)
+	}
+}
+
+func TestQueryCacheTransaction(t *testing.T) {
+	c := openCached(t, 0)
+	count := func(db *gorm.DB) int64 {
+		var n int64
+		if err := db.Model(&testUser{}).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	err := c.Db().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&testUser{Name: "c"}).Error; err != nil {
+			return err
+		}
+		if n := count(tx); n != 3 {
+			t.Errorf("count in the transaction = %d, want its own write", n)
+		}
+		// caches the rows before the commit
+		if n := count(c.Db()); n != 2 {
+			t.Errorf("count outside the transaction = %d, want 2", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := count(c.Db()); n != 3 {
+		t.Errorf("count after the commit = %d, want 3", n)
+	}
+}
+
+func TestQueryCacheScope(t *testing.T) {
+	c := openCached(t, 50*time.Millisecond)
+	if err := c.Db().Create(&testOrder{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var orders []testOrder
+	c.Db().Find(&orders)
+	if err := c.Db().Exec("DELETE FROM test_orders").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Find(&orders).Error; err != nil || len(orders) != 0 {
+		t.Errorf("Find() = %+v, %v, want the table that is not cached read again", orders, err)
+	}
+
+	var user testUser
+	c.Db().First(&user, 1)
+	renameBehindCache(t, c, 1, "renamed")
+	time.Sleep(80 * time.Millisecond)
+	if err := c.Db().First(&user, 1).Error; err != nil || user.Name != "renamed" {
+		t.Errorf("First() = %+v, %v, want the cached user expired", user, err)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	l := NewLRUCache(2)
+	l.Set("a", []byte("1"), 0)
+	l.Set("b", []byte("2"), 0)
+	l.Get("a")
+	l.Set("c", []byte("3"), 0)
+	if _, ok := l.Get("b"); ok {
+		t.Error("the least recently used entry was not evicted")
+	}
+	if v, ok := l.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("Get(a) = %q, %v", v, ok)
+	}
+	if l.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", l.Len())
+	}
+	l.Set("a", []byte("4"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := l.Get("a"); ok {
+		t.Error("an expired entry was returned")
+	}
+	l.Delete("c")
+	if l.Len() != 0 {
+		t.Errorf("Len() = %d after the expiry and Delete, want 0", l.Len())
+	}
+}
+
+func TestQueryCacheNamespace(t *testing.T) {
+	cache := NewLRUCache(100)
+	open := func(name string) *DbMgt {
+		c := openSqlite(t)
+		if err := c.Migrate(&testUser{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Db().Create(&testUser{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+		return c.EnableQueryCache(cache, 0, "test_users")
+	}
+	first := func(c *DbMgt) string {
+		var user testUser
+		if err := c.Db().First(&user, 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		return user.Name
+	}
+	a, b := open("a"), open("b")
+	if got := []string{first(a), first(b), first(a)}; !reflect.DeepEqual(got, []string{"a", "b", "a"}) {
+		t.Errorf("the instances read %v, want their own users a, b, a", got)
+	}
+	// the same namespace shares the results, as for the same database
+	a.SetQueryCacheNamespace("shared")
+	b.SetQueryCacheNamespace("shared")
+	if got := []string{first(a), first(b)}; !reflect.DeepEqual(got, []string{"a", "a"}) {
+		t.Errorf("the instances read %v, want the cached a twice", got)
+	}
+	b.InvalidateQueryCache("test_users")
+	if got := first(b); got != "b" {
+		t.Errorf("b read %s after the invalidation, want b", got)
+	}
+}
@@ -0,0 +1,216 @@
+package dbwrap
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MetricsSink receives the duration of every query once EnableQueryMetrics was called. op is one of
+// "create", "query", "update", "delete", "row" and "raw", table is empty when gorm does not know it.
+// OnQuery is called from the goroutine running the query, so it must be fast and safe for concurrent use.
+type MetricsSink interface {
+	OnQuery(op, table string, d time.Duration, err error)
+}
+
+type noopSink struct{}
+
+func (noopSink) OnQuery(string, string, time.Duration, error) {}
+
+// sinkHolder lets the sink be swapped with an atomic.Value, which cannot store a nil interface.
+type sinkHolder struct {
+	sink MetricsSink
+}
+
+const metricsStartKey = "dbwrap:metrics_start"
+
+// EnableQueryMetrics reports the duration of every operation to sink, a nil sink discards them. The gorm
+// callbacks are installed on the open connection pool and on every pool established by Open or Reopen
+// afterwards; enable it before the database is in use, as gorm does not guard its callbacks against
+// concurrent queries. Calling it again only replaces the sink.
+func (c *DbMgt) EnableQueryMetrics(sink MetricsSink) *DbMgt {
+	if sink == nil {
+		sink = noopSink{}
+	}
+	c.metricsSink.Store(sinkHolder{sink: sink})
+	c.enableQueryCallbacks()
+	return c
+}
+
+// enableQueryCallbacks installs the timing callbacks shared by the query metrics and the slow query handler.
+func (c *DbMgt) enableQueryCallbacks() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.queryCallbacks && c.db != nil {
+		if err := c.installQueryCallbacks(c.db); err != nil {
+			c.log.Error(nil, "dbwrap: install the query callbacks: %v", err)
+		}
+	}
+	c.queryCallbacks = true
+}
+
+type callbackRegisterer interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+func (c *DbMgt) installQueryCallbacks(db *gorm.DB) error {
+	cb := db.Callback()
+	processors := []struct {
+		op            string
+		before, after callbackRegisterer
+	}{
+		{"create", cb.Create().Before("gorm:create"), cb.Create().After("gorm:create")},
+		{"query", cb.Query().Before("gorm:query"), cb.Query().After("gorm:query")},
+		{"update", cb.Update().Before("gorm:update"), cb.Update().After("gorm:update")},
+		{"delete", cb.Delete().Before("gorm:delete"), cb.Delete().After("gorm:delete")},
+		{"row", cb.Row().Before("gorm:row"), cb.Row().After("gorm:row")},
+		{"raw", cb.Raw().Before("gorm:raw"), cb.Raw().After("gorm:raw")},
+	}
+	for _, p := range processors {
+		op := p.op
+		if err := p.before.Register("dbwrap:metrics_start_"+op, startQueryTimer); err != nil {
+			return err
+		}
+		if err := p.after.Register("dbwrap:metrics_"+op, func(db *gorm.DB) {
+			c.afterQuery(op, db)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startQueryTimer(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func (c *DbMgt) afterQuery(op string, db *gorm.DB) {
+	v, ok := db.InstanceGet(metricsStartKey)
+	if !ok {
+		return
+	}
+	start, ok := v.(time.Time)
+	if !ok {
+		return
+	}
+	d := time.Since(start)
+	c.reportQuery(op, db, d)
+	c.reportSlowQuery(db, d)
+}
+
+func (c *DbMgt) reportQuery(op string, db *gorm.DB, d time.Duration) {
+	holder, _ := c.metricsSink.Load().(sinkHolder)
+	if holder.sink == nil {
+		return
+	}
+	// a misbehaving sink must not fail the query
+	defer func() {
+		if r := recover(); r != nil {
+			c.log.Error(nil, "dbwrap: metrics sink panicked: %v", r)
+		}
+	}()
+	holder.sink.OnQuery(op, db.Statement.Table, d, db.Error)
+}
+
+// QueryKey identifies the queries aggregated by MemoryMetricsSink.
+type QueryKey struct {
+	Op    string
+	Table string
+}
+
+// LatencySnapshot summarizes the durations recorded for a QueryKey. The percentiles are computed over the most
+// recent samples only.
+type LatencySnapshot struct {
+	Count  int64
+	Errors int64
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+}
+
+const defaultMetricsSamples = 1024
+
+type latencySamples struct {
+	count, errors int64
+	max           time.Duration
+	samples       []time.Duration
+	next          int
+}
+
+// MemoryMetricsSink keeps the durations in memory, for tests and small applications without a metrics system.
+type MemoryMetricsSink struct {
+	lock    sync.Mutex
+	size    int
+	queries map[QueryKey]*latencySamples
+}
+
+// NewMemoryMetricsSink keeps the last samples durations of each QueryKey, 1024 when samples is not positive.
+func NewMemoryMetricsSink(samples int) *MemoryMetricsSink {
+	if samples <= 0 {
+		samples = defaultMetricsSamples
+	}
+	return &MemoryMetricsSink{size: samples, queries: make(map[QueryKey]*latencySamples)}
+}
+
+func (s *MemoryMetricsSink) OnQuery(op, table string, d time.Duration, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := QueryKey{Op: op, Table: table}
+	q := s.queries[key]
+	if q == nil {
+		q = &latencySamples{}
+		s.queries[key] = q
+	}
+	q.count++
+	if err != nil {
+		q.errors++
+	}
+	if d > q.max {
+		q.max = d
+	}
+	if len(q.samples) < s.size {
+		q.samples = append(q.samples, d)
+	} else {
+		q.samples[q.next] = d
+		q.next = (q.next + 1) % s.size
+	}
+}
+
+func (s *MemoryMetricsSink) Snapshot() map[QueryKey]LatencySnapshot {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	snapshot := make(map[QueryKey]LatencySnapshot, len(s.queries))
+	for key, q := range s.queries {
+		sorted := append([]time.Duration(nil), q.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		snapshot[key] = LatencySnapshot{
+			Count:  q.count,
+			Errors: q.errors,
+			P50:    percentile(sorted, 0.5),
+			P90:    percentile(sorted, 0.9),
+			P99:    percentile(sorted, 0.99),
+			Max:    q.max,
+		}
+	}
+	return snapshot
+}
+
+func (s *MemoryMetricsSink) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queries = make(map[QueryKey]*latencySamples)
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) <= 0 {
+		return 0
+	}
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+func EnableQueryMetrics(sink MetricsSink) *DbMgt {
+	return DefaultDbMgt().EnableQueryMetrics(sink)
+}
@@ -0,0 +1,100 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryMetricsSinkPercentiles(t *testing.T) {
+	s := NewMemoryMetricsSink(0)
+	for i := 100; i >= 1; i-- {
+		var err error
+		if i%10 == 0 {
+			err = errors.New("failed")
+		}
+		s.OnQuery("query", "users", time.Duration(i)*time.Millisecond, err)
+	}
+	s.OnQuery("create", "users", time.Millisecond, nil)
+	got := s.Snapshot()
+	want := LatencySnapshot{Count: 100, Errors: 10, P50: 50 * time.Millisecond, P90: 90 * time.Millisecond,
+		P99: 99 * time.Millisecond, Max: 100 * time.Millisecond}
+	if got[QueryKey{"query", "users"}] != want {
+		t.Errorf("Snapshot() = %+v, want %+v", got[QueryKey{"query", "users"}], want)
+	}
+	if len(got) != 2 || got[QueryKey{"create", "users"}].Count != 1 {
+		t.Errorf("Snapshot() = %+v, want a key per op and table", got)
+	}
+	if s.Reset(); len(s.Snapshot()) != 0 {
+		t.Error("Reset kept samples")
+	}
+}
+
+func TestMemoryMetricsSinkRecentSamples(t *testing.T) {
+	s := NewMemoryMetricsSink(10)
+	for i := 1; i <= 25; i++ {
+		s.OnQuery("query", "", time.Duration(i)*time.Millisecond, nil)
+	}
+	// the percentiles are over the last 10 samples, 16ms to 25ms, the count and max over all of them
+	want := LatencySnapshot{Count: 25, P50: 20 * time.Millisecond, P90: 24 * time.Millisecond,
+		P99: 24 * time.Millisecond, Max: 25 * time.Millisecond}
+	if got := s.Snapshot()[QueryKey{Op: "query"}]; got != want {
+		t.Errorf("Snapshot() = %+v, want %+v", got, want)
+	}
+}
+
+type panickingSink struct{}
+
+func (panickingSink) OnQuery(string, string, time.Duration, error) {
+	panic("sink failure")
+}
+
+func TestEnableQueryMetrics(t *testing.T) {
+	c := openSqlite(t)
+	sink := NewMemoryMetricsSink(0)
+	c.EnableQueryMetrics(sink)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	sink.Reset()
+	db := c.Db()
+	if err := db.Create(&testUser{Name: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	db.Find(&[]testUser{})
+	db.Model(&testUser{}).Where("id = ?", 1).Update("name", "b")
+	db.Delete(&testUser{}, 1)
+	db.Exec("DELETE FROM test_users")
+	db.Raw("SELECT count(*) FROM test_users").Row()
+	db.Exec("SELECT * FROM missing")
+	got := sink.Snapshot()
+	for _, key := range []QueryKey{{"create", "test_users"}, {"query", "test_users"}, {"update", "test_users"},
+		{"delete", "test_users"}, {"raw", ""}, {"row", ""}} {
+		if got[key].Count <= 0 {
+			t.Errorf("no sample for %+v in %+v", key, got)
+		}
+	}
+	if got[QueryKey{"raw", ""}].Errors != 1 {
+		t.Errorf("raw errors = %d, want 1", got[QueryKey{"raw", ""}].Errors)
+	}
+
+	// the callbacks are installed again on the pool of Reopen
+	if err := c.Reopen(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sink.Reset()
+	c.Db().Find(&[]testUser{})
+	if sink.Snapshot()[QueryKey{"query", "test_users"}].Count != 1 {
+		t.Error("no sample after Reopen")
+	}
+
+	c.EnableQueryMetrics(panickingSink{})
+	if err := c.Db().Find(&[]testUser{}).Error; err != nil {
+		t.Errorf("Find() = %v with a panicking sink", err)
+	}
+	c.EnableQueryMetrics(nil)
+	if err := c.Db().Find(&[]testUser{}).Error; err != nil {
+		t.Errorf("Find() = %v with the nil sink", err)
+	}
+}
@@ -0,0 +1,11 @@
+module github.com/sqos/dbwrap/v2/rdsiam
+
+go 1.15
+
+require (
+	github.com/aws/aws-sdk-go-v2 v1.11.2
+	github.com/aws/aws-sdk-go-v2/feature/rds/auth v1.1.7
+	github.com/sqos/dbwrap/v2 v2.0.0
+)
+
+replace github.com/sqos/dbwrap/v2 => ../
@@ -0,0 +1,59 @@
+// Package rdsiam authenticates dbwrap connections to Amazon RDS with IAM database authentication. It is a
+// separate module so that the AWS SDK is only pulled in by applications that use it.
+package rdsiam
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/sqos/dbwrap/v2"
+)
+
+// CredentialProvider mints an IAM authentication token, valid for 15 minutes, for every new connection.
+type CredentialProvider struct {
+	Endpoint string
+	Region   string
+	DbUser   string
+	Creds    aws.CredentialsProvider
+}
+
+func (p *CredentialProvider) Credentials(ctx context.Context) (string, string, error) {
+	token, err := auth.BuildAuthToken(ctx, p.Endpoint, p.Region, p.DbUser, p.Creds)
+	if err != nil {
+		return "", "", err
+	}
+	return p.DbUser, token, nil
+}
+
+// SetRDSIAMAuth makes mgt, already configured with SetPgParam or SetMysqlParam, authenticate with IAM tokens.
+// RDS only accepts tokens over TLS, so it also turns TLS on.
+func SetRDSIAMAuth(mgt *dbwrap.DbMgt, region, dbUser string, creds aws.CredentialsProvider) error {
+	cfg := mgt.Config()
+	if len(cfg.Host) <= 0 {
+		return errors.New("rdsiam: host must be configured before enabling IAM authentication")
+	}
+	switch {
+	case mgt.IsPostgres():
+		if len(cfg.SSLMode) <= 0 {
+			if err := mgt.SetPgSSLMode("require"); err != nil {
+				return err
+			}
+		}
+	case mgt.IsMysql():
+		if err := mgt.SetMysqlExtraParams(map[string]string{"tls": "true", "allowCleartextPasswords": "true"}); err != nil {
+			return err
+		}
+	default:
+		return errors.New("rdsiam: IAM authentication requires the postgres or mysql driver")
+	}
+	mgt.SetCredentialProvider(&CredentialProvider{
+		Endpoint: net.JoinHostPort(cfg.Host, cfg.Port),
+		Region:   region,
+		DbUser:   dbUser,
+		Creds:    creds,
+	})
+	return nil
+}
@@ -0,0 +1,77 @@
+package dbwrap
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+const redacted = "****"
+
+var (
+	pgPasswordPattern   = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+	adoPasswordPattern  = regexp.MustCompile(`(?i)((?:password|pwd)\s*=\s*)[^;]*`)
+	queryPasswordFields = []string{"password", "pwd"}
+)
+
+func redactDSN(driver, dsn string) string {
+	if len(dsn) <= 0 {
+		return dsn
+	}
+	switch driver {
+	case driverMysql:
+		if strings.HasPrefix(dsn, "mysql://") {
+			return redactURL(dsn, true)
+		}
+		if cfg, err := mysqldriver.ParseDSN(dsn); err == nil {
+			if len(cfg.User) > 0 || len(cfg.Passwd) > 0 {
+				cfg.User, cfg.Passwd = redacted, redacted
+			}
+			return cfg.FormatDSN()
+		}
+		if at := strings.LastIndex(dsn, "@"); at >= 0 {
+			return redacted + dsn[at:]
+		}
+		return dsn
+	case driverSqlite:
+		return dsn
+	default:
+		if strings.Contains(dsn, "://") {
+			return redactURL(dsn, false)
+		}
+		if driver == driverSqlServer {
+			return adoPasswordPattern.ReplaceAllString(dsn, "${1}"+redacted)
+		}
+		return pgPasswordPattern.ReplaceAllString(dsn, "${1}"+redacted)
+	}
+}
+
+func redactURL(raw string, userinfo bool) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		if userinfo {
+			u.User = url.UserPassword(redacted, redacted)
+		} else if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+	}
+	query := u.Query()
+	changed := false
+	for k := range query {
+		for _, field := range queryPasswordFields {
+			if strings.EqualFold(k, field) {
+				query.Set(k, redacted)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		u.RawQuery = query.Encode()
+	}
+	return strings.ReplaceAll(u.String(), url.QueryEscape(redacted), redacted)
+}
@@ -0,0 +1,192 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// RenameColumn renames the column oldName of the table of model to newName, model being a model or a table
+// name and the names field or column names. It fails when oldName does not exist, when newName already does,
+// and when both do since which one holds the data is then ambiguous. The statements run are logged.
+func (c *DbMgt) RenameColumn(model interface{}, oldName, newName string) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	return c.RenameColumnTx(db, model, oldName, newName)
+}
+
+// RenameColumnTx is RenameColumn run on tx, e.g. the one of a Migration Up or Down func.
+func (c *DbMgt) RenameColumnTx(tx *gorm.DB, model interface{}, oldName, newName string) error {
+	table, err := tableOf(tx, model)
+	if err != nil {
+		return err
+	}
+	if oldName, err = columnName(tx, model, oldName); err != nil {
+		return err
+	}
+	if newName, err = columnName(tx, model, newName); err != nil {
+		return err
+	}
+	columns, err := listColumns(tx, model)
+	if err != nil {
+		return err
+	}
+	var hasOld, hasNew bool
+	for _, col := range columns {
+		hasOld = hasOld || col.Name == oldName
+		hasNew = hasNew || col.Name == newName
+	}
+	switch {
+	case hasOld && hasNew:
+		return fmt.Errorf("dbwrap: rename column %s of %s: both %s and %s exist", oldName, table, oldName, newName)
+	case hasNew:
+		return fmt.Errorf("dbwrap: rename column %s of %s: %s already exists", oldName, table, newName)
+	case !hasOld:
+		return fmt.Errorf("dbwrap: rename column %s of %s: no such column", oldName, table)
+	}
+	if tx.Dialector.Name() == driverSqlite {
+		// RENAME COLUMN came with 3.25.0, before it the table has to be rebuilt
+		var version string
+		if err = tx.Raw("SELECT sqlite_version()").Row().Scan(&version); err != nil {
+			return err
+		}
+		if !versionAtLeast(version, 3, 25) {
+			return fmt.Errorf("dbwrap: rename column %s of %s: sqlite %s cannot rename columns", oldName, table, version)
+		}
+	}
+	echo := c.echoSQL(tx)
+	if _, ok := model.(string); !ok {
+		err = echo.Migrator().RenameColumn(model, oldName, newName)
+	} else if tx.Dialector.Name() == driverSqlServer {
+		err = echo.Exec("EXEC sp_rename ?, ?, 'COLUMN'", table+"."+oldName, newName).Error
+	} else {
+		err = echo.Exec("ALTER TABLE ? RENAME COLUMN ? TO ?", clause.Table{Name: table}, clause.Column{Name: oldName},
+			clause.Column{Name: newName}).Error
+	}
+	if err != nil {
+		return fmt.Errorf("dbwrap: rename column %s of %s: %w", oldName, table, err)
+	}
+	return nil
+}
+
+// RenameTable renames the table of oldModel to the one of newModel, each being a model or a table name. It
+// fails when the table of oldModel does not exist, when the one of newModel already does, and when both do.
+// The statements run are logged.
+func (c *DbMgt) RenameTable(oldModel, newModel interface{}) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	return c.RenameTableTx(db, oldModel, newModel)
+}
+
+// RenameTableTx is RenameTable run on tx, e.g. the one of a Migration Up or Down func.
+func (c *DbMgt) RenameTableTx(tx *gorm.DB, oldModel, newModel interface{}) error {
+	oldTable, err := tableOf(tx, oldModel)
+	if err != nil {
+		return err
+	}
+	newTable, err := tableOf(tx, newModel)
+	if err != nil {
+		return err
+	}
+	if oldTable == newTable {
+		return fmt.Errorf("dbwrap: rename table %s: same name", oldTable)
+	}
+	hasOld, hasNew := tx.Migrator().HasTable(oldTable), tx.Migrator().HasTable(newTable)
+	switch {
+	case hasOld && hasNew:
+		return fmt.Errorf("dbwrap: rename table %s: both %s and %s exist", oldTable, oldTable, newTable)
+	case hasNew:
+		return fmt.Errorf("dbwrap: rename table %s: %s already exists", oldTable, newTable)
+	case !hasOld:
+		return fmt.Errorf("dbwrap: rename table %s: no such table", oldTable)
+	}
+	target := newModel
+	if tx.Dialector.Name() == driverPostgres {
+		// postgres keeps the table in its schema and rejects a qualified new name
+		oldSchema, _ := splitTable(oldTable)
+		newSchema, name := splitTable(newTable)
+		if oldSchema != newSchema {
+			return fmt.Errorf("dbwrap: rename table %s: cannot move it to the schema of %s", oldTable, newTable)
+		}
+		target = name
+	}
+	if err = c.echoSQL(tx).Migrator().RenameTable(oldModel, target); err != nil {
+		return fmt.Errorf("dbwrap: rename table %s: %w", oldTable, err)
+	}
+	return nil
+}
+
+// columnName returns the column of the field name of model, or name itself when model has no such field.
+func columnName(db *gorm.DB, model interface{}, name string) (string, error) {
+	if _, ok := model.(string); ok {
+		return name, nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	if field := stmt.Schema.LookUpField(name); field != nil && len(field.DBName) > 0 {
+		return field.DBName, nil
+	}
+	return name, nil
+}
+
+// versionAtLeast reports whether the dotted version is at least major.minor.
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	got := make([]int, 2)
+	for i := 0; i < len(got) && i < len(parts); i++ {
+		got[i], _ = strconv.Atoi(parts[i])
+	}
+	return got[0] > major || got[0] == major && got[1] >= minor
+}
+
+// echoSQL returns a session of tx logging every statement it runs to the logger of c.
+func (c *DbMgt) echoSQL(tx *gorm.DB) *gorm.DB {
+	if c.log == nil {
+		return tx
+	}
+	return tx.Session(&gorm.Session{Logger: &sqlEcho{Interface: tx.Logger, log: c.log}})
+}
+
+// sqlEcho is a logger writing the SQL of every statement to log before passing it to the wrapped logger.
+type sqlEcho struct {
+	logger.Interface
+	log logger.Interface
+}
+
+func (e *sqlEcho) LogMode(level logger.LogLevel) logger.Interface {
+	return &sqlEcho{Interface: e.Interface.LogMode(level), log: e.log}
+}
+
+func (e *sqlEcho) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, rows := fc()
+	e.log.Info(ctx, "dbwrap: %s", sql)
+	e.Interface.Trace(ctx, begin, func() (string, int64) { return sql, rows }, err)
+}
+
+func RenameColumn(model interface{}, oldName, newName string) error {
+	return DefaultDbMgt().RenameColumn(model, oldName, newName)
+}
+
+func RenameColumnTx(tx *gorm.DB, model interface{}, oldName, newName string) error {
+	return DefaultDbMgt().RenameColumnTx(tx, model, oldName, newName)
+}
+
+func RenameTable(oldModel, newModel interface{}) error {
+	return DefaultDbMgt().RenameTable(oldModel, newModel)
+}
+
+func RenameTableTx(tx *gorm.DB, oldModel, newModel interface{}) error {
+	return DefaultDbMgt().RenameTableTx(tx, oldModel, newModel)
+}
@@ -0,0 +1,173 @@
+package dbwrap
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openSqliteLogged is openSqlite logging to the returned logger.
+func openSqliteLogged(t *testing.T) (*DbMgt, *recordLogger) {
+	t.Helper()
+	l := &recordLogger{}
+	c := NewWithOptions(WithLogger(l)).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+	})
+	return c, l
+}
+
+// loggedSQL returns the statements echoed to l which start with prefix.
+func loggedSQL(l *recordLogger, prefix string) []string {
+	var logged []string
+	for _, line := range l.Lines() {
+		if strings.HasPrefix(line, "dbwrap: "+prefix) {
+			logged = append(logged, strings.TrimPrefix(line, "dbwrap: "))
+		}
+	}
+	return logged
+}
+
+func columnNames(t *testing.T, c *DbMgt, model interface{}) []string {
+	t.Helper()
+	columns, err := c.ListColumns(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(columns))
+	for _, col := range columns {
+		names = append(names, col.Name)
+	}
+	return names
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"3.25.0", true},
+		{"3.25", true},
+		{"3.46.1", true},
+		{"4.0.0", true},
+		{"3.24.9", false},
+		{"3", false},
+		{"2.99.0", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := versionAtLeast(tt.version, 3, 25); got != tt.want {
+			t.Errorf("versionAtLeast(%q, 3, 25) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestRenameColumnErrors(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		model            interface{}
+		oldName, newName string
+		want             string
+	}{
+		{&testUser{}, "Missing", "Other", "dbwrap: rename column Missing of test_users: no such column"},
+		{&testUser{}, "Missing", "Name", "dbwrap: rename column Missing of test_users: name already exists"},
+		{&testUser{}, "Name", "ID", "dbwrap: rename column name of test_users: both name and id exist"},
+		{"test_users", "missing", "name", "dbwrap: rename column missing of test_users: name already exists"},
+	}
+	for _, tt := range tests {
+		if err := c.RenameColumn(tt.model, tt.oldName, tt.newName); err == nil || err.Error() != tt.want {
+			t.Errorf("RenameColumn(%v, %s, %s) = %v, want %s", tt.model, tt.oldName, tt.newName, err, tt.want)
+		}
+	}
+	if got, want := columnNames(t, c, &testUser{}), []string{"id", "name"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns %v after the failed renames, want %v", got, want)
+	}
+}
+
+func TestRenameColumn(t *testing.T) {
+	c, l := openSqliteLogged(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Create(&testUser{Name: "alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// the field name of a model is its column
+	if err := c.RenameColumn(&testUser{}, "Name", "nick"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := columnNames(t, c, &testUser{}), []string{"id", "nick"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns %v, want %v", got, want)
+	}
+	var nick string
+	if err := c.Db().Raw("SELECT nick FROM test_users").Row().Scan(&nick); err != nil || nick != "alice" {
+		t.Errorf("nick = %q, %v, want the data kept", nick, err)
+	}
+	// a table name renames with the SQL of dbwrap
+	if err := c.RenameColumn("test_users", "nick", "name"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := columnNames(t, c, &testUser{}), []string{"id", "name"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("columns %v, want %v", got, want)
+	}
+	want := []string{"ALTER TABLE `test_users` RENAME COLUMN `name` TO `nick`",
+		"ALTER TABLE `test_users` RENAME COLUMN `nick` TO `name`"}
+	if got := loggedSQL(l, "ALTER TABLE"); !reflect.DeepEqual(got, want) {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestRenameTableErrors(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}, &testAccount{}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		oldModel, newModel interface{}
+		want               string
+	}{
+		{&testUser{}, "test_users", "dbwrap: rename table test_users: same name"},
+		{"missing", "others", "dbwrap: rename table missing: no such table"},
+		{"missing", &testAccount{}, "dbwrap: rename table missing: test_accounts already exists"},
+		{&testUser{}, &testAccount{}, "dbwrap: rename table test_users: both test_users and test_accounts exist"},
+	}
+	for _, tt := range tests {
+		if err := c.RenameTable(tt.oldModel, tt.newModel); err == nil || err.Error() != tt.want {
+			t.Errorf("RenameTable(%v, %v) = %v, want %s", tt.oldModel, tt.newModel, err, tt.want)
+		}
+	}
+}
+
+func TestRenameTable(t *testing.T) {
+	c, l := openSqliteLogged(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Create(&testUser{Name: "alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RenameTable(&testUser{}, "test_people"); err != nil {
+		t.Fatal(err)
+	}
+	for model, want := range map[interface{}]bool{&testUser{}: false, "test_people": true} {
+		if has, err := c.HasTable(model); err != nil || has != want {
+			t.Errorf("HasTable(%v) = %v, %v, want %v", model, has, err, want)
+		}
+	}
+	if err := c.RenameTable("test_people", &testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := countUsers(t, c); n != 1 {
+		t.Errorf("%d users, want the data kept", n)
+	}
+	if got := loggedSQL(l, "ALTER TABLE"); len(got) != 2 {
+		t.Errorf("logged %q, want the two renames", got)
+	}
+}
@@ -0,0 +1,394 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+// SetReplicas sends the reads to the given read replicas, which use the driver and the settings of the
+// primary but connect to their own DSN. Open registers gorm's dbresolver plugin: queries go to a healthy
+// replica chosen by the policy of SetReplicaPolicy, writes and transactions to the primary.
+func (c *DbMgt) SetReplicas(dsns ...string) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.replicas = append([]string(nil), dsns...)
+	return c
+}
+
+// ReplicaPolicy chooses the replica of a read among the indexes, in the SetReplicas order, of the healthy ones.
+// When every replica is unhealthy, all of them are offered.
+type ReplicaPolicy interface {
+	Pick(healthy []int) int
+}
+
+// ReplicaStatsPolicy is a ReplicaPolicy choosing from the pool statistics of the replicas, stats being indexed
+// like the replicas.
+type ReplicaStatsPolicy interface {
+	ReplicaPolicy
+	PickWithStats(healthy []int, stats []sql.DBStats) int
+}
+
+// SetReplicaPolicy chooses the replica of each read, randomly by default.
+func (c *DbMgt) SetReplicaPolicy(policy ReplicaPolicy) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.replicaPolicy = policy
+	return c
+}
+
+const (
+	defaultReplicaProbeInterval = 5 * time.Second
+	defaultReplicaFailures      = 3
+)
+
+// SetReplicaProbe pings every replica each interval, 5 seconds by default, taking a replica out of the reads
+// after failureThreshold consecutive failures, 3 by default, and back at its first successful ping.
+// A negative interval turns the probing off.
+func (c *DbMgt) SetReplicaProbe(interval time.Duration, failureThreshold int) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.replicaProbe, c.replicaFailures = interval, failureThreshold
+	return c
+}
+
+type randomPolicy struct{}
+
+func (randomPolicy) Pick(healthy []int) int {
+	return healthy[rand.Intn(len(healthy))]
+}
+
+// RandomPolicy picks any healthy replica.
+func RandomPolicy() ReplicaPolicy {
+	return randomPolicy{}
+}
+
+type roundRobinPolicy struct {
+	next uint32
+}
+
+func (p *roundRobinPolicy) Pick(healthy []int) int {
+	return healthy[int((atomic.AddUint32(&p.next, 1)-1)%uint32(len(healthy)))]
+}
+
+// RoundRobinPolicy uses the healthy replicas in turn.
+func RoundRobinPolicy() ReplicaPolicy {
+	return &roundRobinPolicy{}
+}
+
+type leastConnectionsPolicy struct{}
+
+func (leastConnectionsPolicy) Pick(healthy []int) int {
+	return healthy[0]
+}
+
+func (leastConnectionsPolicy) PickWithStats(healthy []int, stats []sql.DBStats) int {
+	best := healthy[0]
+	for _, i := range healthy[1:] {
+		if stats[i].InUse < stats[best].InUse {
+			best = i
+		}
+	}
+	return best
+}
+
+// LeastConnectionsPolicy picks the healthy replica with the fewest connections in use.
+func LeastConnectionsPolicy() ReplicaPolicy {
+	return leastConnectionsPolicy{}
+}
+
+// ReplicaHealth is the health of a replica as seen by the prober of SetReplicaProbe.
+type ReplicaHealth struct {
+	// DSN is redacted.
+	DSN                 string
+	Healthy             bool
+	ConsecutiveFailures int
+	LastCheck           time.Time
+	LastError           error
+	InUse               int
+	OpenConnections     int
+}
+
+// ReplicaStatus returns the status of each replica, in the SetReplicas order, or nil when there are none or
+// the database is not open.
+func (c *DbMgt) ReplicaStatus() []ReplicaHealth {
+	set := c.replicaSet()
+	if set == nil {
+		return nil
+	}
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	statuses := make([]ReplicaHealth, len(set.replicas))
+	for i, r := range set.replicas {
+		statuses[i] = r.status
+		if r.pool != nil {
+			stats := r.pool.Stats()
+			statuses[i].InUse, statuses[i].OpenConnections = stats.InUse, stats.OpenConnections
+		}
+	}
+	return statuses
+}
+
+// UseWrite returns a session sending its queries to the primary, to read what was just written.
+func (c *DbMgt) UseWrite(ctx context.Context) *gorm.DB {
+	return c.Db().WithContext(ctx).Clauses(dbresolver.Write)
+}
+
+// UseRead returns a session sending its queries, including raw statements, to a replica.
+func (c *DbMgt) UseRead(ctx context.Context) *gorm.DB {
+	return c.Db().WithContext(ctx).Clauses(dbresolver.Read)
+}
+
+type replica struct {
+	pool   *sql.DB
+	status ReplicaHealth
+}
+
+// replicaSet is the dbresolver plugin of a connection pool, keeping the replica pools so they are closed with it.
+type replicaSet struct {
+	*dbresolver.DBResolver
+	policy   ReplicaPolicy
+	log      logger.Interface
+	lock     sync.Mutex
+	replicas []*replica
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// replicaDialector records the pool of a replica when dbresolver opens it.
+type replicaDialector struct {
+	gorm.Dialector
+	c       *DbMgt
+	replica *replica
+	set     *replicaSet
+}
+
+func (d replicaDialector) Initialize(db *gorm.DB) error {
+	if err := d.Dialector.Initialize(db); err != nil {
+		return err
+	}
+	if sqlDB, ok := db.ConnPool.(*sql.DB); ok {
+		d.c.applyConnPool(sqlDB)
+		d.set.lock.Lock()
+		d.replica.pool = sqlDB
+		d.set.lock.Unlock()
+	}
+	return nil
+}
+
+// useReplicas registers the replicas on db, it must be called with c locked.
+func (c *DbMgt) useReplicas(db *gorm.DB) error {
+	if len(c.replicas) <= 0 {
+		return nil
+	}
+	if c.dialector != nil {
+		return errors.New("dbwrap: replicas need connection parameters, not a dialector")
+	}
+	set := &replicaSet{policy: c.replicaPolicy, log: c.log, stop: make(chan struct{})}
+	if set.policy == nil {
+		set.policy = RandomPolicy()
+	}
+	var dialectors []gorm.Dialector
+	for _, dsn := range c.replicas {
+		cfg := c.config.clone()
+		cfg.DSN = dsn
+		dialector, err := cfg.dialector()
+		if err != nil {
+			return err
+		}
+		r := &replica{status: ReplicaHealth{DSN: redactDSN(cfg.Driver, dsn), Healthy: true}}
+		set.replicas = append(set.replicas, r)
+		dialectors = append(dialectors, replicaDialector{Dialector: dialector, c: c, replica: r, set: set})
+	}
+	set.DBResolver = dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: set})
+	if err := db.Use(set); err != nil {
+		set.close()
+		return fmt.Errorf("dbwrap: register the replicas: %w", err)
+	}
+	interval, failures := c.replicaProbe, c.replicaFailures
+	if interval == 0 {
+		interval = defaultReplicaProbeInterval
+	}
+	if failures <= 0 {
+		failures = defaultReplicaFailures
+	}
+	if interval > 0 {
+		go set.probe(interval, failures)
+	}
+	return nil
+}
+
+// Resolve implements dbresolver.Policy over the healthy replicas.
+func (s *replicaSet) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	s.lock.Lock()
+	var healthy []int
+	for i, r := range s.replicas {
+		if r.status.Healthy {
+			healthy = append(healthy, i)
+		}
+	}
+	if len(healthy) <= 0 {
+		for i := range s.replicas {
+			healthy = append(healthy, i)
+		}
+	}
+	var stats []sql.DBStats
+	policy, withStats := s.policy.(ReplicaStatsPolicy)
+	if withStats {
+		stats = make([]sql.DBStats, len(s.replicas))
+		for i, r := range s.replicas {
+			if r.pool != nil {
+				stats[i] = r.pool.Stats()
+			}
+		}
+	}
+	s.lock.Unlock()
+	var picked int
+	if withStats {
+		picked = policy.PickWithStats(healthy, stats)
+	} else {
+		picked = s.policy.Pick(healthy)
+	}
+	if picked < 0 || picked >= len(pools) {
+		picked = healthy[0]
+	}
+	return pools[picked]
+}
+
+func (s *replicaSet) probe(interval time.Duration, failureThreshold int) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	timeout := interval / 2
+	if timeout > maxPingTimeout {
+		timeout = maxPingTimeout
+	}
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-tick.C:
+		}
+		s.lock.Lock()
+		replicas := append([]*replica(nil), s.replicas...)
+		s.lock.Unlock()
+		for _, r := range replicas {
+			if r.pool == nil {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := r.pool.PingContext(ctx)
+			cancel()
+			s.record(r, err, failureThreshold)
+		}
+	}
+}
+
+func (s *replicaSet) record(r *replica, err error, failureThreshold int) {
+	s.lock.Lock()
+	wasHealthy := r.status.Healthy
+	r.status.LastCheck, r.status.LastError = time.Now(), err
+	if err == nil {
+		r.status.Healthy, r.status.ConsecutiveFailures = true, 0
+	} else {
+		r.status.ConsecutiveFailures++
+		if r.status.ConsecutiveFailures >= failureThreshold {
+			r.status.Healthy = false
+		}
+	}
+	healthy, dsn := r.status.Healthy, r.status.DSN
+	s.lock.Unlock()
+	if s.log == nil || healthy == wasHealthy {
+		return
+	}
+	if healthy {
+		s.log.Warn(context.Background(), "dbwrap: replica %s is back", dsn)
+	} else {
+		s.log.Error(context.Background(), "dbwrap: replica %s is down: %v", dsn, err)
+	}
+}
+
+func (s *replicaSet) pools() []*sql.DB {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var pools []*sql.DB
+	for _, r := range s.replicas {
+		if r.pool != nil {
+			pools = append(pools, r.pool)
+		}
+	}
+	return pools
+}
+
+func (s *replicaSet) close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	var first error
+	for _, pool := range s.pools() {
+		if err := pool.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// ping succeeds when at least one replica answers.
+func (s *replicaSet) ping(ctx context.Context) error {
+	var err error
+	for _, pool := range s.pools() {
+		if err = pool.PingContext(ctx); err == nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("dbwrap: no replica is reachable: %w", err)
+	}
+	return nil
+}
+
+func replicasOf(db *gorm.DB) *replicaSet {
+	set, _ := db.Config.Plugins[(&dbresolver.DBResolver{}).Name()].(*replicaSet)
+	return set
+}
+
+func (c *DbMgt) replicaSet() *replicaSet {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.db == nil {
+		return nil
+	}
+	return replicasOf(c.db)
+}
+
+func SetReplicas(dsns ...string) *DbMgt {
+	return DefaultDbMgt().SetReplicas(dsns...)
+}
+
+func SetReplicaPolicy(policy ReplicaPolicy) *DbMgt {
+	return DefaultDbMgt().SetReplicaPolicy(policy)
+}
+
+func SetReplicaProbe(interval time.Duration, failureThreshold int) *DbMgt {
+	return DefaultDbMgt().SetReplicaProbe(interval, failureThreshold)
+}
+
+func ReplicaStatus() []ReplicaHealth {
+	return DefaultDbMgt().ReplicaStatus()
+}
+
+func UseWrite(ctx context.Context) *gorm.DB {
+	return DefaultDbMgt().UseWrite(ctx)
+}
+
+func UseRead(ctx context.Context) *gorm.DB {
+	return DefaultDbMgt().UseRead(ctx)
+}
@@ -0,0 +1,158 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sqliteFile creates the sqlite file path with a single user named name, telling which file a read went to.
+func sqliteFile(t *testing.T, path, name string) string {
+	t.Helper()
+	c := New(false, nil).SetSqlite3Param(path)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Db().Create(&testUser{Name: name}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplicas(t *testing.T) {
+	dir := t.TempDir()
+	primary := sqliteFile(t, filepath.Join(dir, "primary.db"), "primary")
+	replica1 := sqliteFile(t, filepath.Join(dir, "replica1.db"), "replica1")
+	replica2 := sqliteFile(t, filepath.Join(dir, "replica2.db"), "replica2")
+	c := New(false, nil).SetSqlite3Param(primary).SetReplicas(replica1, replica2).
+		SetReplicaPolicy(RoundRobinPolicy())
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var reads []string
+	for i := 0; i < 4; i++ {
+		var user testUser
+		if err := c.Db().First(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		reads = append(reads, user.Name)
+	}
+	if want := "[replica1 replica2 replica1 replica2]"; fmt.Sprint(reads) != want {
+		t.Errorf("reads went to %v, want %s", reads, want)
+	}
+	if err := c.Db().Create(&testUser{Name: "written"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := c.UseWrite(context.Background()).Model(&testUser{}).Count(&count).Error; err != nil || count != 2 {
+		t.Errorf("count on the primary = %d, %v, want the write", count, err)
+	}
+	var names []string
+	if err := c.UseRead(context.Background()).Raw("SELECT name FROM test_users").Scan(&names).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] == "primary" {
+		t.Errorf("raw read returned %v, want a replica", names)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() = %v", err)
+	}
+	status := c.ReplicaStatus()
+	if len(status) != 2 || status[0].DSN != replica1 || !status[0].Healthy || !status[1].Healthy {
+		t.Errorf("ReplicaStatus() = %+v, want both replicas healthy", status)
+	}
+
+	set := c.replicaSet()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, pool := range set.pools() {
+		if err := pool.Ping(); err == nil {
+			t.Errorf("replica %d is still open after Close", i)
+		}
+	}
+}
+
+func TestReplicasFailover(t *testing.T) {
+	dir := t.TempDir()
+	primary := sqliteFile(t, filepath.Join(dir, "primary.db"), "primary")
+	good := sqliteFile(t, filepath.Join(dir, "good.db"), "good")
+	// a directory is no database file, the replica fails every ping and query
+	c := New(false, nil).SetSqlite3Param(primary).SetReplicas(dir, good).SetReplicaPolicy(RoundRobinPolicy()).
+		SetReplicaProbe(10*time.Millisecond, 2)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitFor(t, "the bad replica to be down", func() bool {
+		status := c.ReplicaStatus()
+		return len(status) == 2 && !status[0].Healthy
+	})
+	status := c.ReplicaStatus()
+	if status[0].ConsecutiveFailures < 2 || status[0].LastError == nil || !status[1].Healthy {
+		t.Errorf("ReplicaStatus() = %+v, want the first replica down only", status)
+	}
+	for i := 0; i < 6; i++ {
+		var user testUser
+		if err := c.Db().First(&user).Error; err != nil || user.Name != "good" {
+			t.Errorf("read %d = %q, %v, want the good replica", i, user.Name, err)
+		}
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() = %v with a replica up", err)
+	}
+}
+
+type pickFunc func(healthy []int) int
+
+func (f pickFunc) Pick(healthy []int) int {
+	return f(healthy)
+}
+
+func TestReplicaPolicies(t *testing.T) {
+	p := RoundRobinPolicy()
+	var picks []int
+	for i := 0; i < 4; i++ {
+		picks = append(picks, p.Pick([]int{0, 2}))
+	}
+	if fmt.Sprint(picks) != "[0 2 0 2]" {
+		t.Errorf("round robin picked %v", picks)
+	}
+	least := LeastConnectionsPolicy().(ReplicaStatsPolicy)
+	stats := []sql.DBStats{{InUse: 1}, {InUse: 5}, {InUse: 2}}
+	if got := least.PickWithStats([]int{1, 2}, stats); got != 2 {
+		t.Errorf("least connections picked %d, want 2", got)
+	}
+	if got := least.PickWithStats([]int{0, 1, 2}, stats); got != 0 {
+		t.Errorf("least connections picked %d, want 0", got)
+	}
+	for i := 0; i < 10; i++ {
+		if got := RandomPolicy().Pick([]int{1, 3}); got != 1 && got != 3 {
+			t.Fatalf("random picked %d, not a healthy replica", got)
+		}
+	}
+
+	// every replica is offered when none is healthy, and a pick out of range falls back to the first one
+	set := &replicaSet{replicas: []*replica{{}, {}}}
+	set.policy = pickFunc(func(healthy []int) int {
+		if len(healthy) != 2 {
+			t.Errorf("offered %v, want every replica", healthy)
+		}
+		return 7
+	})
+	pools := []gorm.ConnPool{&sql.DB{}, &sql.DB{}}
+	if got := set.Resolve(pools); got != pools[0] {
+		t.Error("an out of range pick did not fall back to the first replica")
+	}
+}
@@ -0,0 +1,143 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RetryPolicy spaces the connection attempts of OpenWithPolicy: the delay starts at InitialInterval and is
+// multiplied by Multiplier after each failure, up to MaxInterval, then randomized by up to JitterFraction of
+// itself so that many instances do not retry in lockstep. MaxAttempts 0 retries until the context is done.
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	JitterFraction  float64
+	MaxAttempts     int
+	// Warmup is the number of connections OpenWithPolicy establishes with Warmup once opened.
+	Warmup int
+}
+
+// ConstantRetryPolicy retries every interval, as OpenUntilOk does.
+func ConstantRetryPolicy(interval time.Duration, maxAttempts int) RetryPolicy {
+	return RetryPolicy{InitialInterval: interval, Multiplier: 1, MaxAttempts: maxAttempts}
+}
+
+// NextDelay returns the wait after the given failed attempt, counted from 1.
+func (p RetryPolicy) NextDelay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := float64(p.InitialInterval)
+	if p.Multiplier > 1 {
+		delay *= math.Pow(p.Multiplier, float64(attempt-1))
+	}
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+	if p.JitterFraction > 0 {
+		delay *= 1 + p.JitterFraction*(2*rand.Float64()-1)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
+
+// RetryHook is told about every failed connection attempt, nextDelay is 0 when no retry follows.
+type RetryHook func(attempt int, err error, nextDelay time.Duration)
+
+// SetRetryHook calls fn after every failed attempt of OpenUntilOk, OpenWithRetry and OpenWithPolicy, e.g. to
+// count failures. fn runs synchronously in the retry loop, so it must return quickly.
+func (c *DbMgt) SetRetryHook(fn RetryHook) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.retryHook = fn
+	return c
+}
+
+func (c *DbMgt) notifyRetry(attempt int, err error, nextDelay time.Duration) {
+	c.lock.Lock()
+	hook := c.retryHook
+	c.lock.Unlock()
+	if hook != nil {
+		hook(attempt, err, nextDelay)
+	}
+}
+
+// OpenWithPolicy tries to open the database until it succeeds, policy.MaxAttempts attempts failed or ctx is
+// done, and then returns the last connection error.
+func (c *DbMgt) OpenWithPolicy(ctx context.Context, policy RetryPolicy) error {
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		err := c.open(ctx)
+		if err == nil {
+			return c.Warmup(ctx, policy.Warmup)
+		}
+		if ctx.Err() != nil {
+			if lastErr == nil {
+				return err
+			}
+			// the cancellation interrupted this attempt, the previous error is the meaningful one
+			return fmt.Errorf("dbwrap: gave up opening the database, last error was: %w", lastErr)
+		}
+		lastErr = err
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			c.log.Error(nil, "dbwrap: open attempt %d failed: %v", attempt, err)
+			c.notifyRetry(attempt, err, 0)
+			return fmt.Errorf("dbwrap: gave up opening the database after %d attempts: %w", attempt, err)
+		}
+		delay := policy.NextDelay(attempt)
+		c.log.Error(nil, "dbwrap: open attempt %d failed: %v, retrying in %s", attempt, err, delay)
+		c.notifyRetry(attempt, err, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("dbwrap: gave up opening the database, last error was: %w", err)
+		case <-timer.C:
+		}
+	}
+}
+
+// EnableLazyOpen makes the first Db or CommonDB call open the database, retrying as policy says.
+// When every attempt failed, the operations of the *gorm.DB returned by Db fail with the open error, DbE and
+// CommonDBE return it.
+func (c *DbMgt) EnableLazyOpen(policy RetryPolicy) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lazyOpen = &policy
+	return c
+}
+
+func (c *DbMgt) openLazily(policy RetryPolicy) (*gorm.DB, error) {
+	// a single caller opens, the concurrent ones wait for its outcome
+	c.lazyLock.Lock()
+	defer c.lazyLock.Unlock()
+	if err := c.OpenWithPolicy(context.Background(), policy); err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.db, nil
+}
+
+func EnableLazyOpen(policy RetryPolicy) *DbMgt {
+	return DefaultDbMgt().EnableLazyOpen(policy)
+}
+
+func OpenWithPolicy(ctx context.Context, policy RetryPolicy) error {
+	return DefaultDbMgt().OpenWithPolicy(ctx, policy)
+}
+
+func SetRetryHook(fn RetryHook) *DbMgt {
+	return DefaultDbMgt().SetRetryHook(fn)
+}
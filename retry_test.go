@@ -0,0 +1,279 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestOpenUntilOkContextCancel(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param("/nonexistent/dir/test.db")
+	const interval = 100 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.OpenUntilOkContext(ctx, interval)
+	}()
+	time.Sleep(2*interval + interval/2)
+	cancel()
+	cancelled := time.Now()
+	select {
+	case err := <-done:
+		if elapsed := time.Since(cancelled); elapsed > interval {
+			t.Errorf("OpenUntilOkContext returned %s after the cancellation", elapsed)
+		}
+		if err == nil || !strings.Contains(err.Error(), "gave up") || !strings.Contains(err.Error(), "sqlite directory") {
+			t.Errorf("OpenUntilOkContext() = %v, want the last connection error", err)
+		}
+	case <-time.After(interval):
+		t.Fatal("OpenUntilOkContext did not return within an interval of the cancellation")
+	}
+}
+
+func TestOpenUntilOkContextDone(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param("/nonexistent/dir/test.db")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.OpenUntilOkContext(ctx, time.Hour); err == nil {
+		t.Error("OpenUntilOkContext succeeded with a cancelled context")
+	}
+}
+
+func TestOpenUntilOk(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if !c.OpenUntilOk(time.Millisecond) {
+		t.Fatal("OpenUntilOk() = false")
+	}
+	defer c.Close()
+	if !c.IsOpen() {
+		t.Error("the database is not open")
+	}
+}
+
+func TestOpenWithRetry(t *testing.T) {
+	// nothing listens on the port, so every attempt fails right away like against an unroutable address with
+	// a short connect timeout
+	l := &recordLogger{}
+	c := NewWithOptions(WithLogger(l)).SetPgParam("127.0.0.1", refusedPort(t), "user", "", "app", false)
+	const interval = 50 * time.Millisecond
+	start := time.Now()
+	err := c.OpenWithRetry(interval, 3)
+	elapsed := time.Since(start)
+	if err == nil {
+		c.Close()
+		t.Fatal("OpenWithRetry succeeded")
+	}
+	if !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("OpenWithRetry() = %v, want the attempt count", err)
+	}
+	// two waits separate the three attempts
+	if elapsed < 2*interval || elapsed > 3*interval+interval/2 {
+		t.Errorf("OpenWithRetry returned after %s, want about %s", elapsed, 3*interval)
+	}
+	lines := l.Lines()
+	if len(lines) != 3 {
+		t.Fatalf("logged %q, want a line per attempt", lines)
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, fmt.Sprintf("open attempt %d failed", i+1)) {
+			t.Errorf("line %d = %q, want the attempt number", i, line)
+		}
+	}
+}
+
+func TestOpenWithRetryAndCreateTables(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param("/nonexistent/dir/test.db")
+	if err := c.OpenWithRetryAndCreateTables(time.Millisecond, 2, &testUser{}); err == nil {
+		t.Fatal("OpenWithRetryAndCreateTables succeeded")
+	}
+	c = New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.OpenWithRetryAndCreateTables(time.Millisecond, 2, &testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if has, err := c.HasTable(&testUser{}); !has || err != nil {
+		t.Errorf("HasTable() = %v, %v, want the table created", has, err)
+	}
+}
+
+func TestRetryPolicyNextDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"constant", ConstantRetryPolicy(time.Second, 0), 5, time.Second},
+		{"first", RetryPolicy{InitialInterval: 100 * time.Millisecond, Multiplier: 2}, 1, 100 * time.Millisecond},
+		{"doubled", RetryPolicy{InitialInterval: 100 * time.Millisecond, Multiplier: 2}, 4, 800 * time.Millisecond},
+		{"capped", RetryPolicy{InitialInterval: 100 * time.Millisecond, Multiplier: 2, MaxInterval: time.Second}, 10,
+			time.Second},
+		{"attempt 0", RetryPolicy{InitialInterval: time.Second, Multiplier: 3}, 0, time.Second},
+		{"no overflow", RetryPolicy{InitialInterval: time.Hour, Multiplier: 10}, 1000, time.Duration(math.MaxInt64)},
+		{"multiplier below 1", RetryPolicy{InitialInterval: time.Second, Multiplier: 0.5}, 3, time.Second},
+		{"zero", RetryPolicy{}, 3, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.NextDelay(tt.attempt); got != tt.want {
+			t.Errorf("%s: NextDelay(%d) = %s, want %s", tt.name, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	policy := RetryPolicy{InitialInterval: time.Second, Multiplier: 2, MaxInterval: 4 * time.Second,
+		JitterFraction: 0.25}
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		delay := policy.NextDelay(5)
+		if delay < 3*time.Second || delay > 5*time.Second {
+			t.Fatalf("NextDelay(5) = %s, want within 25%% of 4s", delay)
+		}
+		seen[delay] = true
+	}
+	if len(seen) <= 1 {
+		t.Error("the jitter does not randomize the delay")
+	}
+}
+
+func TestOpenWithPolicyLogsDelay(t *testing.T) {
+	l := &recordLogger{}
+	c := NewWithOptions(WithLogger(l)).SetSqlite3Param("/nonexistent/dir/test.db")
+	policy := RetryPolicy{InitialInterval: time.Millisecond, Multiplier: 2, MaxAttempts: 3}
+	if err := c.OpenWithPolicy(context.Background(), policy); err == nil {
+		t.Fatal("OpenWithPolicy succeeded")
+	}
+	lines := l.Lines()
+	for i, delay := range []string{"retrying in 1ms", "retrying in 2ms"} {
+		if i >= len(lines) || !strings.Contains(lines[i], delay) {
+			t.Errorf("logged %q, want line %d to tell %q", lines, i, delay)
+		}
+	}
+}
+
+// flakyDialector fails the opens until the attempts reach failures, then opens the wrapped dialector. failures
+// may be raised while it is in use, with atomic.StoreInt32.
+type flakyDialector struct {
+	gorm.Dialector
+	failures int32
+	attempts int32
+}
+
+func (d *flakyDialector) Initialize(db *gorm.DB) error {
+	if atomic.AddInt32(&d.attempts, 1) <= atomic.LoadInt32(&d.failures) {
+		return errors.New("connection refused")
+	}
+	return d.Dialector.Initialize(db)
+}
+
+func TestRetryHook(t *testing.T) {
+	dialector := &flakyDialector{Dialector: sqlite.Open(filepath.Join(t.TempDir(), "test.db")), failures: 3}
+	type call struct {
+		attempt   int
+		err       string
+		nextDelay time.Duration
+	}
+	var calls []call
+	c := New(false, nil).SetDialector(dialector).SetRetryHook(func(attempt int, err error, nextDelay time.Duration) {
+		calls = append(calls, call{attempt, err.Error(), nextDelay})
+	})
+	if err := c.OpenWithRetry(time.Millisecond, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	want := []call{
+		{1, "connection refused", time.Millisecond},
+		{2, "connection refused", time.Millisecond},
+		{3, "connection refused", time.Millisecond},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("hook calls = %+v, want %+v", calls, want)
+	}
+	if attempts := atomic.LoadInt32(&dialector.attempts); attempts != 4 {
+		t.Errorf("%d attempts, want 4", attempts)
+	}
+}
+
+func TestRetryHookLastAttempt(t *testing.T) {
+	dialector := &flakyDialector{Dialector: sqlite.Open(filepath.Join(t.TempDir(), "test.db")), failures: 5}
+	var delays []time.Duration
+	c := New(false, nil).SetDialector(dialector).SetRetryHook(func(_ int, _ error, nextDelay time.Duration) {
+		delays = append(delays, nextDelay)
+	})
+	if err := c.OpenWithRetry(time.Millisecond, 2); err == nil {
+		c.Close()
+		t.Fatal("OpenWithRetry succeeded")
+	}
+	if want := []time.Duration{time.Millisecond, 0}; !reflect.DeepEqual(delays, want) {
+		t.Errorf("next delays = %v, want %v", delays, want)
+	}
+}
+
+func TestLazyOpen(t *testing.T) {
+	dialector := &flakyDialector{Dialector: sqlite.Open(filepath.Join(t.TempDir(), "test.db")), failures: 1}
+	c := New(false, nil).SetDialector(dialector).EnableLazyOpen(ConstantRetryPolicy(time.Millisecond, 3))
+	defer c.Close()
+	if c.IsOpen() {
+		t.Fatal("EnableLazyOpen opened the database")
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var count int64
+			errs <- c.Db().Table("sqlite_master").Count(&count).Error
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if opens := c.Counters().Opens; opens != 1 {
+		t.Errorf("%d opens, want 1", opens)
+	}
+	if attempts := atomic.LoadInt32(&dialector.attempts); attempts != 2 {
+		t.Errorf("%d attempts, want the failed one and a retry", attempts)
+	}
+	if _, err := c.CommonDBE(); err != nil {
+		t.Errorf("CommonDBE() = %v after the lazy open", err)
+	}
+}
+
+func TestLazyOpenFailure(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param("/nonexistent/dir/test.db").
+		EnableLazyOpen(ConstantRetryPolicy(time.Millisecond, 2))
+	if _, err := c.DbE(); err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("DbE() = %v, want the open error", err)
+	}
+	if _, err := c.CommonDBE(); err == nil {
+		t.Error("CommonDBE succeeded")
+	}
+	var count int64
+	err := c.Db().Table("sqlite_master").Count(&count).Error
+	if err == nil || !strings.HasPrefix(err.Error(), "dbwrap: open sqlite /nonexistent/dir/test.db: ") ||
+		!strings.Contains(err.Error(), "sqlite directory") {
+		t.Errorf("Db() error %v, want the open error naming the target", err)
+	}
+	if db := c.CommonDB(); db != nil {
+		t.Error("CommonDB() returned a pool")
+	}
+	if err = c.DebugSession().Exec("SELECT 1").Error; err == nil || !strings.Contains(err.Error(), "sqlite directory") {
+		t.Errorf("DebugSession() error %v, want the open error", err)
+	}
+}
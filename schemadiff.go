@@ -0,0 +1,250 @@
+package dbwrap
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// internalTables are the tables of dbwrap itself, which SchemaDiff does not report as extra.
+var internalTables = map[string]bool{MigrationsTable: true}
+
+// DiffReport lists the differences between the models and the live schema.
+type DiffReport struct {
+	// MissingTables are the tables of models that do not exist.
+	MissingTables []string `json:"missing_tables,omitempty"`
+	// ExtraTables are the tables no model has.
+	ExtraTables []string    `json:"extra_tables,omitempty"`
+	Tables      []TableDiff `json:"tables,omitempty"`
+}
+
+// TableDiff lists the differences of a table of a model.
+type TableDiff struct {
+	Table             string       `json:"table"`
+	MissingColumns    []string     `json:"missing_columns,omitempty"`
+	ExtraColumns      []string     `json:"extra_columns,omitempty"`
+	MismatchedColumns []ColumnDiff `json:"mismatched_columns,omitempty"`
+	MissingIndexes    []string     `json:"missing_indexes,omitempty"`
+}
+
+// ColumnDiff is a column whose Property, "type", "nullable" or "default", differs between the model and the
+// live table.
+type ColumnDiff struct {
+	Column   string `json:"column"`
+	Property string `json:"property"`
+	Model    string `json:"model"`
+	Live     string `json:"live"`
+}
+
+// Empty reports whether the models match the live schema.
+func (r DiffReport) Empty() bool {
+	return len(r.MissingTables) <= 0 && len(r.ExtraTables) <= 0 && len(r.Tables) <= 0
+}
+
+// SchemaDriftError is returned by Migrate with SetStrictMigrate when the schema still differs from the
+// models once migrated.
+type SchemaDriftError struct {
+	Report DiffReport
+}
+
+func (e *SchemaDriftError) Error() string {
+	return fmt.Sprintf("dbwrap: schema drift: %d missing tables, %d extra tables, %d tables with differences",
+		len(e.Report.MissingTables), len(e.Report.ExtraTables), len(e.Report.Tables))
+}
+
+// SetStrictMigrate makes Migrate fail with a SchemaDriftError when the schema does not match the registered
+// models after migrating, e.g. because of columns or tables the models do not know about.
+func (c *DbMgt) SetStrictMigrate(strict bool) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.strictMigrate = strict
+	return c
+}
+
+// SchemaDiff compares the live schema with models, or the registered models when none is given. Column types
+// are compared without their size and under their common name, e.g. "character varying" is varchar.
+func (c *DbMgt) SchemaDiff(models ...interface{}) (DiffReport, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return DiffReport{}, err
+	}
+	c.lock.Lock()
+	if len(models) <= 0 {
+		models = append(models, c.models...)
+	}
+	models, err = sortModels(models, c.modelDeps)
+	c.lock.Unlock()
+	if err != nil {
+		return DiffReport{}, err
+	}
+	return schemaDiff(db, models)
+}
+
+func schemaDiff(db *gorm.DB, models []interface{}) (DiffReport, error) {
+	var report DiffReport
+	live, err := listTables(db)
+	if err != nil {
+		return report, err
+	}
+	liveTables := make(map[string]bool, len(live))
+	for _, t := range live {
+		liveTables[t] = true
+	}
+	known := make(map[string]bool)
+	for _, model := range models {
+		for _, value := range reorderModels(db, model) {
+			stmt := &gorm.Statement{DB: db}
+			if err = stmt.Parse(value); err != nil {
+				return report, err
+			}
+			_, name := splitTable(stmt.Table)
+			if known[name] {
+				continue
+			}
+			known[name] = true
+			if !liveTables[name] {
+				report.MissingTables = append(report.MissingTables, stmt.Table)
+				continue
+			}
+			diff, err := tableDiff(db, value, stmt)
+			if err != nil {
+				return report, err
+			}
+			if len(diff.MissingColumns) > 0 || len(diff.ExtraColumns) > 0 || len(diff.MismatchedColumns) > 0 ||
+				len(diff.MissingIndexes) > 0 {
+				report.Tables = append(report.Tables, diff)
+			}
+		}
+	}
+	for _, t := range live {
+		if !known[t] && !internalTables[t] {
+			report.ExtraTables = append(report.ExtraTables, t)
+		}
+	}
+	return report, nil
+}
+
+func tableDiff(db *gorm.DB, value interface{}, stmt *gorm.Statement) (TableDiff, error) {
+	diff := TableDiff{Table: stmt.Table}
+	columns, err := listColumns(db, value)
+	if err != nil {
+		return diff, err
+	}
+	liveColumns := make(map[string]ColumnInfo, len(columns))
+	for _, col := range columns {
+		liveColumns[col.Name] = col
+		if _, ok := stmt.Schema.FieldsByDBName[col.Name]; !ok {
+			diff.ExtraColumns = append(diff.ExtraColumns, col.Name)
+		}
+	}
+	dataTypeOf := db.Dialector.DataTypeOf
+	if m, ok := db.Migrator().(interface{ DataTypeOf(*schema.Field) string }); ok {
+		// honors the GormDBDataType of the field types
+		dataTypeOf = m.DataTypeOf
+	}
+	for _, dbName := range stmt.Schema.DBNames {
+		field := stmt.Schema.FieldsByDBName[dbName]
+		col, ok := liveColumns[dbName]
+		if !ok {
+			diff.MissingColumns = append(diff.MissingColumns, dbName)
+			continue
+		}
+		diff.MismatchedColumns = append(diff.MismatchedColumns, columnDiffs(dataTypeOf(field), field, col)...)
+	}
+	indexes, err := listIndexes(db, value)
+	if err != nil {
+		return diff, err
+	}
+	liveIndexes := make(map[string]bool, len(indexes))
+	for _, idx := range indexes {
+		liveIndexes[idx.Name] = true
+	}
+	var missing []string
+	for name := range stmt.Schema.ParseIndexes() {
+		if !liveIndexes[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	diff.MissingIndexes = missing
+	return diff, nil
+}
+
+func columnDiffs(dataType string, field *schema.Field, col ColumnInfo) []ColumnDiff {
+	var diffs []ColumnDiff
+	if modelType, liveType := normalizeType(dataType), normalizeType(col.DBType); modelType != liveType {
+		diffs = append(diffs, ColumnDiff{Column: col.Name, Property: "type", Model: modelType, Live: liveType})
+	}
+	if field.PrimaryKey || col.PrimaryKey {
+		// the nullability and default, e.g. the sequence, of primary keys are up to the driver
+		return diffs
+	}
+	if nullable := !field.NotNull; nullable != col.Nullable {
+		diffs = append(diffs, ColumnDiff{Column: col.Name, Property: "nullable", Model: fmt.Sprint(nullable),
+			Live: fmt.Sprint(col.Nullable)})
+	}
+	var modelDefault, liveDefault string
+	if field.HasDefaultValue {
+		modelDefault = normalizeDefault(field.DefaultValue)
+	}
+	if col.Default != nil {
+		liveDefault = normalizeDefault(*col.Default)
+	}
+	if !sameDefault(modelDefault, liveDefault) {
+		diffs = append(diffs, ColumnDiff{Column: col.Name, Property: "default", Model: modelDefault, Live: liveDefault})
+	}
+	return diffs
+}
+
+var typeAliases = map[string]string{
+	"character varying": "varchar", "character": "char", "int": "integer", "int4": "integer", "int8": "bigint",
+	"int2": "smallint", "serial": "integer", "bigserial": "bigint", "smallserial": "smallint", "bool": "boolean",
+	"timestamptz": "timestamp with time zone", "decimal": "numeric", "float8": "double precision",
+	"double": "double precision", "float4": "real",
+}
+
+func normalizeType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if idx := strings.Index(t, "("); idx >= 0 {
+		t = strings.TrimSpace(t[:idx])
+	}
+	if alias, ok := typeAliases[t]; ok {
+		return alias
+	}
+	return t
+}
+
+var defaultCast = regexp.MustCompile(`::[a-z ]+$`)
+
+// normalizeDefault removes the parentheses, casts and quotes databases add to default expressions.
+func normalizeDefault(d string) string {
+	d = strings.TrimSpace(d)
+	for strings.HasPrefix(d, "(") && strings.HasSuffix(d, ")") {
+		d = strings.TrimSpace(d[1 : len(d)-1])
+	}
+	d = defaultCast.ReplaceAllString(d, "")
+	return strings.Trim(d, `'"`)
+}
+
+func sameDefault(a, b string) bool {
+	if a == b {
+		return true
+	}
+	// gorm writes the numeric defaults with a fixed precision, e.g. 1.500000 for 1.5
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	return errA == nil && errB == nil && x == y
+}
+
+func SetStrictMigrate(strict bool) *DbMgt {
+	return DefaultDbMgt().SetStrictMigrate(strict)
+}
+
+func SchemaDiff(models ...interface{}) (DiffReport, error) {
+	return DefaultDbMgt().SchemaDiff(models...)
+}
@@ -0,0 +1,106 @@
+package dbwrap
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testDriftV1 struct {
+	ID     uint
+	Name   string `gorm:"index"`
+	Age    int
+	Score  int
+	Legacy string
+}
+
+func (testDriftV1) TableName() string {
+	return "drifts"
+}
+
+type testDriftV2 struct {
+	ID    uint
+	Name  string `gorm:"index"`
+	Age   int    `gorm:"not null;default:3"`
+	Score string
+	Email string `gorm:"index"`
+}
+
+func (testDriftV2) TableName() string {
+	return "drifts"
+}
+
+func TestSchemaDiff(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Db().AutoMigrate(&testDriftV1{}); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := c.SchemaDiff(&testDriftV1{}); err != nil || !report.Empty() {
+		t.Fatalf("SchemaDiff() = %+v, %v right after the migration, want no difference", report, err)
+	}
+	if err := c.Db().Exec("CREATE TABLE other (id INTEGER)").Error; err != nil {
+		t.Fatal(err)
+	}
+	report, err := c.SchemaDiff(&testDriftV2{}, &testUser{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DiffReport{
+		MissingTables: []string{"test_users"},
+		ExtraTables:   []string{"other"},
+		Tables: []TableDiff{{
+			Table:          "drifts",
+			MissingColumns: []string{"email"},
+			ExtraColumns:   []string{"legacy"},
+			MismatchedColumns: []ColumnDiff{
+				{Column: "age", Property: "nullable", Model: "false", Live: "true"},
+				{Column: "age", Property: "default", Model: "3", Live: ""},
+				{Column: "score", Property: "type", Model: "text", Live: "integer"},
+			},
+			MissingIndexes: []string{"idx_drifts_email"},
+		}},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("SchemaDiff() = %+v, want %+v", report, want)
+	}
+	// the report goes to CI checks as JSON
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded DiffReport
+	if err = json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded, report) {
+		t.Errorf("JSON round trip = %+v, %v, want %+v", decoded, err, report)
+	}
+}
+
+func TestStrictMigrate(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Db().Exec("CREATE TABLE other (id INTEGER)").Error; err != nil {
+		t.Fatal(err)
+	}
+	// AutoMigrate only adds, the extra table and column stay
+	if err := c.Db().Exec("CREATE TABLE test_users (id INTEGER PRIMARY KEY, name TEXT, legacy TEXT)").Error; err != nil {
+		t.Fatal(err)
+	}
+	err := c.SetStrictMigrate(true).Migrate(&testUser{})
+	var drift *SchemaDriftError
+	if !errors.As(err, &drift) {
+		t.Fatalf("Migrate() = %v, want a SchemaDriftError", err)
+	}
+	want := DiffReport{ExtraTables: []string{"other"},
+		Tables: []TableDiff{{Table: "test_users", ExtraColumns: []string{"legacy"}}}}
+	if !reflect.DeepEqual(drift.Report, want) {
+		t.Errorf("drift = %+v, want %+v", drift.Report, want)
+	}
+	if err = c.Db().Exec("DROP TABLE other").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Db().Exec("ALTER TABLE test_users DROP COLUMN legacy").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Migrate(); err != nil {
+		t.Errorf("Migrate() = %v without drift", err)
+	}
+}
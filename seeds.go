@@ -0,0 +1,156 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SeedsTable records the seeds RunSeeds ran.
+const SeedsTable = "dbwrap_seeds"
+
+func init() {
+	internalTables[SeedsTable] = true
+}
+
+type seed struct {
+	name string
+	fn   func(tx *gorm.DB) error
+}
+
+type seedRecord struct {
+	Name      string `gorm:"primaryKey;size:255"`
+	AppliedAt time.Time
+}
+
+func (seedRecord) TableName() string {
+	return SeedsTable
+}
+
+// RegisterSeedFunc registers fn to insert the reference data name, e.g. the roles, for RunSeeds. A seed without
+// name or func, or with the name of a registered one, is rejected.
+func (c *DbMgt) RegisterSeedFunc(name string, fn func(tx *gorm.DB) error) error {
+	if len(name) <= 0 {
+		return errors.New("dbwrap: seed without name")
+	}
+	if fn == nil {
+		return fmt.Errorf("dbwrap: seed %s without func", name)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, s := range c.seeds {
+		if s.name == name {
+			return fmt.Errorf("dbwrap: seed %s is already registered", name)
+		}
+	}
+	c.seeds = append(c.seeds, seed{name: name, fn: fn})
+	return nil
+}
+
+// RunSeeds runs the seeds that did not run yet, in registration order and each in its own transaction, and
+// records them in the SeedsTable. It stops at the first failure.
+func (c *DbMgt) RunSeeds(ctx context.Context) error {
+	db, seeds, err := c.seedsDB(ctx)
+	if err != nil {
+		return err
+	}
+	c.migrateLock.Lock()
+	defer c.migrateLock.Unlock()
+	var done []seedRecord
+	if err = db.Find(&done).Error; err != nil {
+		return fmt.Errorf("dbwrap: read %s: %w", SeedsTable, err)
+	}
+	ran := make(map[string]bool, len(done))
+	for _, r := range done {
+		ran[r.Name] = true
+	}
+	for _, s := range seeds {
+		if ran[s.name] {
+			continue
+		}
+		if err = runSeed(db, s, false); err != nil {
+			return err
+		}
+		if c.log != nil {
+			c.log.Info(ctx, "dbwrap: ran seed %s", s.name)
+		}
+	}
+	return nil
+}
+
+// ForceSeed runs the seed name again, e.g. once its func fixes bad reference data.
+func (c *DbMgt) ForceSeed(name string) error {
+	db, seeds, err := c.seedsDB(context.Background())
+	if err != nil {
+		return err
+	}
+	c.migrateLock.Lock()
+	defer c.migrateLock.Unlock()
+	for _, s := range seeds {
+		if s.name == name {
+			return runSeed(db, s, true)
+		}
+	}
+	return fmt.Errorf("dbwrap: seed %s is not registered", name)
+}
+
+// errSeedRan rolls back the transaction of a seed that another runner recorded meanwhile.
+var errSeedRan = errors.New("dbwrap: seed already ran")
+
+// runSeed records the seed s before running it, so that of the runners racing for it only the one whose record
+// is inserted, the others waiting for its transaction, runs it. With force the record of a previous run is
+// replaced.
+func runSeed(db *gorm.DB, s seed, force bool) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if force {
+			if err := tx.Delete(&seedRecord{Name: s.name}).Error; err != nil {
+				return err
+			}
+		}
+		insert := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seedRecord{Name: s.name, AppliedAt: time.Now()})
+		if insert.Error != nil {
+			return insert.Error
+		}
+		if insert.RowsAffected <= 0 {
+			return errSeedRan
+		}
+		return s.fn(tx)
+	})
+	if err != nil && !errors.Is(err, errSeedRan) {
+		return fmt.Errorf("dbwrap: seed %s: %w", s.name, err)
+	}
+	return nil
+}
+
+// seedsDB returns the database, with the SeedsTable created, and a copy of the registered seeds.
+func (c *DbMgt) seedsDB(ctx context.Context) (*gorm.DB, []seed, error) {
+	db, err := c.DbE()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.lock.Lock()
+	seeds := append([]seed(nil), c.seeds...)
+	c.lock.Unlock()
+	db = db.WithContext(ctx)
+	// the runners starting together race to create the table, the losers find it created
+	if err = db.AutoMigrate(&seedRecord{}); err != nil && !db.Migrator().HasTable(&seedRecord{}) {
+		return nil, nil, fmt.Errorf("dbwrap: create %s: %w", SeedsTable, err)
+	}
+	return db, seeds, nil
+}
+
+func RegisterSeedFunc(name string, fn func(tx *gorm.DB) error) error {
+	return DefaultDbMgt().RegisterSeedFunc(name, fn)
+}
+
+func RunSeeds(ctx context.Context) error {
+	return DefaultDbMgt().RunSeeds(ctx)
+}
+
+func ForceSeed(name string) error {
+	return DefaultDbMgt().ForceSeed(name)
+}
@@ -0,0 +1,129 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// seededNames returns the names of the seeds recorded as ran, sorted.
+func seededNames(t *testing.T, c *DbMgt) []string {
+	t.Helper()
+	var names []string
+	if err := c.Db().Model(&seedRecord{}).Order("name").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestRunSeeds(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, name := range []string{"roles", "admin", "plans"} {
+		name := name
+		err := c.RegisterSeedFunc(name, func(tx *gorm.DB) error {
+			order = append(order, name)
+			return tx.Create(&testUser{Name: name}).Error
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.RunSeeds(context.Background()); err != nil {
+			t.Fatalf("RunSeeds #%d: %v", i+1, err)
+		}
+	}
+	if want := []string{"roles", "admin", "plans"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("ran %v, want each seed once in registration order %v", order, want)
+	}
+	if n := countUsers(t, c); n != 3 {
+		t.Errorf("%d users, want 3", n)
+	}
+	if err := c.ForceSeed("admin"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countUsers(t, c); n != 4 || order[len(order)-1] != "admin" {
+		t.Errorf("%d users after ForceSeed, ran %v, want admin again", n, order)
+	}
+	if err := c.ForceSeed("missing"); err == nil {
+		t.Error("ForceSeed ran an unknown seed")
+	}
+	if got, want := seededNames(t, c), []string{"admin", "plans", "roles"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded %v, want %v", got, want)
+	}
+}
+
+func TestRunSeedsFailure(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	errSeed := errors.New("bad data")
+	fail := true
+	seeds := []struct {
+		name string
+		fn   func(tx *gorm.DB) error
+	}{
+		{"roles", func(tx *gorm.DB) error { return tx.Create(&testUser{Name: "roles"}).Error }},
+		{"plans", func(tx *gorm.DB) error {
+			if err := tx.Create(&testUser{Name: "plans"}).Error; err != nil || !fail {
+				return err
+			}
+			return errSeed
+		}},
+		{"flags", func(tx *gorm.DB) error { return tx.Create(&testUser{Name: "flags"}).Error }},
+	}
+	for _, s := range seeds {
+		if err := c.RegisterSeedFunc(s.name, s.fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := c.RunSeeds(context.Background())
+	if !errors.Is(err, errSeed) || !strings.Contains(err.Error(), "seed plans") {
+		t.Fatalf("RunSeeds() = %v, want the error of the plans seed", err)
+	}
+	// the seeds before the failure stay recorded, the failed one is rolled back
+	if got, want := seededNames(t, c), []string{"roles"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded %v, want %v", got, want)
+	}
+	if n := countUsers(t, c); n != 1 {
+		t.Errorf("%d users, want the one of the roles seed", n)
+	}
+	fail = false
+	if err = c.RunSeeds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := seededNames(t, c), []string{"flags", "plans", "roles"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded %v after the fix, want %v", got, want)
+	}
+	if n := countUsers(t, c); n != 3 {
+		t.Errorf("%d users, want 3", n)
+	}
+}
+
+func TestRegisterSeedFunc(t *testing.T) {
+	c := New(false, nil)
+	fn := func(*gorm.DB) error { return nil }
+	if err := c.RegisterSeedFunc("roles", fn); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []struct {
+		name string
+		fn   func(*gorm.DB) error
+	}{{"", fn}, {"plans", nil}, {"roles", fn}} {
+		if err := c.RegisterSeedFunc(s.name, s.fn); err == nil {
+			t.Errorf("RegisterSeedFunc(%q) accepted an invalid seed", s.name)
+		}
+	}
+	if err := c.RunSeeds(context.Background()); !errors.Is(err, ErrNotOpened) {
+		t.Errorf("RunSeeds() = %v before Open, want ErrNotOpened", err)
+	}
+}
@@ -0,0 +1,123 @@
+package dbwrap
+
+import (
+	"context"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ServerInfo identifies the server and the database a DbMgt is connected to.
+type ServerInfo struct {
+	Driver   string
+	Version  string
+	Database string
+	User     string
+	Host     string
+}
+
+var serverInfoQueries = map[string]string{
+	driverPostgres:  "SELECT version(), current_database(), current_user",
+	driverMysql:     "SELECT VERSION(), DATABASE(), CURRENT_USER()",
+	driverSqlite:    "SELECT sqlite_version(), '', ''",
+	driverSqlServer: "SELECT @@VERSION, DB_NAME(), SUSER_SNAME()",
+}
+
+// parseServerVersion shortens the verbose version strings of postgres, "PostgreSQL 15.2 on x86_64-pc-linux-gnu,
+// compiled by ...", and sqlserver, which spans several lines.
+func parseServerVersion(driver, version string) string {
+	version = strings.TrimSpace(version)
+	switch driver {
+	case driverPostgres:
+		if fields := strings.Fields(version); len(fields) >= 2 {
+			return fields[0] + " " + fields[1]
+		}
+	case driverSqlServer:
+		if idx := strings.IndexByte(version, '\n'); idx >= 0 {
+			version = strings.TrimSpace(version[:idx])
+		}
+		if idx := strings.Index(version, " (X"); idx >= 0 {
+			version = version[:idx]
+		}
+	}
+	return version
+}
+
+func queryServerInfo(ctx context.Context, db *gorm.DB, driver, host string) (ServerInfo, error) {
+	info := ServerInfo{Driver: driver, Host: host}
+	query, ok := serverInfoQueries[driver]
+	if !ok {
+		return info, nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return info, err
+	}
+	var version string
+	if err = sqlDB.QueryRowContext(ctx, query).Scan(&version, &info.Database, &info.User); err != nil {
+		return info, err
+	}
+	info.Version = parseServerVersion(driver, version)
+	return info, nil
+}
+
+// SetLogConnectionInfo makes Open log the server version, database and user it connected to.
+func (c *DbMgt) SetLogConnectionInfo(enabled bool) *DbMgt {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.logConnInfo = enabled
+	return c
+}
+
+// ServerInfo returns the server version and connection identity, queried once per opened connection pool.
+func (c *DbMgt) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.db == nil {
+		return ServerInfo{}, ErrNotOpened
+	}
+	if c.serverInfo != nil {
+		return *c.serverInfo, nil
+	}
+	return c.loadServerInfo(ctx, c.db)
+}
+
+func (c *DbMgt) loadServerInfo(ctx context.Context, db *gorm.DB) (ServerInfo, error) {
+	driver := db.Dialector.Name()
+	host := c.config.Host
+	if len(c.config.Port) > 0 && !isSocketPath(host) {
+		host += ":" + c.config.Port
+	}
+	info, err := queryServerInfo(ctx, db, driver, host)
+	if err != nil {
+		return info, err
+	}
+	if driver == driverSqlite {
+		info.Database = c.config.Name
+	}
+	c.serverInfo = &info
+	return info, nil
+}
+
+// logServerInfo is called with the lock held once db is opened.
+func (c *DbMgt) logServerInfo(ctx context.Context, db *gorm.DB) {
+	c.serverInfo = nil
+	if !c.logConnInfo {
+		return
+	}
+	info, err := c.loadServerInfo(ctx, db)
+	if err != nil {
+		c.log.Warn(ctx, "dbwrap: query server info: %v", err)
+		return
+	}
+	c.eventLog.Info(ctx, "dbwrap: connected driver=%s version=%q database=%s user=%s host=%s",
+		info.Driver, info.Version, info.Database, info.User, info.Host)
+}
+
+func SetLogConnectionInfo(enabled bool) *DbMgt {
+	return DefaultDbMgt().SetLogConnectionInfo(enabled)
+}
+
+func GetServerInfo(ctx context.Context) (ServerInfo, error) {
+	return DefaultDbMgt().ServerInfo(ctx)
+}
@@ -0,0 +1,86 @@
+package dbwrap
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ShutdownTimeout bounds the graceful close of HandleSignals.
+var ShutdownTimeout = 30 * time.Second
+
+// the open instances, an instance leaves the registry when it is closed, so it can be garbage collected
+var (
+	instances     = make(map[*DbMgt]struct{})
+	instancesLock sync.Mutex
+)
+
+func track(c *DbMgt) {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	instances[c] = struct{}{}
+}
+
+func untrack(c *DbMgt) {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	delete(instances, c)
+}
+
+// Shutdown closes every open instance with CloseGracefully, concurrently, and returns their errors as a
+// MultiError.
+func Shutdown(ctx context.Context) error {
+	instancesLock.Lock()
+	open := make([]*DbMgt, 0, len(instances))
+	for c := range instances {
+		open = append(open, c)
+	}
+	instancesLock.Unlock()
+
+	errs := make([]error, len(open))
+	var wg sync.WaitGroup
+	for i, c := range open {
+		wg.Add(1)
+		go func(i int, c *DbMgt) {
+			defer wg.Done()
+			errs[i] = c.CloseGracefully(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+	var multi MultiError
+	for _, err := range errs {
+		if err != nil {
+			multi = append(multi, err)
+		}
+	}
+	return multi.errorOrNil()
+}
+
+// HandleSignals calls Shutdown, bounded by ShutdownTimeout, on the first of signals, SIGINT or SIGTERM by
+// default. The returned channel receives its result and is then closed. When ctx is done first, the signals
+// are no longer handled and the channel is closed without a result.
+func HandleSignals(ctx context.Context, signals ...os.Signal) <-chan error {
+	if len(signals) <= 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signals...)
+	done := make(chan error, 1)
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			signal.Stop(sig)
+			return
+		case <-sig:
+		}
+		signal.Stop(sig)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		done <- Shutdown(shutdownCtx)
+	}()
+	return done
+}
@@ -0,0 +1,109 @@
+package dbwrap
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"testing"
+	"time"
+)
+
+func tracked(c *DbMgt) bool {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	_, ok := instances[c]
+	return ok
+}
+
+func TestShutdown(t *testing.T) {
+	a, b := openSqlite(t), openSqlite(t)
+	if !tracked(a) || !tracked(b) {
+		t.Fatal("Open did not register the instances")
+	}
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*DbMgt{a, b} {
+		if c.IsOpen() || tracked(c) {
+			t.Errorf("%s is still open or registered after Shutdown", c.DSN())
+		}
+	}
+	if err := Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() = %v with nothing open", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	slow, idle := openSqliteSleep(t), openSqlite(t)
+	done := slowQuery(t, slow, 500*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := Shutdown(ctx)
+	if multi, ok := err.(MultiError); !ok || len(multi) != 1 || multi[0] != ErrCloseTimedOut {
+		t.Errorf("Shutdown() = %v, want the timeout of the slow instance only", err)
+	}
+	if idle.IsOpen() {
+		t.Error("the idle instance is still open")
+	}
+	<-done
+}
+
+func TestHandleSignals(t *testing.T) {
+	c := openSqlite(t)
+	done := HandleSignals(context.Background(), os.Interrupt)
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Signal(os.Interrupt); err != nil {
+		t.Skipf("can not signal the test process: %v", err)
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the signal did not shut down")
+	}
+	if c.IsOpen() {
+		t.Error("the instance is still open")
+	}
+	if _, ok := <-done; ok {
+		t.Error("the done channel is not closed")
+	}
+}
+
+func TestHandleSignalsCancel(t *testing.T) {
+	c := openSqlite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := HandleSignals(ctx, os.Interrupt)
+	cancel()
+	select {
+	case err, ok := <-done:
+		if ok {
+			t.Errorf("done received %v, want it closed without a result", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the cancellation did not stop the signal handling")
+	}
+	// the test process keeps its own handler, so the signal does not kill it
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Signal(os.Interrupt); err != nil {
+		t.Skipf("can not signal the test process: %v", err)
+	}
+	select {
+	case <-sig:
+	case <-time.After(time.Second):
+		t.Fatal("the signal was not delivered")
+	}
+	if !c.IsOpen() {
+		t.Error("the signal closed the instance after the cancellation")
+	}
+}
@@ -0,0 +1,94 @@
+package dbwrap
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SlowQueryHandler receives the statements that ran for at least the slow query threshold.
+type SlowQueryHandler func(ctx context.Context, sql string, rows int64, elapsed time.Duration)
+
+type slowQueryConfig struct {
+	threshold time.Duration
+	handler   SlowQueryHandler
+	vars      bool
+}
+
+func (c *DbMgt) updateSlowQuery(fn func(cfg *slowQueryConfig)) {
+	c.lock.Lock()
+	cfg, _ := c.slowQuery.Load().(slowQueryConfig)
+	fn(&cfg)
+	c.slowQuery.Store(cfg)
+	c.lock.Unlock()
+	c.enableQueryCallbacks()
+}
+
+// SetSlowQueryThreshold reports the statements running for at least d, whether debug is on or not, to the
+// handler of SetSlowQueryHandler or else as a warning in the log. The threshold defaults to 200ms once a handler
+// is set, a negative d turns the reporting off.
+func (c *DbMgt) SetSlowQueryThreshold(d time.Duration) *DbMgt {
+	c.updateSlowQuery(func(cfg *slowQueryConfig) {
+		cfg.threshold = d
+	})
+	return c
+}
+
+// SetSlowQueryHandler reports the slow statements to fn, from the goroutine that ran them. The statement has
+// placeholders instead of its bound values unless SetSlowQueryVars is on, as they may hold personal data.
+func (c *DbMgt) SetSlowQueryHandler(fn SlowQueryHandler) *DbMgt {
+	c.updateSlowQuery(func(cfg *slowQueryConfig) {
+		cfg.handler = fn
+	})
+	return c
+}
+
+// SetSlowQueryVars reports slow statements with their bound values inlined.
+func (c *DbMgt) SetSlowQueryVars(enabled bool) *DbMgt {
+	c.updateSlowQuery(func(cfg *slowQueryConfig) {
+		cfg.vars = enabled
+	})
+	return c
+}
+
+func (c *DbMgt) reportSlowQuery(db *gorm.DB, elapsed time.Duration) {
+	cfg, ok := c.slowQuery.Load().(slowQueryConfig)
+	if !ok || cfg.threshold < 0 || (cfg.threshold == 0 && cfg.handler == nil) {
+		return
+	}
+	threshold := cfg.threshold
+	if threshold == 0 {
+		threshold = defaultSlowThreshold
+	}
+	if elapsed < threshold {
+		return
+	}
+	stmt := db.Statement
+	sql := stmt.SQL.String()
+	if cfg.vars {
+		sql = db.Dialector.Explain(sql, stmt.Vars...)
+	}
+	if cfg.handler == nil {
+		c.log.Warn(stmt.Context, "dbwrap: slow query (%s >= %s, %d rows): %s", elapsed, threshold, db.RowsAffected, sql)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c.log.Error(nil, "dbwrap: slow query handler panicked: %v", r)
+		}
+	}()
+	cfg.handler(stmt.Context, sql, db.RowsAffected, elapsed)
+}
+
+func SetSlowQueryThreshold(d time.Duration) *DbMgt {
+	return DefaultDbMgt().SetSlowQueryThreshold(d)
+}
+
+func SetSlowQueryHandler(fn SlowQueryHandler) *DbMgt {
+	return DefaultDbMgt().SetSlowQueryHandler(fn)
+}
+
+func SetSlowQueryVars(enabled bool) *DbMgt {
+	return DefaultDbMgt().SetSlowQueryVars(enabled)
+}
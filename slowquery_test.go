@@ -0,0 +1,73 @@
+package dbwrap
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type slowQueryRecord struct {
+	sql     string
+	rows    int64
+	elapsed time.Duration
+}
+
+// recordSlowQueries sets a handler on c keeping the slow queries reported.
+func recordSlowQueries(c *DbMgt) func() []slowQueryRecord {
+	var lock sync.Mutex
+	var records []slowQueryRecord
+	c.SetSlowQueryHandler(func(_ context.Context, sql string, rows int64, elapsed time.Duration) {
+		lock.Lock()
+		defer lock.Unlock()
+		records = append(records, slowQueryRecord{sql, rows, elapsed})
+	})
+	return func() []slowQueryRecord {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]slowQueryRecord(nil), records...)
+	}
+}
+
+func TestSlowQueryHandler(t *testing.T) {
+	c := openSqliteSleep(t).SetSlowQueryThreshold(50 * time.Millisecond)
+	records := recordSlowQueries(c)
+	// Exec, as the row callbacks return before sqlite runs the statement, when the rows are read
+	if err := c.Db().Exec("SELECT sleep(?)", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := records(); len(got) != 0 {
+		t.Errorf("fast query reported: %+v", got)
+	}
+	if err := c.Db().Exec("SELECT sleep(?)", 80).Error; err != nil {
+		t.Fatal(err)
+	}
+	got := records()
+	if len(got) != 1 || got[0].sql != "SELECT sleep(?)" || got[0].elapsed < 80*time.Millisecond {
+		t.Fatalf("reported %+v, want the slow query without its values", got)
+	}
+	c.SetSlowQueryVars(true)
+	if err := c.Db().Exec("SELECT sleep(?)", 60).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got = records(); len(got) != 2 || got[1].sql != "SELECT sleep(60)" {
+		t.Errorf("reported %+v, want the slow query with its values", got)
+	}
+	c.SetSlowQueryThreshold(-1)
+	if err := c.Db().Exec("SELECT sleep(?)", 60).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got = records(); len(got) != 2 {
+		t.Errorf("reported %+v with the reporting off", got)
+	}
+}
+
+func TestSlowQueryHandlerPanic(t *testing.T) {
+	c := openSqliteSleep(t).SetSlowQueryThreshold(time.Millisecond)
+	c.SetSlowQueryHandler(func(context.Context, string, int64, time.Duration) {
+		panic("handler failure")
+	})
+	if err := c.Db().Exec("SELECT sleep(?)", 5).Error; err != nil {
+		t.Errorf("Exec() = %v with a panicking handler", err)
+	}
+}
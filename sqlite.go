@@ -0,0 +1,128 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var sqliteMemorySeq uint64
+
+// SetSqlite3InMemory uses an in-memory database shared by every connection of the pool, which is pinned to a
+// single open connection unless MaxOpenConns is configured. When shared is true all in-memory instances of the
+// process see the same database, otherwise each instance gets its own.
+func (c *DbMgt) SetSqlite3InMemory(shared bool) *DbMgt {
+	name := "file::memory:?cache=shared"
+	if !shared {
+		name = fmt.Sprintf("file:dbwrap%d?mode=memory&cache=shared", atomic.AddUint64(&sqliteMemorySeq, 1))
+	}
+	return c.setParam(Config{Driver: driverSqlite, Name: name, memory: true})
+}
+
+func SetSqlite3InMemory(shared bool) *DbMgt {
+	return DefaultDbMgt().SetSqlite3InMemory(shared)
+}
+
+var sqlitePragmaPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var sqlitePragmaValuePattern = regexp.MustCompile(`^[A-Za-z0-9_.+-]+$`)
+
+// sqliteDir returns the directory of the database file name, or false for an in-memory database.
+func sqliteDir(name string) (string, bool) {
+	if name == ":memory:" || strings.Contains(name, "mode=memory") || strings.HasPrefix(name, "file::memory:") {
+		return "", false
+	}
+	path := strings.TrimPrefix(name, "file:")
+	if idx := strings.Index(path, "?"); idx >= 0 {
+		path = path[:idx]
+	}
+	return filepath.Dir(path), true
+}
+
+func checkSqliteDir(name string) error {
+	dir, ok := sqliteDir(name)
+	if !ok {
+		return nil
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("dbwrap: sqlite directory: %w", err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("dbwrap: sqlite directory %s is not a directory", dir)
+	}
+	return nil
+}
+
+func checkSqlitePragmas(pragmas map[string]string) error {
+	for name, value := range pragmas {
+		if !sqlitePragmaPattern.MatchString(name) {
+			return fmt.Errorf("dbwrap: invalid sqlite pragma name %q", name)
+		}
+		if !sqlitePragmaValuePattern.MatchString(value) {
+			return fmt.Errorf("dbwrap: invalid value %q for sqlite pragma %s", value, name)
+		}
+	}
+	return nil
+}
+
+// SetSqlite3Pragmas runs the pragmas on every new connection of the pool, in the order of their names.
+func (c *DbMgt) SetSqlite3Pragmas(pragmas map[string]string) error {
+	if err := checkSqlitePragmas(pragmas); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverSqlite {
+		return errors.New("dbwrap: sqlite pragmas require the sqlite driver")
+	}
+	c.config.Pragmas = copyStringMap(pragmas)
+	return nil
+}
+
+func SetSqlite3Pragmas(pragmas map[string]string) error {
+	return DefaultDbMgt().SetSqlite3Pragmas(pragmas)
+}
+
+type sqliteConnector struct {
+	dsn     string
+	driver  *sqlite3.SQLiteDriver
+	pragmas []string
+}
+
+func newSqliteConnector(dsn string, pragmas map[string]string) *sqliteConnector {
+	names := make([]string, 0, len(pragmas))
+	for name := range pragmas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c := &sqliteConnector{dsn: dsn}
+	for _, name := range names {
+		c.pragmas = append(c.pragmas, name+" = "+pragmas[name])
+	}
+	c.driver = &sqlite3.SQLiteDriver{ConnectHook: c.setPragmas}
+	return c
+}
+
+func (c *sqliteConnector) setPragmas(conn *sqlite3.SQLiteConn) error {
+	for _, pragma := range c.pragmas {
+		if _, err := conn.Exec("PRAGMA "+pragma, nil); err != nil {
+			return fmt.Errorf("dbwrap: sqlite pragma %s: %w", pragma, err)
+		}
+	}
+	return nil
+}
+
+func (c *sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
@@ -0,0 +1,188 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+)
+
+type testUser struct {
+	ID   uint
+	Name string
+}
+
+// openSqlite opens an instance on a sqlite file of a temporary directory, closed when the test ends.
+func openSqlite(t *testing.T) *DbMgt {
+	t.Helper()
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+	})
+	return c
+}
+
+var registerSleepDriver sync.Once
+
+// openSqliteSleep is openSqlite with a sleep(ms) SQL function, to run queries as slow as needed.
+func openSqliteSleep(t *testing.T) *DbMgt {
+	t.Helper()
+	registerSleepDriver.Do(func() {
+		sql.Register("sqlite3_sleep", &sqlite3.SQLiteDriver{ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("sleep", func(ms int64) int64 {
+				time.Sleep(time.Duration(ms) * time.Millisecond)
+				return ms
+			}, false)
+		}})
+	})
+	path := filepath.Join(t.TempDir(), "test.db")
+	c := New(false, nil).SetDialector(&sqlite.Dialector{DriverName: "sqlite3_sleep", DSN: path})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+	})
+	return c
+}
+
+func TestSqlite3InMemory(t *testing.T) {
+	for _, shared := range []bool{false, true} {
+		c := New(false, nil).SetSqlite3InMemory(shared)
+		if err := c.Open(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Migrate(&testUser{}); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := c.PoolStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.MaxOpenConnections != 1 {
+			t.Errorf("shared %v: MaxOpenConnections = %d, want 1", shared, stats.MaxOpenConnections)
+		}
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := c.Db().Create(&testUser{Name: fmt.Sprint("user", i)}).Error; err != nil {
+					errs <- err
+					return
+				}
+				var count int64
+				errs <- c.Db().Model(&testUser{}).Count(&count).Error
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("shared %v: %v", shared, err)
+			}
+		}
+		var count int64
+		if err = c.Db().Model(&testUser{}).Count(&count).Error; err != nil || count != 10 {
+			t.Errorf("shared %v: count = %d, %v, want 10", shared, count, err)
+		}
+		if err = c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSqlite3InMemoryIsolation(t *testing.T) {
+	a, b := New(false, nil).SetSqlite3InMemory(false), New(false, nil).SetSqlite3InMemory(false)
+	if a.UnsafeDSN() == b.UnsafeDSN() {
+		t.Fatalf("both instances use %s", a.UnsafeDSN())
+	}
+	for _, c := range []*DbMgt{a, b} {
+		if err := c.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+	if err := a.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := b.HasTable(&testUser{}); err != nil || has {
+		t.Errorf("HasTable on the other instance = %v, %v, want false", has, err)
+	}
+}
+
+func TestSqlite3Pragmas(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	err := c.SetSqlite3Pragmas(map[string]string{"journal_mode": "WAL", "busy_timeout": "5000", "foreign_keys": "ON"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetConnPool(4, 4, 0, 0)
+	// every connection of the pool runs the pragmas, not only the first one
+	conns := make([]*sql.Conn, 3)
+	for i := range conns {
+		if conns[i], err = c.CommonDB().Conn(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer conns[i].Close()
+	}
+	for i, conn := range conns {
+		for pragma, want := range map[string]string{"journal_mode": "wal", "busy_timeout": "5000", "foreign_keys": "1"} {
+			var got string
+			if err = conn.QueryRowContext(context.Background(), "PRAGMA "+pragma).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("connection %d: PRAGMA %s = %s, want %s", i, pragma, got, want)
+			}
+		}
+	}
+}
+
+func TestSqlite3PragmasOrder(t *testing.T) {
+	connector := newSqliteConnector("test.db", map[string]string{"synchronous": "NORMAL", "foreign_keys": "ON",
+		"journal_mode": "WAL", "busy_timeout": "5000"})
+	want := []string{"busy_timeout = 5000", "foreign_keys = ON", "journal_mode = WAL", "synchronous = NORMAL"}
+	if !reflect.DeepEqual(connector.pragmas, want) {
+		t.Errorf("pragmas = %v, want %v", connector.pragmas, want)
+	}
+}
+
+func TestSqlite3PragmasFailure(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.SetSqlite3Pragmas(map[string]string{"foreign_keys": "ON", "encoding": "bogus"}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.Open()
+	if err == nil {
+		c.Close()
+		t.Fatal("Open succeeded with an invalid pragma")
+	}
+	if !strings.Contains(err.Error(), "encoding = bogus") {
+		t.Errorf("Open error %q does not name the pragma", err)
+	}
+	for _, pragmas := range []map[string]string{{"foreign_keys; DROP": "ON"}, {"foreign_keys": "ON; DROP"}} {
+		if err = c.SetSqlite3Pragmas(pragmas); err == nil {
+			t.Errorf("SetSqlite3Pragmas(%v) accepted an invalid pragma", pragmas)
+		}
+	}
+	if err = New(false, nil).SetPgParam("localhost", "", "user", "", "app", false).SetSqlite3Pragmas(nil); err == nil {
+		t.Error("SetSqlite3Pragmas accepted the postgres driver")
+	}
+}
@@ -0,0 +1,68 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+)
+
+// SetSqlServerOptions adds query parameters such as encrypt, TrustServerCertificate, app name or
+// connection timeout to the sqlserver DSN. The instance option, like a host of the form HOST\INSTANCE,
+// selects a named instance, in which case the port may be left empty.
+func (c *DbMgt) SetSqlServerOptions(opts map[string]string) error {
+	for k := range opts {
+		if len(k) <= 0 || strings.EqualFold(k, "database") {
+			return fmt.Errorf("dbwrap: invalid sqlserver option %q", k)
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverSqlServer {
+		return errors.New("dbwrap: sqlserver options require the sqlserver driver")
+	}
+	for k, v := range opts {
+		c.config.setOption(k, v)
+	}
+	return nil
+}
+
+// SetSqlServerAccessTokenProvider authenticates with access tokens, e.g. from Azure AD, instead of a user and
+// password. The provider is called for every new connection of the pool, so it must return a token that is
+// still valid at that time.
+func (c *DbMgt) SetSqlServerAccessTokenProvider(provider func(ctx context.Context) (string, error)) error {
+	if provider == nil {
+		return errors.New("dbwrap: nil sqlserver access token provider")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.config.Driver != driverSqlServer {
+		return errors.New("dbwrap: access token provider requires the sqlserver driver")
+	}
+	c.config.tokenProvider = provider
+	return nil
+}
+
+func (p *Config) sqlServerTokenDialector(dsn string) (gorm.Dialector, error) {
+	provider := p.tokenProvider
+	connector, err := mssql.NewAccessTokenConnector(dsn, func() (string, error) {
+		return provider(context.Background())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sqlserver.New(sqlserver.Config{DSN: dsn, Conn: sql.OpenDB(connector)}), nil
+}
+
+func SetSqlServerAccessTokenProvider(provider func(ctx context.Context) (string, error)) error {
+	return DefaultDbMgt().SetSqlServerAccessTokenProvider(provider)
+}
+
+func SetSqlServerOptions(opts map[string]string) error {
+	return DefaultDbMgt().SetSqlServerOptions(opts)
+}
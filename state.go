@@ -0,0 +1,85 @@
+package dbwrap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type LifecycleState int
+
+const (
+	StateUnconfigured LifecycleState = iota
+	// StateConfigured is a DbMgt with connection parameters or a dialector that was never opened.
+	StateConfigured
+	StateOpen
+	StateClosed
+)
+
+func (s LifecycleState) String() string {
+	switch s {
+	case StateConfigured:
+		return "configured"
+	case StateOpen:
+		return "open"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unconfigured"
+	}
+}
+
+func (c *DbMgt) IsOpen() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.db != nil
+}
+
+// State returns where c is in its lifecycle and when it got there.
+func (c *DbMgt) State() (LifecycleState, time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	switch {
+	case c.db != nil:
+		return StateOpen, c.stateChanged
+	case c.closed:
+		return StateClosed, c.stateChanged
+	case c.dialector != nil || len(c.config.Driver) > 0:
+		return StateConfigured, c.stateChanged
+	default:
+		return StateUnconfigured, c.stateChanged
+	}
+}
+
+// setState records a transition, it is called with the lock held.
+func (c *DbMgt) setState(open bool) {
+	c.closed = !open
+	c.stateChanged = time.Now()
+}
+
+// LifecycleCounters counts the connection pools opened by Open and Reopen, and the failed pings of Keepalive
+// and the Watchdog, since the DbMgt was created.
+type LifecycleCounters struct {
+	Opens        int64
+	Reopens      int64
+	PingFailures int64
+}
+
+func (c *DbMgt) Counters() LifecycleCounters {
+	return LifecycleCounters{
+		Opens:        atomic.LoadInt64(&c.counters.Opens),
+		Reopens:      atomic.LoadInt64(&c.counters.Reopens),
+		PingFailures: atomic.LoadInt64(&c.counters.PingFailures),
+	}
+}
+
+func IsOpen() bool {
+	return DefaultDbMgt().IsOpen()
+}
+
+func State() (LifecycleState, time.Time) {
+	return DefaultDbMgt().State()
+}
+
+func Counters() LifecycleCounters {
+	return DefaultDbMgt().Counters()
+}
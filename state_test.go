@@ -0,0 +1,91 @@
+package dbwrap
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLifecycle(t *testing.T) {
+	c := New(false, nil)
+	last, lastAt := c.State()
+	expect := func(step string, want LifecycleState, changed bool) {
+		t.Helper()
+		state, at := c.State()
+		if state != want {
+			t.Errorf("%s: state = %s, want %s", step, state, want)
+		}
+		if changed && !at.After(lastAt) {
+			t.Errorf("%s: the state did not change since %s", step, lastAt)
+		} else if !changed && !at.Equal(lastAt) {
+			t.Errorf("%s: the state changed from %s to %s at %s", step, last, state, at)
+		}
+		if c.IsOpen() != (want == StateOpen) {
+			t.Errorf("%s: IsOpen() = %v", step, c.IsOpen())
+		}
+		last, lastAt = state, at
+	}
+	expect("New", StateUnconfigured, false)
+	c.SetSqlite3Param("/nonexistent/dir/test.db")
+	expect("SetSqlite3Param", StateConfigured, true)
+	if err := c.Open(); err == nil {
+		t.Fatal("Open succeeded in a missing directory")
+	}
+	expect("failed Open", StateConfigured, false)
+	c.SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	expect("SetSqlite3Param", StateConfigured, true)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	expect("Open", StateOpen, true)
+	if err := c.Reopen(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expect("Reopen", StateOpen, true)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expect("Close", StateClosed, true)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expect("second Close", StateClosed, false)
+	c.SetSqlite3Param(filepath.Join(t.TempDir(), "other.db"))
+	expect("SetSqlite3Param after Close", StateClosed, false)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	expect("Open after Close", StateOpen, true)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if counters := c.Counters(); counters.Opens != 2 || counters.Reopens != 1 {
+		t.Errorf("counters = %+v, want 2 opens and 1 reopen", counters)
+	}
+}
+
+func TestStateConcurrentOpen(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := c.Open(); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if state, _ := c.State(); state != StateConfigured && state != StateOpen {
+				t.Errorf("state = %s while opening", state)
+			}
+		}()
+	}
+	wg.Wait()
+	defer c.Close()
+	if state, _ := c.State(); state != StateOpen || c.Counters().Opens != 1 {
+		t.Errorf("state = %s after %d opens, want a single open", state, c.Counters().Opens)
+	}
+}
@@ -0,0 +1,58 @@
+package dbwrap
+
+import (
+	"gorm.io/gorm"
+)
+
+func (c *DbMgt) preparedStmtDB() (*gorm.PreparedStmtDB, error) {
+	c.lock.Lock()
+	db := c.db
+	c.lock.Unlock()
+	if db == nil {
+		return nil, ErrNotOpened
+	}
+	pool := db.ConnPool
+	if cached, ok := pool.(*cacheConnPool); ok {
+		pool = cached.ConnPool
+	}
+	stmtDB, _ := pool.(*gorm.PreparedStmtDB)
+	return stmtDB, nil
+}
+
+// StmtCacheSize returns the number of cached prepared statements, 0 when SetPrepareStmt turned the cache off.
+func (c *DbMgt) StmtCacheSize() int {
+	stmtDB, err := c.preparedStmtDB()
+	if err != nil || stmtDB == nil {
+		return 0
+	}
+	stmtDB.Mux.RLock()
+	defer stmtDB.Mux.RUnlock()
+	return len(stmtDB.Stmts)
+}
+
+// ClearStmtCache closes every cached prepared statement, they are prepared again on their next use.
+// Call it periodically when the application generates many distinct queries.
+func (c *DbMgt) ClearStmtCache() error {
+	stmtDB, err := c.preparedStmtDB()
+	if err != nil || stmtDB == nil {
+		return err
+	}
+	// a statement prepared between the close and the reset would be dropped without being closed
+	stmtDB.Mux.Lock()
+	defer stmtDB.Mux.Unlock()
+	// the sessions share the map, which must be emptied in place
+	for query, stmt := range stmtDB.Stmts {
+		delete(stmtDB.Stmts, query)
+		stmt.Close()
+	}
+	stmtDB.PreparedSQL = nil
+	return nil
+}
+
+func StmtCacheSize() int {
+	return DefaultDbMgt().StmtCacheSize()
+}
+
+func ClearStmtCache() error {
+	return DefaultDbMgt().ClearStmtCache()
+}
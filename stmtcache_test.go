@@ -0,0 +1,71 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestStmtCache(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	before := c.StmtCacheSize()
+	for i := 0; i < 5; i++ {
+		query := fmt.Sprintf("SELECT count(*) FROM test_users WHERE id > %d", i)
+		var count int64
+		if err := c.Db().Raw(query).Scan(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size := c.StmtCacheSize(); size != before+5 {
+		t.Errorf("StmtCacheSize() = %d after 5 distinct queries, want %d", size, before+5)
+	}
+	if err := c.ClearStmtCache(); err != nil {
+		t.Fatal(err)
+	}
+	if size := c.StmtCacheSize(); size != 0 {
+		t.Errorf("StmtCacheSize() = %d after ClearStmtCache, want 0", size)
+	}
+	var users []testUser
+	if err := c.Db().Find(&users).Error; err != nil {
+		t.Errorf("Find() = %v after ClearStmtCache", err)
+	}
+	if size := c.StmtCacheSize(); size != 1 {
+		t.Errorf("StmtCacheSize() = %d, want the statement prepared again", size)
+	}
+}
+
+func TestStmtCacheDisabled(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.SetPrepareStmt(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.SetPrepareStmt(true); err != ErrAlreadyOpen {
+		t.Errorf("SetPrepareStmt() = %v once open, want ErrAlreadyOpen", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.Db().Exec("SELECT 1").Error; err != nil {
+			t.Fatal(err)
+		}
+		if size := c.StmtCacheSize(); size != 0 {
+			t.Errorf("StmtCacheSize() = %d with the cache off", size)
+		}
+		if err := c.ClearStmtCache(); err != nil {
+			t.Errorf("ClearStmtCache() = %v with the cache off", err)
+		}
+		// the preference survives Reopen
+		if err := c.Reopen(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := New(false, nil).ClearStmtCache(); err != ErrNotOpened {
+		t.Errorf("ClearStmtCache() = %v before Open, want ErrNotOpened", err)
+	}
+}
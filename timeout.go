@@ -0,0 +1,49 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WithTimeout returns Db bound to a context canceled after d, so its queries fail with
+// context.DeadlineExceeded once d elapsed, and the func canceling the context, to call once done with the
+// session as with context.WithTimeout. It uses the debug session when debug is on.
+func (c *DbMgt) WithTimeout(ctx context.Context, d time.Duration) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	return c.Db().WithContext(ctx), cancel
+}
+
+// TransactionWithTimeout runs fn in a transaction bound to a context canceled after d. On postgres the server
+// enforces the timeout too, with SET LOCAL statement_timeout, so a statement stuck on the server is canceled
+// even when the client is gone.
+func (c *DbMgt) TransactionWithTimeout(ctx context.Context, d time.Duration, fn func(tx *gorm.DB) error) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == driverPostgres {
+			ms := d.Milliseconds()
+			if ms <= 0 {
+				ms = 1
+			}
+			if err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", ms)).Error; err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+func WithTimeout(ctx context.Context, d time.Duration) (*gorm.DB, context.CancelFunc) {
+	return DefaultDbMgt().WithTimeout(ctx, d)
+}
+
+func TransactionWithTimeout(ctx context.Context, d time.Duration, fn func(tx *gorm.DB) error) error {
+	return DefaultDbMgt().TransactionWithTimeout(ctx, d, fn)
+}
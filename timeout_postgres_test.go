@@ -0,0 +1,49 @@
+//go:build postgres
+// +build postgres
+
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+)
+
+func TestTransactionWithTimeoutPostgres(t *testing.T) {
+	c := openPostgres(t)
+	var setting string
+	err := c.TransactionWithTimeout(context.Background(), 100*time.Millisecond, func(tx *gorm.DB) error {
+		if err := tx.Raw("SHOW statement_timeout").Scan(&setting).Error; err != nil {
+			return err
+		}
+		return tx.Exec("SELECT pg_sleep(1)").Error
+	})
+	if setting != "100ms" {
+		t.Errorf("statement_timeout = %q in the transaction, want 100ms", setting)
+	}
+	// the server cancels the statement as the context expires, whichever comes first fails it
+	var pgErr *pgconn.PgError
+	if !(errors.As(err, &pgErr) && pgErr.Code == "57014") && !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TransactionWithTimeout() = %v, want the statement canceled", err)
+	}
+	if err = c.Db().Raw("SHOW statement_timeout").Scan(&setting).Error; err != nil || setting == "100ms" {
+		t.Errorf("statement_timeout = %q, %v after the transaction, want it reset", setting, err)
+	}
+}
+
+func TestWithTimeoutPostgres(t *testing.T) {
+	c := openPostgres(t)
+	db, cancel := c.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := db.Exec("SELECT pg_sleep(1)").Error; err == nil {
+		t.Error("the slow query succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("the slow query returned after %s", elapsed)
+	}
+}
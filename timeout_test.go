@@ -0,0 +1,89 @@
+package dbwrap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// slowSQL is a statement running for about 200ms, sqlite checking for the cancellation between the 10 calls of
+// sleep. The aggregate makes sure that they run before the first row is returned.
+const slowSQL = "WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 10) " +
+	"SELECT count(sleep(20)) FROM seq"
+
+func TestWithTimeout(t *testing.T) {
+	c := openSqliteSleep(t)
+	db, cancel := c.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var ms int64
+	if err := db.Raw("SELECT sleep(?)", 1).Scan(&ms).Error; err != nil {
+		t.Fatalf("a fast query failed: %v", err)
+	}
+	err := db.Exec(slowSQL).Error
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow query error = %v, want context.DeadlineExceeded", err)
+	}
+	if err = c.Db().Exec("SELECT sleep(?)", 100).Error; err != nil {
+		t.Errorf("Db() = %v, want it unaffected by the timeout of the session", err)
+	}
+
+	db, cancel = c.WithTimeout(context.Background(), time.Minute)
+	cancel()
+	if err = db.Exec("SELECT 1").Error; !errors.Is(err, context.Canceled) {
+		t.Errorf("query after cancel = %v, want context.Canceled", err)
+	}
+}
+
+func TestWithTimeoutDebug(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewWithOptions(WithDebug(), WithLogger(bufferLogger(&buf))).
+		SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	db, cancel := c.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := db.Exec("SELECT 42").Error; err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "SELECT 42") {
+		t.Errorf("the session did not log with debug on: %q", buf.String())
+	}
+}
+
+func TestTransactionWithTimeout(t *testing.T) {
+	c := openSqliteSleep(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.TransactionWithTimeout(context.Background(), 50*time.Millisecond, func(tx *gorm.DB) error {
+		if err := tx.Create(&testUser{Name: "a"}).Error; err != nil {
+			return err
+		}
+		return tx.Exec(slowSQL).Error
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TransactionWithTimeout() = %v, want context.DeadlineExceeded", err)
+	}
+	if count := countUsers(t, c); count != 0 {
+		t.Errorf("%d rows, want the transaction rolled back", count)
+	}
+	err = c.TransactionWithTimeout(context.Background(), time.Second, func(tx *gorm.DB) error {
+		return tx.Create(&testUser{Name: "a"}).Error
+	})
+	if err != nil || countUsers(t, c) != 1 {
+		t.Errorf("TransactionWithTimeout() = %v, want the row committed", err)
+	}
+	if err = New(false, nil).TransactionWithTimeout(context.Background(), time.Second, func(*gorm.DB) error {
+		return nil
+	}); err != ErrNotOpened {
+		t.Errorf("TransactionWithTimeout() = %v before Open, want ErrNotOpened", err)
+	}
+}
@@ -0,0 +1,131 @@
+package dbwrap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TruncateTables empties the tables of models, or of every registered model when none is given, resetting their
+// identity sequences and ignoring the foreign keys between them. It runs in a transaction but on mysql, where
+// TRUNCATE commits implicitly, and clickhouse.
+func (c *DbMgt) TruncateTables(ctx context.Context, models ...interface{}) error {
+	db, err := c.DbE()
+	if err != nil {
+		return err
+	}
+	if len(models) <= 0 {
+		c.lock.Lock()
+		models = append(models, c.models...)
+		c.lock.Unlock()
+	}
+	db = db.WithContext(ctx)
+	var tables []string
+	seen := make(map[string]bool, len(models))
+	for _, model := range models {
+		table, err := tableOf(db, model)
+		if err != nil {
+			return err
+		}
+		if !seen[table] {
+			seen[table] = true
+			tables = append(tables, table)
+		}
+	}
+	if len(tables) <= 0 {
+		return nil
+	}
+	driver := db.Dialector.Name()
+	var sequence int64
+	if driver == driverSqlite {
+		err = db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'").
+			Scan(&sequence).Error
+		if err != nil {
+			return err
+		}
+	}
+	stmt := &gorm.Statement{DB: db}
+	stmts, restore, err := truncateStatements(driver, tables, stmt.Quote, sequence > 0)
+	if err != nil {
+		return err
+	}
+	run := func(tx *gorm.DB) error {
+		defer func() {
+			for _, s := range restore {
+				if err := tx.Exec(s).Error; err != nil && c.log != nil {
+					c.log.Error(nil, "dbwrap: truncate tables: %s: %v", s, err)
+				}
+			}
+		}()
+		for _, s := range stmts {
+			if err := tx.Exec(s).Error; err != nil {
+				return fmt.Errorf("dbwrap: truncate tables: %w", err)
+			}
+		}
+		return nil
+	}
+	if driver == "clickhouse" {
+		return run(db)
+	}
+	// a transaction also keeps the session settings of mysql on one connection
+	return db.Transaction(run)
+}
+
+// truncateStatements returns the statements emptying tables on driver, quoted with quote, and the ones to run
+// afterwards even when they fail. sequence tells whether sqlite has a sqlite_sequence table to reset.
+func truncateStatements(driver string, tables []string, quote func(interface{}) string, sequence bool) (
+	stmts, restore []string, err error) {
+	quoted := make([]string, len(tables))
+	for i, t := range tables {
+		quoted[i] = quote(t)
+	}
+	switch driver {
+	case driverPostgres:
+		stmts = []string{"TRUNCATE TABLE " + strings.Join(quoted, ", ") + " RESTART IDENTITY CASCADE"}
+	case driverMysql:
+		stmts = []string{"SET FOREIGN_KEY_CHECKS = 0"}
+		for _, t := range quoted {
+			stmts = append(stmts, "TRUNCATE TABLE "+t)
+		}
+		restore = []string{"SET FOREIGN_KEY_CHECKS = 1"}
+	case driverSqlite:
+		// the foreign keys are checked on commit, once every table is empty
+		stmts = []string{"PRAGMA defer_foreign_keys = ON"}
+		for _, t := range quoted {
+			stmts = append(stmts, "DELETE FROM "+t)
+		}
+		if sequence {
+			names := make([]string, len(tables))
+			for i, t := range tables {
+				names[i] = "'" + strings.ReplaceAll(t, "'", "''") + "'"
+			}
+			stmts = append(stmts, "DELETE FROM sqlite_sequence WHERE name IN ("+strings.Join(names, ", ")+")")
+		}
+	case driverSqlServer:
+		// TRUNCATE refuses tables referenced by a foreign key, even a disabled one
+		for _, t := range quoted {
+			stmts = append(stmts, "ALTER TABLE "+t+" NOCHECK CONSTRAINT ALL")
+		}
+		for i, t := range quoted {
+			name := "'" + strings.ReplaceAll(tables[i], "'", "''") + "'"
+			stmts = append(stmts, "DELETE FROM "+t,
+				"IF OBJECTPROPERTY(OBJECT_ID("+name+"), 'TableHasIdentity') = 1 DBCC CHECKIDENT ("+name+", RESEED, 0)")
+		}
+		for _, t := range quoted {
+			stmts = append(stmts, "ALTER TABLE "+t+" WITH CHECK CHECK CONSTRAINT ALL")
+		}
+	case "clickhouse":
+		for _, t := range quoted {
+			stmts = append(stmts, "TRUNCATE TABLE "+t)
+		}
+	default:
+		return nil, nil, fmt.Errorf("dbwrap: TruncateTables does not support %s", driver)
+	}
+	return stmts, restore, nil
+}
+
+func TruncateTables(ctx context.Context, models ...interface{}) error {
+	return DefaultDbMgt().TruncateTables(ctx, models...)
+}
@@ -0,0 +1,97 @@
+package dbwrap
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTruncateStatements(t *testing.T) {
+	quote := func(v interface{}) string {
+		return `"` + v.(string) + `"`
+	}
+	tables := []string{"users", "it's"}
+	tests := []struct {
+		driver         string
+		sequence       bool
+		stmts, restore []string
+	}{
+		{driverPostgres, false, []string{`TRUNCATE TABLE "users", "it's" RESTART IDENTITY CASCADE`}, nil},
+		{driverMysql, false, []string{"SET FOREIGN_KEY_CHECKS = 0", `TRUNCATE TABLE "users"`, `TRUNCATE TABLE "it's"`},
+			[]string{"SET FOREIGN_KEY_CHECKS = 1"}},
+		{driverSqlite, false, []string{"PRAGMA defer_foreign_keys = ON", `DELETE FROM "users"`, `DELETE FROM "it's"`},
+			nil},
+		{driverSqlite, true, []string{"PRAGMA defer_foreign_keys = ON", `DELETE FROM "users"`, `DELETE FROM "it's"`,
+			"DELETE FROM sqlite_sequence WHERE name IN ('users', 'it''s')"}, nil},
+		{driverSqlServer, false, []string{
+			`ALTER TABLE "users" NOCHECK CONSTRAINT ALL`,
+			`ALTER TABLE "it's" NOCHECK CONSTRAINT ALL`,
+			`DELETE FROM "users"`,
+			"IF OBJECTPROPERTY(OBJECT_ID('users'), 'TableHasIdentity') = 1 DBCC CHECKIDENT ('users', RESEED, 0)",
+			`DELETE FROM "it's"`,
+			"IF OBJECTPROPERTY(OBJECT_ID('it''s'), 'TableHasIdentity') = 1 DBCC CHECKIDENT ('it''s', RESEED, 0)",
+			`ALTER TABLE "users" WITH CHECK CHECK CONSTRAINT ALL`,
+			`ALTER TABLE "it's" WITH CHECK CHECK CONSTRAINT ALL`,
+		}, nil},
+		{"clickhouse", false, []string{`TRUNCATE TABLE "users"`, `TRUNCATE TABLE "it's"`}, nil},
+	}
+	for _, tt := range tests {
+		stmts, restore, err := truncateStatements(tt.driver, tables, quote, tt.sequence)
+		if err != nil {
+			t.Errorf("%s: %v", tt.driver, err)
+			continue
+		}
+		if !reflect.DeepEqual(stmts, tt.stmts) || !reflect.DeepEqual(restore, tt.restore) {
+			t.Errorf("%s: truncateStatements() = %q, %q, want %q, %q", tt.driver, stmts, restore, tt.stmts, tt.restore)
+		}
+	}
+	if _, _, err := truncateStatements("oracle", tables, quote, false); err == nil {
+		t.Error("truncateStatements accepted an unknown driver")
+	}
+}
+
+type testSequenced struct {
+	ID   uint `gorm:"primaryKey;autoIncrement"`
+	Name string
+}
+
+func TestTruncateTables(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Migrate(&testUser{}); err != nil {
+		t.Fatal(err)
+	}
+	// AUTOINCREMENT keeps the last id in sqlite_sequence
+	err := c.Db().Exec("CREATE TABLE test_sequenceds (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.Db().Create(&testSequenced{Name: "row"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Db().Create(&testUser{Name: "row"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// no model means every registered model
+	if err := c.TruncateTables(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := countUsers(t, c); n != 0 {
+		t.Errorf("%d users left, want 0", n)
+	}
+	var count int64
+	if err := c.Db().Model(&testSequenced{}).Count(&count).Error; err != nil || count != 3 {
+		t.Errorf("%d rows, %v in the unregistered table, want 3", count, err)
+	}
+	if err := c.TruncateTables(context.Background(), &testSequenced{}, "test_sequenceds"); err != nil {
+		t.Fatal(err)
+	}
+	row := testSequenced{Name: "first"}
+	if err := c.Db().Create(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+	if row.ID != 1 {
+		t.Errorf("ID = %d after the truncation, want the sequence reset to 1", row.ID)
+	}
+}
@@ -0,0 +1,161 @@
+package dbwrap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func (c *DbMgt) SetParamFromURL(raw string) error {
+	p, err := parseURL(raw)
+	if err != nil {
+		return err
+	}
+	c.setParam(p)
+	return nil
+}
+
+func parseURL(raw string) (Config, error) {
+	if raw == ":memory:" || strings.HasPrefix(raw, "file:") {
+		return Config{Driver: driverSqlite, Name: raw}, nil
+	}
+	idx := strings.Index(raw, "://")
+	if idx <= 0 {
+		return Config{}, errors.New("dbwrap: missing scheme in database url")
+	}
+	scheme, rest := strings.ToLower(raw[:idx]), raw[idx+3:]
+	switch scheme {
+	case "sqlite", "sqlite3":
+		if len(rest) <= 0 {
+			return Config{}, errors.New("dbwrap: missing sqlite path in database url")
+		}
+		return Config{Driver: driverSqlite, Name: rest}, nil
+	case "postgres", "postgresql":
+		return parsePgURL(raw)
+	case "mysql":
+		return parseMysqlURL(rest)
+	case "sqlserver", "mssql":
+		return parseSqlServerURL(raw)
+	default:
+		return Config{}, fmt.Errorf("dbwrap: unsupported database url scheme %q", scheme)
+	}
+}
+
+func parsePgURL(raw string) (Config, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Config{}, err
+	}
+	p := urlParam(driverPostgres, u)
+	p.Name = strings.TrimPrefix(u.Path, "/")
+	for k, v := range u.Query() {
+		if len(v) <= 0 {
+			continue
+		}
+		switch k {
+		case "sslmode":
+			if err = checkPgSSLMode(v[0]); err != nil {
+				return Config{}, err
+			}
+			p.SSLMode = v[0]
+		case "sslrootcert":
+			p.SSLRootCert = v[0]
+		case "sslcert":
+			p.SSLCert = v[0]
+		case "sslkey":
+			p.SSLKey = v[0]
+		case "host":
+			// a socket directory, e.g. postgres:///app?host=/var/run/postgresql
+			p.Host = v[0]
+		case "port":
+			p.Port = v[0]
+		case "user":
+			p.User = v[0]
+		case "password":
+			p.Password = v[0]
+		case "dbname":
+			p.Name = v[0]
+		default:
+			p.setOption(k, v[0])
+		}
+	}
+	return p, nil
+}
+
+func parseMysqlURL(rest string) (Config, error) {
+	if at := strings.LastIndex(rest, "@"); at >= 0 && strings.HasPrefix(rest[at+1:], "tcp(") {
+		addr := rest[at+5:]
+		end := strings.Index(addr, ")")
+		if end < 0 {
+			return Config{}, errors.New("dbwrap: unterminated tcp address in mysql url")
+		}
+		rest = rest[:at+1] + addr[:end] + addr[end+1:]
+	}
+	u, err := url.Parse("mysql://" + rest)
+	if err != nil {
+		return Config{}, err
+	}
+	p := urlParam(driverMysql, u)
+	p.Name = strings.TrimPrefix(u.Path, "/")
+	for k, v := range u.Query() {
+		if len(v) <= 0 {
+			continue
+		}
+		switch k {
+		case "charset":
+			p.Charset = v[0]
+		case "loc":
+			p.Loc = v[0]
+		case "parseTime":
+			if p.ParseTime, err = strconv.ParseBool(v[0]); err != nil {
+				return Config{}, fmt.Errorf("dbwrap: invalid parseTime %q in mysql url", v[0])
+			}
+		default:
+			p.setOption(k, v[0])
+		}
+	}
+	return p, nil
+}
+
+func parseSqlServerURL(raw string) (Config, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Config{}, err
+	}
+	p := urlParam(driverSqlServer, u)
+	p.Name = strings.TrimPrefix(u.Path, "/")
+	for k, v := range u.Query() {
+		if len(v) <= 0 {
+			continue
+		}
+		if strings.EqualFold(k, "database") {
+			p.Name = v[0]
+		} else {
+			p.setOption(k, v[0])
+		}
+	}
+	return p, nil
+}
+
+func urlParam(driver string, u *url.URL) Config {
+	p := Config{Driver: driver, Host: u.Hostname(), Port: u.Port()}
+	if u.User != nil {
+		p.User = u.User.Username()
+		p.Password, _ = u.User.Password()
+	}
+	return p
+}
+
+func SetParamFromURL(raw string) error {
+	return DefaultDbMgt().SetParamFromURL(raw)
+}
+
+func NewFromURL(raw string) (*DbMgt, error) {
+	mgt := New(false, nil)
+	if err := mgt.SetParamFromURL(raw); err != nil {
+		return nil, err
+	}
+	return mgt, nil
+}
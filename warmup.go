@@ -0,0 +1,72 @@
+package dbwrap
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// Warmup establishes n pool connections concurrently, at most MaxOpenConns, so the first requests do not pay
+// for dialing. Unless MaxIdleConns is configured, the idle limit is raised to n to keep them open, it is
+// never lowered.
+func (c *DbMgt) Warmup(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	sqlDB, err := c.CommonDBE()
+	if err != nil {
+		return err
+	}
+	if max := sqlDB.Stats().MaxOpenConnections; max > 0 && n > max {
+		n = max
+	}
+	c.lock.Lock()
+	idle := defaultMaxIdleConns
+	if c.warmPool == sqlDB && c.warmIdle > idle {
+		idle = c.warmIdle
+	}
+	if c.config.MaxIdleConns <= 0 && n > idle {
+		sqlDB.SetMaxIdleConns(n)
+		c.warmPool, c.warmIdle = sqlDB, n
+	}
+	c.lock.Unlock()
+
+	conns := make([]*sql.Conn, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := sqlDB.Conn(ctx)
+			if err == nil {
+				if err = conn.PingContext(ctx); err != nil {
+					conn.Close()
+					conn = nil
+				}
+			}
+			conns[i], errs[i] = conn, err
+		}(i)
+	}
+	wg.Wait()
+	// the connections are only released once all are held, otherwise they would be reused
+	var established int
+	var firstErr error
+	for i, conn := range conns {
+		if conn != nil {
+			established++
+			conn.Close()
+		} else if firstErr == nil {
+			firstErr = errs[i]
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("dbwrap: warmup established %d of %d connections: %w", established, n, firstErr)
+	}
+	return nil
+}
+
+func Warmup(ctx context.Context, n int) error {
+	return DefaultDbMgt().Warmup(ctx, n)
+}
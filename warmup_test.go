@@ -0,0 +1,76 @@
+package dbwrap
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarmup(t *testing.T) {
+	c := openSqlite(t)
+	if err := c.Warmup(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.CommonDB().Stats(); stats.OpenConnections < 5 || stats.InUse != 0 {
+		t.Errorf("%d open and %d in use connections, want at least 5 idle", stats.OpenConnections, stats.InUse)
+	}
+}
+
+func TestWarmupMaxOpenConns(t *testing.T) {
+	c := openSqlite(t)
+	c.SetConnPool(3, 0, 0, 0)
+	if err := c.Warmup(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if open := c.CommonDB().Stats().OpenConnections; open != 3 {
+		t.Errorf("%d open connections, want MaxOpenConns 3", open)
+	}
+}
+
+func TestWarmupFailure(t *testing.T) {
+	c := openSqlite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.Warmup(ctx, 4)
+	if err == nil || !strings.Contains(err.Error(), "established 0 of 4 connections") {
+		t.Errorf("Warmup() = %v, want the number of established connections", err)
+	}
+	if err = New(false, nil).Warmup(context.Background(), 4); err != ErrNotOpened {
+		t.Errorf("Warmup() = %v before Open, want ErrNotOpened", err)
+	}
+}
+
+func TestOpenWithPolicyWarmup(t *testing.T) {
+	c := New(false, nil).SetSqlite3Param(filepath.Join(t.TempDir(), "test.db"))
+	policy := ConstantRetryPolicy(time.Millisecond, 1)
+	policy.Warmup = 4
+	if err := c.OpenWithPolicy(context.Background(), policy); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if open := c.CommonDB().Stats().OpenConnections; open < 4 {
+		t.Errorf("%d open connections, want at least 4", open)
+	}
+}
+
+func TestWarmupKeepsIdleLimit(t *testing.T) {
+	c := openSqlite(t)
+	tests := []struct {
+		n, want int
+	}{
+		{1, defaultMaxIdleConns},
+		{5, 5},
+		{3, 5},
+	}
+	for _, tt := range tests {
+		if err := c.Warmup(context.Background(), tt.n); err != nil {
+			t.Fatal(err)
+		}
+		holdConns(t, c, 6)
+		if idle := c.CommonDB().Stats().Idle; idle != tt.want {
+			t.Errorf("Warmup(%d): %d idle connections, want %d", tt.n, idle, tt.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package dbwrap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WatchdogConfig sets how often the watchdog pings, how many failures in a row trigger a Reopen and how
+// the reopen attempts back off, by default doubling from Interval up to 30 intervals.
+type WatchdogConfig struct {
+	Interval         time.Duration
+	FailureThreshold int
+	ReopenBackoff    RetryPolicy
+}
+
+type WatchdogStats struct {
+	PingsAttempted int
+	Failures       int
+	Reopens        int
+	// CurrentStreak is the number of consecutive failed pings.
+	CurrentStreak int
+}
+
+// Watchdog pings a DbMgt and rebuilds its connection pool when pings keep failing.
+type Watchdog struct {
+	mgt    *DbMgt
+	cancel context.CancelFunc
+	done   chan struct{}
+	lock   sync.Mutex
+	stats  WatchdogStats
+}
+
+// StartWatchdog runs a Watchdog until ctx is done or Stop is called. Only one watchdog may run per DbMgt.
+func (c *DbMgt) StartWatchdog(ctx context.Context, cfg WatchdogConfig) (*Watchdog, error) {
+	if cfg.Interval <= 0 {
+		return nil, errors.New("dbwrap: watchdog interval must be positive")
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 1
+	}
+	if cfg.ReopenBackoff.InitialInterval <= 0 {
+		cfg.ReopenBackoff = RetryPolicy{InitialInterval: cfg.Interval, MaxInterval: 30 * cfg.Interval, Multiplier: 2,
+			JitterFraction: 0.2}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.watchdog != nil {
+		return nil, errors.New("dbwrap: a watchdog is already running")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w := &Watchdog{mgt: c, cancel: cancel, done: make(chan struct{})}
+	c.watchdog = w
+	go w.run(ctx, cfg)
+	return w, nil
+}
+
+func (w *Watchdog) run(ctx context.Context, cfg WatchdogConfig) {
+	defer close(w.done)
+	defer func() {
+		w.mgt.lock.Lock()
+		if w.mgt.watchdog == w {
+			w.mgt.watchdog = nil
+		}
+		w.mgt.lock.Unlock()
+	}()
+	tick := time.NewTicker(cfg.Interval)
+	defer tick.Stop()
+	var reopenFailures int
+	var nextReopen time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, w.mgt.keepalivePingTimeout(cfg.Interval))
+		err := w.mgt.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, ErrNotOpened) || errors.Is(err, ErrDraining) {
+			continue
+		}
+		w.lock.Lock()
+		w.stats.PingsAttempted++
+		if err == nil {
+			w.stats.CurrentStreak = 0
+		} else {
+			w.stats.Failures++
+			w.stats.CurrentStreak++
+			atomic.AddInt64(&w.mgt.counters.PingFailures, 1)
+		}
+		streak := w.stats.CurrentStreak
+		w.lock.Unlock()
+		if err == nil {
+			reopenFailures = 0
+			continue
+		}
+		w.mgt.log.Error(nil, "dbwrap: watchdog ping: %v", err)
+		if streak < cfg.FailureThreshold || time.Now().Before(nextReopen) {
+			continue
+		}
+		if err = w.mgt.Reopen(ctx); err != nil {
+			reopenFailures++
+			delay := cfg.ReopenBackoff.NextDelay(reopenFailures)
+			nextReopen = time.Now().Add(delay)
+			w.mgt.log.Error(nil, "dbwrap: watchdog reopen: %v, retrying in %s", err, delay)
+			continue
+		}
+		reopenFailures = 0
+		w.lock.Lock()
+		w.stats.Reopens++
+		w.stats.CurrentStreak = 0
+		w.lock.Unlock()
+	}
+}
+
+// Stop stops the watchdog and waits for it to exit, it may be called several times.
+func (w *Watchdog) Stop() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *Watchdog) Stats() WatchdogStats {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.stats
+}
+
+func StartWatchdog(ctx context.Context, cfg WatchdogConfig) (*Watchdog, error) {
+	return DefaultDbMgt().StartWatchdog(ctx, cfg)
+}
@@ -0,0 +1,98 @@
+package dbwrap
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+)
+
+func TestWatchdogReopen(t *testing.T) {
+	dialector := &flakyDialector{Dialector: sqlite.Open(filepath.Join(t.TempDir(), "test.db"))}
+	c := New(false, nil).SetDialector(dialector)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	w, err := c.StartWatchdog(context.Background(), WatchdogConfig{Interval: 5 * time.Millisecond, FailureThreshold: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	waitFor(t, "a ping", func() bool { return w.Stats().PingsAttempted > 0 })
+	// the next two reopens fail, the third one succeeds
+	atomic.StoreInt32(&dialector.failures, 3)
+	if err = c.CommonDB().Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the reopen", func() bool { return w.Stats().Reopens == 1 })
+	stats := w.Stats()
+	if stats.Failures < 3 || stats.CurrentStreak != 0 {
+		t.Errorf("Stats() = %+v, want at least the threshold of 3 failures and the streak reset", stats)
+	}
+	if attempts := atomic.LoadInt32(&dialector.attempts); attempts != 4 {
+		t.Errorf("%d opens, want the first one and three reopens", attempts)
+	}
+	if reopens := c.Counters().Reopens; reopens != 1 {
+		t.Errorf("%d reopens counted, want 1", reopens)
+	}
+	if err = c.Db().Exec("SELECT 1").Error; err != nil {
+		t.Errorf("query after the reopen: %v", err)
+	}
+}
+
+func TestWatchdogOnePerInstance(t *testing.T) {
+	c := openSqlite(t)
+	cfg := WatchdogConfig{Interval: 5 * time.Millisecond}
+	w, err := c.StartWatchdog(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, err := c.StartWatchdog(context.Background(), cfg); err == nil {
+		second.Stop()
+		t.Fatal("a second watchdog started")
+	}
+	other, err := openSqlite(t).StartWatchdog(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("the watchdog of another instance: %v", err)
+	}
+	other.Stop()
+	waitFor(t, "a ping", func() bool { return w.Stats().PingsAttempted > 0 })
+	w.Stop()
+	w.Stop()
+	pings := w.Stats().PingsAttempted
+	time.Sleep(20 * time.Millisecond)
+	if got := w.Stats().PingsAttempted; got != pings {
+		t.Errorf("%d pings after Stop, want none", got-pings)
+	}
+	if w, err = c.StartWatchdog(context.Background(), cfg); err != nil {
+		t.Fatalf("StartWatchdog after Stop: %v", err)
+	}
+	w.Stop()
+}
+
+func TestWatchdogContext(t *testing.T) {
+	c := openSqlite(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := c.StartWatchdog(ctx, WatchdogConfig{Interval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the watchdog did not stop with its context")
+	}
+	if _, err = c.StartWatchdog(context.Background(), WatchdogConfig{}); err == nil {
+		t.Error("StartWatchdog accepted a zero interval")
+	}
+}